@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/letitbeat/dp-analyzer/pkg/clock"
+	"github.com/letitbeat/dp-analyzer/pkg/dot"
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/pcap"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+)
+
+// offline holds the flags shared by the commands building flow trees from
+// files, without storage backend
+type offline struct {
+	topology       *string
+	topologyFormat *string
+	device         *string
+	merge          *bool
+	skew           *bool
+	verbose        *bool
+}
+
+func offlineFlags(fs *flag.FlagSet) *offline {
+	return &offline{
+		topology:       fs.String("topology", "", "topology file, required"),
+		topologyFormat: fs.String("topology-format", "", "json, mininet, netjson, graphml or dot, derived from the file extension when empty"),
+		device:         fs.String("device", "", "device of the capture files, derived from each file name when empty"),
+		merge:          fs.Bool("merge", false, "merge the flow trees by group as the server does"),
+		skew:           fs.Bool("skew", false, "estimate and correct the clock offsets of the capture devices"),
+		verbose:        fs.Bool("v", false, "log the flow trees building steps"),
+	}
+}
+
+// build reads the observation files and the topology and returns the flow
+// trees of the observations, verified against props when given
+func (o *offline) build(names []string, props []smt.Property, solver smt.Solver, enc *tree.Encoding) ([]tree.FlowTree, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no observation files given")
+	}
+	if *o.topology == "" {
+		return nil, fmt.Errorf("no topology file given")
+	}
+	if !*o.verbose {
+		log.SetOutput(ioutil.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	topo, err := readTopology(*o.topology, *o.topologyFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	var pks []packets.Packet
+	for _, name := range names {
+		read, err := readObservations(name, *o.device)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s, %v", name, err)
+		}
+		pks = append(pks, read...)
+	}
+	if *o.skew {
+		skew := clock.NewSkew(nil)
+		skew.Update(pks, []topology.Topology{topo})
+		pks = skew.CorrectAll(pks)
+	}
+
+	packetsMap := make(map[string][]packets.Packet)
+	for _, p := range pks {
+		packetsMap[p.Payload] = append(packetsMap[p.Payload], p)
+	}
+
+	g := tree.NewGenerator(topo, props, solver, enc)
+	trees, err := g.Generate(packetsMap)
+	if err != nil {
+		return nil, err
+	}
+
+	if *o.merge {
+		grouped := make(map[string][]tree.FlowTree)
+		for _, ft := range trees {
+			grouped[ft.Group()] = append(grouped[ft.Group()], ft)
+		}
+		if trees, err = g.Merge(grouped); err != nil {
+			return nil, err
+		}
+	} else if len(props) > 0 {
+		for i := range trees {
+			g.Verify(&trees[i])
+		}
+	}
+
+	sort.Slice(trees, func(i, j int) bool {
+		return trees[i].CapturedAt < trees[j].CapturedAt ||
+			(trees[i].CapturedAt == trees[j].CapturedAt && trees[i].ID < trees[j].ID)
+	})
+	return trees, nil
+}
+
+// readTopology reads a topology file, see topology.Import
+func readTopology(name, format string) (topology.Topology, error) {
+	f := topology.FormatOfFile(name)
+	if format != "" {
+		var err error
+		if f, err = topology.ParseFormat(format); err != nil {
+			return topology.Topology{}, err
+		}
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return topology.Topology{}, err
+	}
+	t, err := topology.Import(f, b)
+	if err != nil {
+		return t, fmt.Errorf("error importing %s, %v", name, err)
+	}
+	return t, nil
+}
+
+// readObservations reads the observations of a pcap/pcapng capture file or
+// of a JSON array or newline-delimited JSON stream of packets, packets
+// without payload UID are skipped
+func readObservations(name, device string) ([]packets.Packet, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pcap", ".pcapng", ".cap":
+		if device == "" {
+			device = pcap.DeviceFromFilename(name)
+		}
+		pks, _, err := pcap.Read(f, device)
+		return pks, err
+	}
+
+	var pks []packets.Packet
+	err = packets.Decode(f, func(i int, p packets.Packet, err error) error {
+		if err == nil {
+			err = p.Validate()
+		}
+		switch {
+		case err == packets.ErrEmptyPayload:
+			return nil
+		case err != nil:
+			return fmt.Errorf("packet %d, %v", i, err)
+		}
+		if p.CapturedAtNano == 0 {
+			p.CapturedAtNano = p.CapturedAt.UnixNano()
+		}
+		pks = append(pks, p)
+		return nil
+	})
+	return pks, err
+}
+
+// writeJSON writes v as indented JSON to the named file, or to the
+// standard output when name is empty
+func writeJSON(name string, v interface{}) error {
+	var w io.Writer = os.Stdout
+	if name != "" {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// analyzeCmd builds the flow trees of the observation files given as
+// arguments against a topology file, without storage backend
+func analyzeCmd(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	o := offlineFlags(fs)
+	format := fs.String("format", "json", "output format: json, dot or svg")
+	out := fs.String("o", "", "output file for json, directory of the files of every tree for dot and svg; the standard output and the current directory when empty")
+	renderer := fs.String("renderer", dot.Native, "graph renderer used for svg: native or graphviz")
+	rendererPath := fs.String("renderer-path", "", "graphviz dot binary, looked up in PATH when empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s analyze -topology file [flags] observations.{json,ndjson,pcap,pcapng}...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *format != "json" && *format != "dot" && *format != "svg" {
+		fs.Usage()
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+	r, err := dot.NewRenderer(*renderer, *rendererPath)
+	if err != nil {
+		return err
+	}
+	dot.SetDefault(r, dot.SVG)
+
+	trees, err := o.build(fs.Args(), nil, nil, nil)
+	if err != nil {
+		fs.Usage()
+		return err
+	}
+
+	if *format == "json" {
+		return writeJSON(*out, trees)
+	}
+
+	dir := *out
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, ft := range trees {
+		b := []byte(ft.Nodes)
+		if *format == "svg" {
+			if b, err = r.Render(ft.Nodes, dot.SVG); err != nil {
+				return fmt.Errorf("error rendering the flow tree %s, %v", ft.ID, err)
+			}
+		}
+		name := filepath.Join(dir, fmt.Sprintf("%s.%s", ft.ID, *format))
+		if err := ioutil.WriteFile(name, b, 0644); err != nil {
+			return err
+		}
+	}
+	log.Printf("wrote %d flow trees to %s", len(trees), dir)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/letitbeat/dp-analyzer/pkg/pcap"
+	"github.com/letitbeat/dp-analyzer/pkg/session"
+)
+
+// importCmd imports pcap/pcapng capture files given as arguments
+func importCmd(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	device := fs.String("device", "", "device name, derived from each file name when empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s import [-device name] file.pcap...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no capture files given")
+	}
+
+	repos, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer repos.Close()
+	// the packets are tagged with the open session like the ones posted
+	repo := session.NewTaggingRepository(repos.Packets, repos.Sessions)
+
+	failed := 0
+	for _, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Printf("error opening %s, %v", name, err)
+			failed++
+			continue
+		}
+		r := pcap.Import(repo, f, name, *device)
+		f.Close()
+
+		if r.Error != "" {
+			log.Printf("error importing %s, %s", name, r.Error)
+			failed++
+			continue
+		}
+		log.Printf("imported %d packets from %s (device %s), skipped %d", r.Imported, name, r.Device, r.Skipped)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to import", failed, fs.NArg())
+	}
+	return nil
+}
@@ -2,54 +2,58 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"net/http"
-
-	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
-	"github.com/letitbeat/dp-analyzer/pkg/db/mongo"
-	"github.com/letitbeat/dp-analyzer/pkg/packets"
-	"github.com/letitbeat/dp-analyzer/pkg/smt"
-	"github.com/letitbeat/dp-analyzer/pkg/topology"
-	"github.com/letitbeat/dp-analyzer/pkg/tree"
-	"github.com/spf13/viper"
+	"os"
+	"sort"
+
+	"github.com/letitbeat/dp-analyzer/pkg/config"
+	"github.com/letitbeat/dp-analyzer/pkg/storage"
 )
 
-func init() {
-	viper.SetConfigName("config")
-	viper.AddConfigPath("/app/") // optionally look for config in the working directory
-	err := viper.ReadInConfig()
+// openStorage opens the storage backend selected in the config file or
+// the environment variables, see config.Load
+func openStorage() (*storage.Repositories, error) {
+	c, err := config.Load(nil)
 	if err != nil {
-		log.Fatalf("error reading config file: %v", err)
+		return nil, err
 	}
+	return storage.Open(context.Background(), c.StorageConfig())
 }
 
-func main() {
+// commands holds the subcommands by name, the server is started when no
+// subcommand is given
+var commands = map[string]func(args []string) error{
+	"analyze":  analyzeCmd,
+	"verify":   verifyCmd,
+	"serve":    serveCmd,
+	"import":   importCmd,
+	"topology": topologyCmd,
+}
 
-	client, err := mongo.Connect(context.Background(), viper.GetString("db_uri"))
-	if err != nil {
-		log.Fatalf("error connecting to db, %v", err)
+func usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
 	}
-	topoRepo := topology.NewRepository(client)
-	topoHandler := topology.NewHandler(topoRepo)
-
-	packetsRepo := packets.NewRepository(client)
-	packetsHandler := packets.NewHandler(packetsRepo)
-
-	smtRepo := smt.NewRepository(client)
-	smtHandler := smt.NewHandler(smtRepo)
-
-	treeHandler := tree.NewHandler(packetsRepo, topoRepo, smtRepo)
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: %s [command] [flags]\n\ncommands: %v\n", os.Args[0], names)
+	fmt.Fprintf(os.Stderr, "run %s <command> -h for the flags of a command\n", os.Args[0])
+}
 
-	router := mux.NewRouter()
+func main() {
 
-	router.HandleFunc("/topology", topoHandler.Set).Methods(http.MethodPost)
-	router.HandleFunc("/topology", topoHandler.Get).Methods(http.MethodGet)
-	router.HandleFunc("/smt", smtHandler.Save).Methods(http.MethodPost)
-	router.HandleFunc("/smt", smtHandler.Get).Methods(http.MethodGet)
-	router.HandleFunc("/save", packetsHandler.Save).Methods(http.MethodPost)
-	router.HandleFunc("/", treeHandler.GetAll).Methods(http.MethodGet)
+	cmd, args := serveCmd, []string(nil)
+	if len(os.Args) > 1 {
+		var ok bool
+		if cmd, ok = commands[os.Args[1]]; !ok {
+			usage()
+			os.Exit(2)
+		}
+		args = os.Args[2:]
+	}
 
-	log.Printf("listening on port %d", 5000)
-	log.Fatal(http.ListenAndServe(":5000", handlers.CORS()(router)))
+	if err := cmd(args); err != nil {
+		log.Fatal(err)
+	}
 }
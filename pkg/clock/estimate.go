@@ -0,0 +1,341 @@
+package clock
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+// MinHopDelay is the least delay assumed between the captures of a packet
+// at two adjacent devices
+const MinHopDelay = time.Microsecond
+
+const (
+	// oneWayWeight is the weight of the samples of the device pairs only
+	// crossed in one direction, they only bound the offset
+	oneWayWeight = 0.25
+	// confidenceHops is the number of hops through a device at which its
+	// confidence reaches half the share of its ordered hops
+	confidenceHops = 10
+	// maxIterations bounds the iterations of the least squares solver, which
+	// stops once no offset changes by more than convergence nanoseconds
+	maxIterations = 1000
+	convergence   = 1e-3
+)
+
+// pair holds the delays between the captures at two adjacent devices, u
+// and v sorted by name, forward holds the delays from u to v and backward
+// the delays from v to u, as measured by their clocks
+type pair struct {
+	u, v              string
+	forward, backward []int64
+}
+
+// theta returns the estimated offset of v from u and the weight of the
+// estimate. When the pair is crossed in both directions the delays are
+// assumed symmetric, as NTP does with the fastest samples, otherwise the
+// offset is only corrected when the captures are not ordered.
+func (p *pair) theta() (float64, float64) {
+	f, b := minimum(p.forward), minimum(p.backward)
+	switch {
+	case len(p.forward) > 0 && len(p.backward) > 0:
+		return float64(f-b) / 2, float64(len(p.forward) + len(p.backward))
+	case len(p.forward) > 0:
+		return math.Min(0, float64(f-int64(MinHopDelay))), oneWayWeight * float64(len(p.forward))
+	}
+	return math.Max(0, float64(int64(MinHopDelay)-b)), oneWayWeight * float64(len(p.backward))
+}
+
+// EstimateOffsets estimates the clock offset of every capture device from
+// the observations, against the topology version active at the first
+// capture of every payload UID. The captures of a payload UID at two
+// adjacent devices, the ports of a link or two ports of the same node, give
+// the delay of the hop between them, its direction being given by their
+// distance to the source host, the host of the source IP or else the host
+// linked to the first device captured linked to a host. Devices captured more than once for
+// a payload UID are ignored for it.
+//
+// Hops give the offsets between pairs of devices, which are reconciled by
+// weighted least squares. The manual offsets are kept as they are, devices
+// whose adjacencies reach none of them are relative to the device of the
+// most weighted hops, whose offset is 0.
+func EstimateOffsets(pks []packets.Packet, topos []topology.Topology, manual Offsets) Estimate {
+	byPayload := make(map[string][]packets.Packet)
+	for _, p := range pks {
+		if p.Payload == "" || p.Device == "" || p.CapturedAt == nil {
+			continue
+		}
+		if p.CapturedAtNano == 0 {
+			p.CapturedAtNano = p.CapturedAt.UnixNano()
+		}
+		byPayload[p.Payload] = append(byPayload[p.Payload], p)
+	}
+
+	e := Estimate{Payloads: len(byPayload), Offsets: []Offset{}, EstimatedAt: time.Now()}
+	pairs := make(map[[2]string]*pair)
+	indexes := make(map[*topology.Topology]*topology.Index)
+	for _, obs := range byPayload {
+		sort.SliceStable(obs, func(i, j int) bool { return obs[i].CapturedAtNano < obs[j].CapturedAtNano })
+		topo, err := topology.ActiveAt(topos, time.Unix(0, obs[0].CapturedAtNano))
+		if err != nil {
+			break
+		}
+		index, ok := indexes[topo]
+		if !ok {
+			index = topo.Index()
+			indexes[topo] = index
+		}
+		e.Hops += hops(index, obs, pairs)
+	}
+
+	var keys [][2]string
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	offsets := solve(keys, pairs, manual)
+
+	// consistent counts the hops through every device ordered once corrected
+	consistent := make(map[string]int)
+	total := make(map[string]int)
+	for _, k := range keys {
+		p := pairs[k]
+		theta := offsets[p.v] - offsets[p.u]
+		for _, d := range p.forward {
+			total[p.u]++
+			total[p.v]++
+			if float64(d)-theta > 0 {
+				consistent[p.u]++
+				consistent[p.v]++
+			}
+		}
+		for _, d := range p.backward {
+			total[p.u]++
+			total[p.v]++
+			if float64(d)+theta > 0 {
+				consistent[p.u]++
+				consistent[p.v]++
+			}
+		}
+	}
+
+	var devices []string
+	for d := range offsets {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+	for _, d := range devices {
+		o := Offset{Device: d, Offset: int64(math.Round(offsets[d])), Hops: total[d]}
+		if m, ok := manual[d]; ok {
+			o.Offset, o.Confidence, o.Manual = int64(m), 1, true
+		} else {
+			o.Confidence = float64(consistent[d]) / float64(total[d]+confidenceHops)
+		}
+		e.Offsets = append(e.Offsets, o)
+	}
+	return e
+}
+
+// hops adds the hops of the observations of a payload UID to the pairs of
+// adjacent devices, it returns the number of hops added
+func hops(index *topology.Index, obs []packets.Packet, pairs map[[2]string]*pair) int {
+	at := make(map[string]int64)
+	repeated := make(map[string]bool)
+	for _, o := range obs {
+		if _, ok := at[o.Device]; ok {
+			repeated[o.Device] = true
+		}
+		at[o.Device] = o.CapturedAtNano
+	}
+	for d := range repeated {
+		delete(at, d)
+	}
+
+	src, ok := index.HostByIP(obs[0].SrcIP)
+	for i := 0; !ok && i < len(obs); i++ {
+		if peer, found := index.Peer(obs[i].Device); found {
+			if n, _ := index.Node(peer.Node); n != nil && n.Kind == topology.Host {
+				src, ok = peer.Node, true
+			}
+		}
+	}
+	if !ok {
+		return 0
+	}
+	dist := distances(index, src)
+
+	// position orders the devices along the path from the source, the
+	// egress port of a node being after its ingress port
+	position := func(device string) (int, bool) {
+		owner, ok := index.Owner(device)
+		peer, found := index.Peer(device)
+		if !ok || !found {
+			return 0, false
+		}
+		o, ok := dist[owner]
+		p, found := dist[peer.Node]
+		if !ok || !found || o == p {
+			return 0, false
+		}
+		if p < o {
+			return 2 * o, true
+		}
+		return 2*o + 1, true
+	}
+
+	n := 0
+	for u := range at {
+		owner, _ := index.Owner(u)
+		for v := range at {
+			if u >= v {
+				continue
+			}
+			peer, _ := index.Peer(u)
+			if o, _ := index.Owner(v); peer.Port != v && (owner == "" || o != owner) {
+				continue
+			}
+			pu, ok := position(u)
+			pv, found := position(v)
+			if !ok || !found || pu == pv {
+				continue
+			}
+
+			k := [2]string{u, v}
+			p, ok := pairs[k]
+			if !ok {
+				p = &pair{u: u, v: v}
+				pairs[k] = p
+			}
+			if pu < pv {
+				p.forward = append(p.forward, at[v]-at[u])
+			} else {
+				p.backward = append(p.backward, at[u]-at[v])
+			}
+			n++
+		}
+	}
+	return n
+}
+
+// distances returns the number of links from the node to every node
+// reachable from it
+func distances(index *topology.Index, from string) map[string]int {
+	dist := map[string]int{from: 0}
+	queue := []string{from}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range index.Neighbors(n) {
+			if _, ok := dist[m]; !ok {
+				dist[m] = dist[n] + 1
+				queue = append(queue, m)
+			}
+		}
+	}
+	return dist
+}
+
+// solve returns the offsets of the devices minimizing the weighted squared
+// differences with the offsets estimated by the pairs, the manual offsets
+// being fixed. Devices not connected to a manual offset are relative to
+// the device of their component with the largest weight.
+func solve(keys [][2]string, pairs map[[2]string]*pair, manual Offsets) map[string]float64 {
+	type edge struct {
+		peer          string
+		theta, weight float64
+	}
+	edges := make(map[string][]edge)
+	weights := make(map[string]float64)
+	for _, k := range keys {
+		p := pairs[k]
+		theta, w := p.theta()
+		edges[p.u] = append(edges[p.u], edge{p.v, theta, w})
+		edges[p.v] = append(edges[p.v], edge{p.u, -theta, w})
+		weights[p.u] += w
+		weights[p.v] += w
+	}
+
+	offsets := make(map[string]float64)
+	fixed := make(map[string]bool)
+	for d, o := range manual {
+		offsets[d] = float64(o)
+		fixed[d] = true
+	}
+
+	var devices []string
+	for d := range edges {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+
+	// every component without a manual offset is anchored at its device
+	// of the largest weight
+	visited := make(map[string]bool)
+	for _, d := range devices {
+		if visited[d] {
+			continue
+		}
+		component := []string{d}
+		visited[d] = true
+		for i := 0; i < len(component); i++ {
+			for _, e := range edges[component[i]] {
+				if !visited[e.peer] {
+					visited[e.peer] = true
+					component = append(component, e.peer)
+				}
+			}
+		}
+		anchor := ""
+		for _, c := range component {
+			if fixed[c] {
+				anchor = ""
+				break
+			}
+			if anchor == "" || weights[c] > weights[anchor] || (weights[c] == weights[anchor] && c < anchor) {
+				anchor = c
+			}
+		}
+		if anchor != "" {
+			offsets[anchor] = 0
+			fixed[anchor] = true
+		}
+	}
+
+	// Gauss-Seidel iterations, every device is set to the weighted mean of
+	// the offsets given by its pairs
+	for i := 0; i < maxIterations; i++ {
+		change := 0.0
+		for _, d := range devices {
+			if fixed[d] {
+				continue
+			}
+			var sum, w float64
+			for _, e := range edges[d] {
+				sum += e.weight * (offsets[e.peer] - e.theta)
+				w += e.weight
+			}
+			o := sum / w
+			change = math.Max(change, math.Abs(o-offsets[d]))
+			offsets[d] = o
+		}
+		if change < convergence {
+			break
+		}
+	}
+	return offsets
+}
+
+func minimum(ds []int64) int64 {
+	var m int64
+	for i, d := range ds {
+		if i == 0 || d < m {
+			m = d
+		}
+	}
+	return m
+}
@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func TestEstimateOffsets(t *testing.T) {
+	topo := topology.Legacy{
+		Links:     []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"},
+		Addresses: map[string]string{"h1": "10.0.0.1", "h2": "10.0.0.2"},
+	}.Topology()
+
+	// the clock of s2 is 3ms ahead, hops take 1ms on the link between the
+	// switches and 100us within them
+	skew := map[string]time.Duration{"s2-eth1": 3 * time.Millisecond, "s2-eth2": 3 * time.Millisecond}
+	hops := []time.Duration{0, 100 * time.Microsecond, time.Millisecond, 100 * time.Microsecond}
+	base := time.Date(2019, 3, 16, 17, 0, 0, 0, time.UTC)
+	var pks []packets.Packet
+	observe := func(payload, src string, jitter time.Duration, devices ...string) {
+		at := base.Add(time.Duration(len(pks)) * time.Second)
+		for i, d := range devices {
+			at = at.Add(hops[i] + jitter)
+			captured := at.Add(skew[d])
+			pks = append(pks, packets.Packet{Device: d, Payload: payload, SrcIP: src, CapturedAt: &captured, CapturedAtNano: captured.UnixNano()})
+		}
+	}
+	for i := 0; i < 5; i++ {
+		// the payloads are delayed a bit more on every hop
+		jitter := time.Duration(i) * time.Microsecond
+		observe(fmt.Sprintf("a%d", i), "10.0.0.1", jitter, "s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2")
+		observe(fmt.Sprintf("b%d", i), "10.0.0.2", jitter, "s2-eth2", "s2-eth1", "s1-eth2", "s1-eth1")
+	}
+
+	e := EstimateOffsets(pks, []topology.Topology{topo}, nil)
+	if e.Payloads != 10 || e.Hops != 30 {
+		t.Errorf("expected 30 hops of 10 payloads, got %d of %d", e.Hops, e.Payloads)
+	}
+	got := fmt.Sprint(e.Offsets)
+	want := "[{s1-eth1 0 0.5 10 false} {s1-eth2 0 0.6666666666666666 20 false} {s2-eth1 3000000 0.6666666666666666 20 false} {s2-eth2 3000000 0.5 10 false}]"
+	if got != want {
+		t.Errorf("expected the offsets %s, got %s", want, got)
+	}
+
+	// manual offsets are kept, the others follow them
+	e = EstimateOffsets(pks, []topology.Topology{topo}, Offsets{"s1-eth1": time.Millisecond})
+	got = fmt.Sprint(e.Offsets)
+	want = "[{s1-eth1 1000000 1 10 true} {s1-eth2 1000000 0.6666666666666666 20 false} {s2-eth1 4000000 0.6666666666666666 20 false} {s2-eth2 4000000 0.5 10 false}]"
+	if got != want {
+		t.Errorf("expected the offsets %s, got %s", want, got)
+	}
+}
+
+func TestEstimateOneWay(t *testing.T) {
+	topo := topology.Legacy{Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1"}}.Topology()
+
+	// s2-eth1 captures the packets 2ms before s1-eth2 sends them
+	base := time.Date(2019, 3, 16, 17, 0, 0, 0, time.UTC)
+	var pks []packets.Packet
+	for i, d := range map[string]time.Duration{"s1-eth1": 0, "s1-eth2": 3 * time.Millisecond, "s2-eth1": time.Millisecond} {
+		at := base.Add(d)
+		pks = append(pks, packets.Packet{Device: i, Payload: "a", CapturedAt: &at, CapturedAtNano: at.UnixNano()})
+	}
+
+	offsets := make(Offsets)
+	for _, o := range EstimateOffsets(pks, []topology.Topology{topo}, nil).Offsets {
+		offsets[o.Device] = time.Duration(o.Offset)
+	}
+	if offsets["s2-eth1"]-offsets["s1-eth2"] != -2*time.Millisecond-MinHopDelay {
+		t.Errorf("expected s2-eth1 to be corrected after s1-eth2, got %v", offsets)
+	}
+
+	for _, p := range pks {
+		c := offsets.Correct(p)
+		if offsets[p.Device] != 0 && c.CapturedAt == p.CapturedAt || c.CapturedAtNano != p.CapturedAtNano-int64(offsets[p.Device]) {
+			t.Errorf("expected a corrected copy of the capture time of %s, got %v", p.Device, c.CapturedAt)
+		}
+	}
+}
+
+func TestParseOffsets(t *testing.T) {
+	offsets, err := ParseOffsets(map[string]string{"s1-eth1": "-1.5ms"})
+	if err != nil || offsets["s1-eth1"] != -1500*time.Microsecond {
+		t.Errorf("expected -1.5ms, got %v, %v", offsets, err)
+	}
+	if _, err := ParseOffsets(map[string]string{"s1-eth1": "soon"}); err == nil {
+		t.Error("expected an error for an invalid offset")
+	}
+}
@@ -0,0 +1,88 @@
+package clock
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+// Handler implements the clock offsets operations
+type Handler struct {
+	skew        *Skew
+	packetsRepo packets.Repository
+	topoRepo    topology.Repository
+}
+
+// NewHandler returns a new clock offsets Handler estimating the offsets of
+// skew from the observations of packetsRepo
+func NewHandler(skew *Skew, packetsRepo packets.Repository, topoRepo topology.Repository) *Handler {
+	return &Handler{skew, packetsRepo, topoRepo}
+}
+
+// Get HTTP GET handler which returns the clock offsets in use along with
+// their confidence
+func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
+
+	err := json.NewEncoder(response).Encode(h.skew.Estimate())
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Estimate HTTP POST handler which estimates the clock offsets from the
+// observations captured between the optional from and to parameters in
+// RFC 3339 format, see EstimateOffsets, and uses them to correct the
+// following captures
+func (h *Handler) Estimate(response http.ResponseWriter, request *http.Request) {
+
+	var from, to time.Time
+	query := request.URL.Query()
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := query.Get(p.name); v != "" {
+			var err error
+			if *p.t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				writeStatus(response, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	pks, err := h.packetsRepo.FindInRange(from, to)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	topos, err := h.topoRepo.FindAll()
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	e := h.skew.Update(pks, topos)
+	log.Printf("estimated the clock offsets of %d devices from %d hops", len(e.Offsets), e.Hops)
+
+	err = json.NewEncoder(response).Encode(e)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+func writeErr(response http.ResponseWriter, err error) {
+	log.Println("error ", err)
+	writeStatus(response, http.StatusInternalServerError, err)
+}
+
+func writeStatus(response http.ResponseWriter, status int, err error) {
+	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
+	response.WriteHeader(status)
+	response.Write([]byte(msg))
+}
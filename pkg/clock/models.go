@@ -0,0 +1,67 @@
+package clock
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+// Offset is the offset of the clock of a capture device from the reference
+// clock, its captures are corrected by subtracting it
+type Offset struct {
+	Device string `json:"device"`
+	// Offset is in nanoseconds, positive when the clock of the device is
+	// ahead of the reference clock
+	Offset int64 `json:"offset"`
+	// Confidence in [0, 1] is the share of the hops through the device
+	// ordered once corrected, weighted down when few hops were observed
+	Confidence float64 `json:"confidence"`
+	// Hops is the number of hops through the device observed
+	Hops int `json:"hops"`
+	// Manual is true for the offsets configured instead of estimated
+	Manual bool `json:"manual"`
+}
+
+// Estimate holds the offsets of the capture devices estimated from the
+// observations of Payloads payload UIDs
+type Estimate struct {
+	Payloads    int       `json:"payloads"`
+	Hops        int       `json:"hops"`
+	Offsets     []Offset  `json:"offsets"`
+	EstimatedAt time.Time `json:"estimated_at"`
+}
+
+// Offsets holds the clock offset of the capture devices
+type Offsets map[string]time.Duration
+
+// ParseOffsets parses the offsets of the capture devices given as
+// durations, e.g. -1.5ms
+func ParseOffsets(m map[string]string) (Offsets, error) {
+	offsets := make(Offsets)
+	for device, v := range m {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clock offset %q of %s", v, device)
+		}
+		offsets[device] = d
+	}
+	return offsets, nil
+}
+
+// Correct returns the packet with its capture time corrected by the offset
+// of its device, the capture time of the given packet is left untouched
+func (o Offsets) Correct(p packets.Packet) packets.Packet {
+	d, ok := o[p.Device]
+	if !ok || d == 0 || p.CapturedAt == nil {
+		return p
+	}
+	nano := p.CapturedAtNano
+	if nano == 0 {
+		nano = p.CapturedAt.UnixNano()
+	}
+	corrected := time.Unix(0, nano-int64(d)).In(p.CapturedAt.Location())
+	p.CapturedAt = &corrected
+	p.CapturedAtNano = corrected.UnixNano()
+	return p
+}
@@ -0,0 +1,77 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+// Skew holds the clock offsets of the capture devices, the manually
+// configured ones and the latest estimate, and corrects the capture time
+// of the observations before their flow trees are built. A nil Skew
+// corrects nothing.
+type Skew struct {
+	lock     sync.RWMutex
+	manual   Offsets
+	estimate Estimate
+	offsets  Offsets
+}
+
+// NewSkew returns a Skew correcting the captures by the manual offsets
+// until the offsets are estimated
+func NewSkew(manual Offsets) *Skew {
+	s := &Skew{manual: manual}
+	s.set(EstimateOffsets(nil, nil, manual))
+	return s
+}
+
+// Update estimates the offsets from the observations, see EstimateOffsets,
+// and corrects the following captures with them
+func (s *Skew) Update(pks []packets.Packet, topos []topology.Topology) Estimate {
+	e := EstimateOffsets(pks, topos, s.manual)
+	s.set(e)
+	return e
+}
+
+func (s *Skew) set(e Estimate) {
+	offsets := make(Offsets)
+	for _, o := range e.Offsets {
+		offsets[o.Device] = time.Duration(o.Offset)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.estimate, s.offsets = e, offsets
+}
+
+// Estimate returns the offsets in use
+func (s *Skew) Estimate() Estimate {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.estimate
+}
+
+// Correct returns the packet with its capture time corrected by the offset
+// of its device, see Offsets.Correct
+func (s *Skew) Correct(p packets.Packet) packets.Packet {
+	if s == nil {
+		return p
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.offsets.Correct(p)
+}
+
+// CorrectAll corrects the capture time of every packet, see Correct
+func (s *Skew) CorrectAll(pks []packets.Packet) []packets.Packet {
+	if s == nil {
+		return pks
+	}
+	corrected := make([]packets.Packet, len(pks))
+	for i, p := range pks {
+		corrected[i] = s.Correct(p)
+	}
+	return corrected
+}
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/letitbeat/dp-analyzer/pkg/clock"
+	"github.com/letitbeat/dp-analyzer/pkg/dot"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/storage"
+)
+
+// EnvPrefix prefixes the environment variables overriding the config
+// file, e.g. DP_ANALYZER_LISTEN or DP_ANALYZER_TLS_CERT for tls.cert
+const EnvPrefix = "DP_ANALYZER"
+
+// TLS holds the certificate and key files served over HTTPS, the server
+// listens over HTTP when both are empty
+type TLS struct {
+	Cert string `mapstructure:"cert"`
+	Key  string `mapstructure:"key"`
+}
+
+// Enabled reports whether the server is served over HTTPS
+func (t TLS) Enabled() bool {
+	return t.Cert != "" || t.Key != ""
+}
+
+// Config holds the configuration of the server, read from the config file,
+// the environment variables and the flags, the latter taking precedence
+type Config struct {
+	// Listen is the address the server listens on, e.g. :5000
+	Listen string `mapstructure:"listen"`
+	TLS    TLS    `mapstructure:"tls"`
+
+	// Storage is the storage backend: mongo, memory or bolt
+	Storage string `mapstructure:"storage"`
+	DBURI   string `mapstructure:"db_uri"`
+	DBName  string `mapstructure:"db_name"`
+	DBPath  string `mapstructure:"db_path"`
+
+	// TemplatesDir is the directory of the SMT encoding template smt.tmpl
+	TemplatesDir string `mapstructure:"templates_dir"`
+	// WorkDir is the directory the server runs in, the relative paths of
+	// the configuration are resolved against it
+	WorkDir string `mapstructure:"work_dir"`
+
+	Solver        string        `mapstructure:"solver"`
+	SolverPath    string        `mapstructure:"solver_path"`
+	SolverTimeout time.Duration `mapstructure:"solver_timeout"`
+
+	Renderer     string `mapstructure:"renderer"`
+	RendererPath string `mapstructure:"renderer_path"`
+	ImageFormat  string `mapstructure:"image_format"`
+
+	TreeIdleTimeout time.Duration     `mapstructure:"tree_idle_timeout"`
+	ClockOffsets    map[string]string `mapstructure:"clock_offsets"`
+
+	// ReadTimeout and WriteTimeout bound the reading of a request and the
+	// writing of its response, 0 disables them. The event streams are cut
+	// by a write timeout.
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// ShutdownTimeout bounds the draining of the requests and flow trees in
+	// progress once the server is asked to stop
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+// options holds the default and the description of every key, every key
+// but clock_offsets can also be set by a flag of the same name with dashes,
+// e.g. -tls-cert for tls.cert
+var options = []struct {
+	key   string
+	def   interface{}
+	usage string
+}{
+	{"listen", ":5000", "address the server listens on"},
+	{"tls.cert", "", "TLS certificate file, the server listens over HTTP without it"},
+	{"tls.key", "", "TLS key file"},
+	{"storage", storage.Mongo, "storage backend: mongo, memory or bolt"},
+	{"db_uri", "mongodb://localhost:27017", "MongoDB connection URI"},
+	{"db_name", storage.DefaultDatabase, "MongoDB database"},
+	{"db_path", "/app/analyzer.db", "database file of the bolt backend"},
+	{"templates_dir", "/app/templates", "directory of the SMT encoding template smt.tmpl"},
+	{"work_dir", "", "directory the server runs in, relative paths are resolved against it"},
+	{"solver", smt.Z3, "SMT solver: z3 or cvc5"},
+	{"solver_path", "", "solver binary, looked up in PATH when empty"},
+	{"solver_timeout", 30 * time.Second, "maximum time spent verifying a single property"},
+	{"renderer", dot.Native, "graph renderer: native or graphviz"},
+	{"renderer_path", "", "graphviz dot binary, looked up in PATH when empty"},
+	{"image_format", string(dot.SVG), "format of the rendered images: svg or png"},
+	{"tree_idle_timeout", 5 * time.Second, "time without observations after which a flow tree is completed"},
+	{"clock_offsets", map[string]string{}, ""},
+	{"read_timeout", time.Minute, "maximum time reading a request, 0 for none"},
+	{"write_timeout", time.Duration(0), "maximum time writing a response, 0 for none"},
+	{"shutdown_timeout", 30 * time.Second, "maximum time draining the requests and flow trees in progress on shutdown"},
+}
+
+func flagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+// Flags defines on fs the config flag, selecting the config file, and a
+// flag for every key, see Load
+func Flags(fs *flag.FlagSet) {
+	fs.String("config", "", "config file, config.yml in the current directory or /app/ when empty")
+	for _, o := range options {
+		if o.usage == "" {
+			continue
+		}
+		fs.String(flagName(o.key), "", fmt.Sprintf("%s (default %v)", o.usage, o.def))
+	}
+}
+
+// Load reads the configuration from the config file, the environment
+// variables prefixed by EnvPrefix and the flags of fs set on the command
+// line, see Flags, fs may be nil. The config file is given by the config
+// flag or the DP_ANALYZER_CONFIG variable, otherwise config.yml is looked
+// up in the current directory and /app/, the defaults being used when none
+// is found.
+func Load(fs *flag.FlagSet) (*Config, error) {
+	v := viper.New()
+	for _, o := range options {
+		v.SetDefault(o.key, o.def)
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	file := os.Getenv(EnvPrefix + "_CONFIG")
+	if fs != nil {
+		if f := fs.Lookup("config"); f != nil && f.Value.String() != "" {
+			file = f.Value.String()
+		}
+	}
+	if file != "" {
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("error reading config file %s, %v", file, err)
+		}
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.AddConfigPath("/app/")
+		err := v.ReadInConfig()
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			log.Printf("no config file found, using the defaults")
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading config file, %v", err)
+		}
+	}
+
+	if fs != nil {
+		keys := make(map[string]string)
+		for _, o := range options {
+			keys[flagName(o.key)] = o.key
+		}
+		fs.Visit(func(f *flag.Flag) {
+			if key, ok := keys[f.Name]; ok {
+				v.Set(key, f.Value.String())
+			}
+		})
+	}
+
+	c := &Config{}
+	if err := v.Unmarshal(c); err != nil {
+		return nil, fmt.Errorf("invalid configuration, %v", err)
+	}
+	if err := c.resolve(); err != nil {
+		return nil, fmt.Errorf("invalid work_dir, %v", err)
+	}
+	return c, nil
+}
+
+// resolve makes the work directory absolute, so that it is not resolved
+// again once the server runs in it, and resolves the relative paths
+// against it
+func (c *Config) resolve() error {
+	if c.WorkDir == "" {
+		return nil
+	}
+	dir, err := filepath.Abs(c.WorkDir)
+	if err != nil {
+		return err
+	}
+	c.WorkDir = dir
+	for _, p := range []*string{&c.TLS.Cert, &c.TLS.Key, &c.DBPath, &c.TemplatesDir} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(c.WorkDir, *p)
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration and returns every problem found
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	file := func(key, name string) {
+		if fi, err := os.Stat(name); err != nil {
+			add("%s: %v", key, err)
+		} else if fi.IsDir() {
+			add("%s: %s is a directory", key, name)
+		}
+	}
+
+	if c.Listen == "" {
+		add("listen: missing address")
+	}
+	if c.TLS.Enabled() {
+		if c.TLS.Cert == "" || c.TLS.Key == "" {
+			add("tls: both the certificate and the key are required")
+		} else {
+			file("tls.cert", c.TLS.Cert)
+			file("tls.key", c.TLS.Key)
+		}
+	}
+
+	switch c.Storage {
+	case storage.Mongo:
+		if c.DBURI == "" {
+			add("db_uri: missing URI for the %s backend", storage.Mongo)
+		}
+		if c.DBName == "" {
+			add("db_name: missing database for the %s backend", storage.Mongo)
+		}
+	case storage.Bolt:
+		if c.DBPath == "" {
+			add("db_path: missing path for the %s backend", storage.Bolt)
+		}
+	case storage.Memory:
+	default:
+		add("storage: unknown backend %q", c.Storage)
+	}
+
+	if c.WorkDir != "" {
+		if fi, err := os.Stat(c.WorkDir); err != nil {
+			add("work_dir: %v", err)
+		} else if !fi.IsDir() {
+			add("work_dir: %s is not a directory", c.WorkDir)
+		}
+	}
+	file("templates_dir", filepath.Join(c.TemplatesDir, "smt.tmpl"))
+
+	if c.Solver != smt.Z3 && c.Solver != smt.CVC5 {
+		add("solver: unknown solver %q", c.Solver)
+	}
+	if c.Renderer != dot.Native && c.Renderer != dot.Graphviz {
+		add("renderer: unknown renderer %q", c.Renderer)
+	}
+	if _, err := dot.ParseFormat(c.ImageFormat); err != nil {
+		add("image_format: %v", err)
+	}
+	if _, err := clock.ParseOffsets(c.ClockOffsets); err != nil {
+		add("clock_offsets: %v", err)
+	}
+
+	for _, d := range []struct {
+		key string
+		d   time.Duration
+	}{
+		{"solver_timeout", c.SolverTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+	} {
+		if d.d < 0 {
+			add("%s: negative duration %s", d.key, d.d)
+		}
+	}
+	if c.TreeIdleTimeout <= 0 {
+		add("tree_idle_timeout: must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("shutdown_timeout: must be positive")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// StorageConfig returns the configuration of the storage backend
+func (c *Config) StorageConfig() storage.Config {
+	return storage.Config{Backend: c.Storage, URI: c.DBURI, Database: c.DBName, Path: c.DBPath}
+}
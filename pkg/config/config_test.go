@@ -0,0 +1,123 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "templates"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "templates", "smt.tmpl"), nil, 0644)
+
+	file := filepath.Join(dir, "config.yml")
+	ioutil.WriteFile(file, []byte(`
+listen: ":6000"
+storage: bolt
+db_path: analyzer.db
+templates_dir: templates
+solver_timeout: 10s
+clock_offsets:
+  s2-eth1: 1.5ms
+`), 0644)
+
+	// the environment overrides the file and the flags override both
+	os.Setenv("DP_ANALYZER_LISTEN", ":7000")
+	os.Setenv("DP_ANALYZER_SOLVER_TIMEOUT", "20s")
+	defer os.Unsetenv("DP_ANALYZER_LISTEN")
+	defer os.Unsetenv("DP_ANALYZER_SOLVER_TIMEOUT")
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	Flags(fs)
+	if err := fs.Parse([]string{"-config", file, "-work-dir", dir, "-solver-timeout", "40s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Listen != ":7000" || c.SolverTimeout != 40*time.Second || c.TreeIdleTimeout != 5*time.Second {
+		t.Errorf("expected the flags, environment and defaults to apply, got %+v", c)
+	}
+	if c.DBPath != filepath.Join(dir, "analyzer.db") || c.TemplatesDir != filepath.Join(dir, "templates") {
+		t.Errorf("expected the paths to be resolved against the work dir, got %s and %s", c.DBPath, c.TemplatesDir)
+	}
+	if c.ClockOffsets["s2-eth1"] != "1.5ms" {
+		t.Errorf("expected the clock offsets of the file, got %v", c.ClockOffsets)
+	}
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	if s := c.StorageConfig(); s.Backend != "bolt" || s.Path != c.DBPath {
+		t.Errorf("unexpected storage config %+v", s)
+	}
+
+	// a relative work dir is made absolute, the paths resolved against it
+	// stay valid once the server runs in it
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs = flag.NewFlagSet("serve", flag.ContinueOnError)
+	Flags(fs)
+	if err := fs.Parse([]string{"-config", file, "-work-dir", rel}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = Load(fs); err != nil {
+		t.Fatal(err)
+	}
+	if c.WorkDir != dir || c.DBPath != filepath.Join(dir, "analyzer.db") {
+		t.Errorf("expected the work dir %s and the paths resolved against it, got %s and %s", dir, c.WorkDir, c.DBPath)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	Flags(fs)
+	args := []string{"-config", "/nonexistent/config.yml"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(fs); err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+
+	c := &Config{
+		Listen:          ":5000",
+		TLS:             TLS{Cert: "cert.pem"},
+		Storage:         "postgres",
+		TemplatesDir:    "/nonexistent",
+		Solver:          "yices",
+		Renderer:        "native",
+		ImageFormat:     "gif",
+		TreeIdleTimeout: time.Second,
+		ShutdownTimeout: time.Second,
+		ReadTimeout:     -time.Second,
+	}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected an invalid configuration")
+	}
+	for _, key := range []string{"tls:", "storage:", "templates_dir:", "solver:", "image_format:", "read_timeout:"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected a problem with %s, got %v", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "renderer:") || strings.Contains(err.Error(), "listen:") {
+		t.Errorf("unexpected problems, %v", err)
+	}
+}
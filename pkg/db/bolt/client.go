@@ -0,0 +1,119 @@
+package bolt
+
+import (
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Open opens (creating it if needed) an embedded BoltDB database file
+func Open(path string) (*bbolt.DB, error) {
+	return bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+}
+
+// Put stores a document under the given key, documents are encoded using
+// BSON so the same struct tags as in MongoDB apply.
+func Put(db *bbolt.DB, bucket, key string, v interface{}) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// PutAll stores a set of documents in a single transaction
+func PutAll(db *bbolt.DB, bucket string, keys []string, values []interface{}) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			data, err := bson.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(keys[i]), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get decodes the document stored under key into v, it returns false if
+// there is no such document.
+func Get(db *bbolt.DB, bucket, key string, v interface{}) (bool, error) {
+	found := false
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return bson.Unmarshal(data, v)
+	})
+	return found, err
+}
+
+// ForEach calls fn with every document of the bucket in key order, decode
+// unmarshals the document into the given value.
+func ForEach(db *bbolt.DB, bucket string, fn func(key string, decode func(v interface{}) error) error) error {
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, data []byte) error {
+			return fn(string(k), func(v interface{}) error {
+				return bson.Unmarshal(data, v)
+			})
+		})
+	})
+}
+
+// Delete removes the document stored under key
+func Delete(db *bbolt.DB, bucket, key string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// DeleteAll removes every document of the bucket
+func DeleteAll(db *bbolt.DB, bucket string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucket)) == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(bucket))
+	})
+}
+
+// Count returns the number of documents stored in the bucket
+func Count(db *bbolt.DB, bucket string) (int64, error) {
+	var count int64
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		count = int64(b.Stats().KeyN)
+		return nil
+	})
+	return count, err
+}
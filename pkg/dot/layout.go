@@ -0,0 +1,286 @@
+package dot
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// Layout dimensions in pixels
+const (
+	charWidth   = 7.0
+	fontSize    = 12.0
+	nodeHeight  = 36.0
+	nodeMinW    = 54.0
+	nodePadding = 24.0
+	hGap        = 24.0
+	vGap        = 48.0
+	margin      = 16.0
+	titleHeight = 28.0
+	arrowLength = 10.0
+	arrowWidth  = 7.0
+)
+
+// point is a position in the drawing
+type point struct {
+	X, Y float64
+}
+
+// layoutNode is a node placed in the drawing, X and Y are its center
+type layoutNode struct {
+	Name     string
+	Label    string
+	Attrs    map[string]string
+	X, Y     float64
+	W, H     float64
+	Level    int
+	children []*layoutNode
+}
+
+// layoutEdge is an edge placed in the drawing
+type layoutEdge struct {
+	Src, Dst *layoutNode
+	Attrs    map[string]string
+	// From and To are the edge end points on the node borders
+	From, To point
+}
+
+// layout is a graph laid out in layers, one per depth level of the
+// spanning forest of the graph, which is how flow trees are drawn.
+type layout struct {
+	Label    string
+	Directed bool
+	Nodes    []*layoutNode
+	Edges    []*layoutEdge
+	Width    float64
+	Height   float64
+}
+
+// newLayout parses a DOT graph and computes the position of its nodes
+// and edges.
+func newLayout(dotStr string) (*layout, error) {
+	g, err := gographviz.Read([]byte(dotStr))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing DOT, %v", err)
+	}
+
+	l := &layout{
+		Label:    unquote(g.Attrs["label"]),
+		Directed: g.Directed,
+	}
+
+	byName := make(map[string]*layoutNode)
+	node := func(name string, attrs gographviz.Attrs) *layoutNode {
+		if n, ok := byName[name]; ok {
+			return n
+		}
+		n := &layoutNode{Name: name, Attrs: attrMap(attrs)}
+		n.Label = n.Attrs["label"]
+		if n.Label == "" || n.Label == `\N` {
+			n.Label = unquote(name)
+		}
+		n.W = math.Max(nodeMinW, float64(len(n.Label))*charWidth+nodePadding)
+		n.H = nodeHeight
+		byName[name] = n
+		l.Nodes = append(l.Nodes, n)
+		return n
+	}
+
+	for _, n := range g.Nodes.Nodes {
+		node(n.Name, n.Attrs)
+	}
+	for _, e := range g.Edges.Edges {
+		l.Edges = append(l.Edges, &layoutEdge{
+			Src:   node(e.Src, nil),
+			Dst:   node(e.Dst, nil),
+			Attrs: attrMap(e.Attrs),
+		})
+	}
+
+	l.place()
+	return l, nil
+}
+
+// place assigns levels using a breadth-first spanning forest and centers
+// every node above its children.
+func (l *layout) place() {
+	adjacent := make(map[*layoutNode][]*layoutNode)
+	indegree := make(map[*layoutNode]int)
+	for _, e := range l.Edges {
+		adjacent[e.Src] = append(adjacent[e.Src], e.Dst)
+		indegree[e.Dst]++
+		if !l.Directed {
+			adjacent[e.Dst] = append(adjacent[e.Dst], e.Src)
+		}
+	}
+
+	var roots []*layoutNode
+	visited := make(map[*layoutNode]bool)
+	bfs := func(root *layoutNode) {
+		roots = append(roots, root)
+		visited[root] = true
+		queue := []*layoutNode{root}
+		for len(queue) > 0 {
+			n := queue[0]
+			queue = queue[1:]
+			for _, c := range adjacent[n] {
+				if visited[c] {
+					continue
+				}
+				visited[c] = true
+				c.Level = n.Level + 1
+				n.children = append(n.children, c)
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	if l.Directed {
+		for _, n := range l.Nodes {
+			if indegree[n] == 0 && !visited[n] {
+				bfs(n)
+			}
+		}
+	}
+	for _, n := range l.Nodes {
+		if !visited[n] {
+			bfs(n)
+		}
+	}
+
+	top := margin
+	if l.Label != "" {
+		top += titleHeight
+	}
+
+	maxLevel := 0
+	x := margin
+	for _, r := range roots {
+		x += l.placeSubtree(r, x)
+	}
+	for _, n := range l.Nodes {
+		n.Y = top + float64(n.Level)*(nodeHeight+vGap) + nodeHeight/2
+		if n.Level > maxLevel {
+			maxLevel = n.Level
+		}
+	}
+
+	l.Width = math.Max(x+margin-hGap, float64(len(l.Label))*charWidth+2*margin)
+	l.Height = top + float64(maxLevel+1)*(nodeHeight+vGap) - vGap + margin
+
+	for _, e := range l.Edges {
+		e.From = border(e.Src, point{e.Dst.X, e.Dst.Y})
+		e.To = border(e.Dst, point{e.Src.X, e.Src.Y})
+	}
+}
+
+// placeSubtree places the subtree rooted at n starting at x and returns
+// its width
+func (l *layout) placeSubtree(n *layoutNode, x float64) float64 {
+	own := n.W + hGap
+	if len(n.children) == 0 {
+		n.X = x + n.W/2
+		return own
+	}
+
+	width := 0.0
+	for _, c := range n.children {
+		width += l.placeSubtree(c, x+width)
+	}
+	if own > width {
+		// the node is wider than its children, center them below it
+		shift := (own - width) / 2
+		for _, c := range n.children {
+			shiftSubtree(c, shift)
+		}
+		width = own
+	}
+
+	first, last := n.children[0], n.children[len(n.children)-1]
+	n.X = (first.X + last.X) / 2
+	return width
+}
+
+func shiftSubtree(n *layoutNode, dx float64) {
+	n.X += dx
+	for _, c := range n.children {
+		shiftSubtree(c, dx)
+	}
+}
+
+// border returns the point where the segment from the center of n to p
+// crosses the border of n
+func border(n *layoutNode, p point) point {
+	dx, dy := p.X-n.X, p.Y-n.Y
+	if dx == 0 && dy == 0 {
+		return point{n.X, n.Y}
+	}
+	rx, ry := n.W/2, n.H/2
+
+	var t float64
+	switch shape(n) {
+	case "box":
+		t = math.Min(math.Abs(rx/nonZero(dx)), math.Abs(ry/nonZero(dy)))
+	default:
+		t = 1 / math.Sqrt((dx*dx)/(rx*rx)+(dy*dy)/(ry*ry))
+	}
+	return point{n.X + dx*t, n.Y + dy*t}
+}
+
+func nonZero(v float64) float64 {
+	if v == 0 {
+		return 1e-9
+	}
+	return v
+}
+
+// arrowHead returns the three corners of the arrow head of an edge
+func arrowHead(e *layoutEdge) [3]point {
+	dx, dy := e.To.X-e.From.X, e.To.Y-e.From.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return [3]point{e.To, e.To, e.To}
+	}
+	ux, uy := dx/length, dy/length
+	base := point{e.To.X - ux*arrowLength, e.To.Y - uy*arrowLength}
+	return [3]point{
+		e.To,
+		{base.X - uy*arrowWidth/2, base.Y + ux*arrowWidth/2},
+		{base.X + uy*arrowWidth/2, base.Y - ux*arrowWidth/2},
+	}
+}
+
+// shape returns the normalized shape of a node, box or ellipse
+func shape(n *layoutNode) string {
+	switch n.Attrs["shape"] {
+	case "box", "rect", "rectangle", "square":
+		return "box"
+	}
+	return "ellipse"
+}
+
+// penWidth returns the stroke width given by the penwidth attribute
+func penWidth(attrs map[string]string) float64 {
+	if w, err := strconv.ParseFloat(attrs["penwidth"], 64); err == nil && w > 0 {
+		return w
+	}
+	return 1
+}
+
+func attrMap(attrs gographviz.Attrs) map[string]string {
+	m := make(map[string]string)
+	for k, v := range attrs {
+		m[string(k)] = unquote(v)
+	}
+	return m
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.Replace(s[1:len(s)-1], `\"`, `"`, -1)
+	}
+	return s
+}
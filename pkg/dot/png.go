@@ -0,0 +1,196 @@
+package dot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// colors maps the DOT color names supported by the PNG output
+var colors = map[string]color.RGBA{
+	"black":     {0, 0, 0, 255},
+	"white":     {255, 255, 255, 255},
+	"red":       {255, 0, 0, 255},
+	"green":     {0, 128, 0, 255},
+	"darkgreen": {0, 100, 0, 255},
+	"blue":      {0, 0, 255, 255},
+	"orange":    {255, 165, 0, 255},
+	"yellow":    {255, 255, 0, 255},
+	"purple":    {128, 0, 128, 255},
+	"gray":      {128, 128, 128, 255},
+	"grey":      {128, 128, 128, 255},
+	"lightgrey": {211, 211, 211, 255},
+	"lightgray": {211, 211, 211, 255},
+}
+
+// parseColor returns the color for a DOT color name or #rrggbb value,
+// defaults to black
+func parseColor(c string) color.RGBA {
+	if rgba, ok := colors[strings.ToLower(c)]; ok {
+		return rgba
+	}
+	if len(c) == 7 && c[0] == '#' {
+		if v, err := strconv.ParseUint(c[1:], 16, 32); err == nil {
+			return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}
+		}
+	}
+	return colors["black"]
+}
+
+// canvas is a raster image graphs are drawn on
+type canvas struct {
+	img *image.RGBA
+}
+
+// png draws the layout as a PNG image
+func (l *layout) png() ([]byte, error) {
+	c := &canvas{image.NewRGBA(image.Rect(0, 0, int(math.Ceil(l.Width)), int(math.Ceil(l.Height))))}
+	c.fill(colors["white"])
+
+	if l.Label != "" {
+		c.text(l.Width/2, margin+fontSize/2, l.Label, colors["black"])
+	}
+
+	for _, e := range l.Edges {
+		col := parseColor(e.Attrs["color"])
+		c.line(e.From, e.To, penWidth(e.Attrs), dashed(e.Attrs), col)
+		if l.Directed {
+			c.triangle(arrowHead(e), col)
+		}
+		if label := e.Attrs["label"]; label != "" {
+			x := (e.From.X+e.To.X)/2 + 4 + float64(len(label))*charWidth/2
+			c.text(x, (e.From.Y+e.To.Y)/2, label, col)
+		}
+	}
+
+	for _, n := range l.Nodes {
+		col := parseColor(n.Attrs["color"])
+		if strings.Contains(n.Attrs["style"], "filled") {
+			fill := colors["lightgrey"]
+			if n.Attrs["fillcolor"] != "" {
+				fill = parseColor(n.Attrs["fillcolor"])
+			}
+			c.fillShape(n, fill)
+		}
+		c.outline(n, penWidth(n.Attrs), dashed(n.Attrs), col)
+		c.text(n.X, n.Y, n.Label, parseColor(n.Attrs["fontcolor"]))
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, c.img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func dashed(attrs map[string]string) bool {
+	return strings.Contains(attrs["style"], "dashed") || strings.Contains(attrs["style"], "dotted")
+}
+
+func (c *canvas) fill(col color.RGBA) {
+	for i := 0; i < len(c.img.Pix); i += 4 {
+		c.img.Pix[i], c.img.Pix[i+1], c.img.Pix[i+2], c.img.Pix[i+3] = col.R, col.G, col.B, col.A
+	}
+}
+
+// dot draws a square brush of the given width centered at p
+func (c *canvas) dot(p point, width float64, col color.RGBA) {
+	r := math.Max(width/2, 0.5)
+	for y := int(math.Floor(p.Y - r + 0.5)); y < int(math.Floor(p.Y+r+0.5)); y++ {
+		for x := int(math.Floor(p.X - r + 0.5)); x < int(math.Floor(p.X+r+0.5)); x++ {
+			c.img.SetRGBA(x, y, col)
+		}
+	}
+}
+
+// line draws a segment, dashed lines alternate 5 pixels drawn and 3 not
+func (c *canvas) line(from, to point, width float64, dashed bool, col color.RGBA) {
+	length := math.Hypot(to.X-from.X, to.Y-from.Y)
+	for d := 0.0; d <= length; d += 0.5 {
+		if dashed && math.Mod(d, 8) >= 5 {
+			continue
+		}
+		t := d / math.Max(length, 1e-9)
+		c.dot(point{from.X + (to.X-from.X)*t, from.Y + (to.Y-from.Y)*t}, width, col)
+	}
+}
+
+// outline draws the border of a node
+func (c *canvas) outline(n *layoutNode, width float64, dashed bool, col color.RGBA) {
+	if shape(n) == "box" {
+		x0, y0, x1, y1 := n.X-n.W/2, n.Y-n.H/2, n.X+n.W/2, n.Y+n.H/2
+		c.line(point{x0, y0}, point{x1, y0}, width, dashed, col)
+		c.line(point{x1, y0}, point{x1, y1}, width, dashed, col)
+		c.line(point{x1, y1}, point{x0, y1}, width, dashed, col)
+		c.line(point{x0, y1}, point{x0, y0}, width, dashed, col)
+		return
+	}
+
+	rx, ry := n.W/2, n.H/2
+	steps := int(math.Ceil(2 * math.Pi * math.Max(rx, ry) * 2))
+	for i := 0; i < steps; i++ {
+		if dashed && i%8 >= 5 {
+			continue
+		}
+		a := 2 * math.Pi * float64(i) / float64(steps)
+		c.dot(point{n.X + rx*math.Cos(a), n.Y + ry*math.Sin(a)}, width, col)
+	}
+}
+
+// fillShape fills the inside of a node
+func (c *canvas) fillShape(n *layoutNode, col color.RGBA) {
+	rx, ry := n.W/2, n.H/2
+	for y := int(n.Y - ry); y <= int(n.Y+ry); y++ {
+		for x := int(n.X - rx); x <= int(n.X+rx); x++ {
+			dx, dy := (float64(x)+0.5-n.X)/rx, (float64(y)+0.5-n.Y)/ry
+			if shape(n) == "box" || dx*dx+dy*dy <= 1 {
+				c.img.SetRGBA(x, y, col)
+			}
+		}
+	}
+}
+
+// triangle fills the triangle with the given corners
+func (c *canvas) triangle(t [3]point, col color.RGBA) {
+	minX := math.Min(t[0].X, math.Min(t[1].X, t[2].X))
+	maxX := math.Max(t[0].X, math.Max(t[1].X, t[2].X))
+	minY := math.Min(t[0].Y, math.Min(t[1].Y, t[2].Y))
+	maxY := math.Max(t[0].Y, math.Max(t[1].Y, t[2].Y))
+
+	side := func(a, b, p point) float64 {
+		return (b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X)
+	}
+	for y := int(minY); y <= int(maxY); y++ {
+		for x := int(minX); x <= int(maxX); x++ {
+			p := point{float64(x) + 0.5, float64(y) + 0.5}
+			s0, s1, s2 := side(t[0], t[1], p), side(t[1], t[2], p), side(t[2], t[0], p)
+			if (s0 >= 0 && s1 >= 0 && s2 >= 0) || (s0 <= 0 && s1 <= 0 && s2 <= 0) {
+				c.img.SetRGBA(x, y, col)
+			}
+		}
+	}
+}
+
+// text draws a string centered at the given point
+func (c *canvas) text(x, y float64, s string, col color.RGBA) {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, s)
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot: fixed.Point26_6{
+			X: fixed.Int26_6(x*64) - width/2,
+			Y: fixed.Int26_6((y + float64(face.Ascent)/2 - 1) * 64),
+		},
+	}
+	d.DrawString(s)
+}
@@ -0,0 +1,121 @@
+package dot
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Format is an image format graphs are rendered to
+type Format string
+
+// Supported image formats
+const (
+	SVG Format = "svg"
+	PNG Format = "png"
+)
+
+// ParseFormat returns the format with the given name, defaults to SVG
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case "", SVG:
+		return SVG, nil
+	case PNG:
+		return PNG, nil
+	}
+	return "", fmt.Errorf("unknown image format %q", name)
+}
+
+// MIME returns the media type of images in the format
+func (f Format) MIME() string {
+	if f == PNG {
+		return "image/png"
+	}
+	return "image/svg+xml"
+}
+
+// Supported renderers
+const (
+	Native   = "native"
+	Graphviz = "graphviz"
+)
+
+// Renderer renders DOT graphs into images
+type Renderer interface {
+	Render(dot string, format Format) ([]byte, error)
+}
+
+// NewRenderer returns the renderer with the given name, defaults to the
+// native one. path is the graphviz dot binary, looked up in PATH when empty.
+func NewRenderer(name, path string) (Renderer, error) {
+	switch name {
+	case "", Native:
+		return NativeRenderer{}, nil
+	case Graphviz:
+		if path == "" {
+			path = "dot"
+		}
+		return GraphvizRenderer{path}, nil
+	}
+	return nil, fmt.Errorf("unknown renderer %q", name)
+}
+
+// NativeRenderer lays out and draws graphs in process, it lays graphs out
+// as layered trees which suits the flow trees and topologies of the
+// analyzer.
+type NativeRenderer struct{}
+
+// Render renders the DOT graph in the given format
+func (NativeRenderer) Render(dot string, format Format) ([]byte, error) {
+	l, err := newLayout(dot)
+	if err != nil {
+		return nil, err
+	}
+	if format == PNG {
+		return l.png()
+	}
+	return l.svg(), nil
+}
+
+// GraphvizRenderer renders graphs with the external graphviz dot binary,
+// the graph is piped through its standard input.
+type GraphvizRenderer struct {
+	Path string
+}
+
+// Render renders the DOT graph in the given format
+func (r GraphvizRenderer) Render(dot string, format Format) ([]byte, error) {
+	cmd := exec.Command(r.Path, "-T"+string(format))
+	cmd.Stdin = strings.NewReader(dot)
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Bytes(), nil
+}
+
+var (
+	lock          sync.RWMutex
+	defaultRender Renderer = NativeRenderer{}
+	defaultFormat          = SVG
+)
+
+// SetDefault sets the renderer and format used by Generate
+func SetDefault(r Renderer, f Format) {
+	lock.Lock()
+	defer lock.Unlock()
+	defaultRender = r
+	defaultFormat = f
+}
+
+// Default returns the renderer and format used by Generate
+func Default() (Renderer, Format) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return defaultRender, defaultFormat
+}
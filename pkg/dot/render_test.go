@@ -0,0 +1,72 @@
+package dot
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const tree = `digraph T {
+	label="TCP 80";
+	labelloc=t;
+	h1 [label="h1"];
+	s1 [label="s1"];
+	s2 [label="s2"];
+	h2 [label="h2"];
+	h3 [label="h3"];
+	h1->s1;
+	s1->s2 [color=red, penwidth=2];
+	s2->h2;
+	s1->h3 [style=dashed];
+}`
+
+func TestNativeRendererSVG(t *testing.T) {
+	img, err := NativeRenderer{}.Render(tree, SVG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(img)
+	for _, s := range []string{"<svg", "TCP 80", ">h1<", ">h3<", `stroke="red" stroke-width="2.0"`, "stroke-dasharray"} {
+		if !strings.Contains(svg, s) {
+			t.Errorf("expected %q in %s", s, svg)
+		}
+	}
+}
+
+func TestNativeRendererPNG(t *testing.T) {
+	img, err := NativeRenderer{}.Render(tree, PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds().Dx() == 0 || m.Bounds().Dy() == 0 {
+		t.Errorf("expected a non empty image, got %v", m.Bounds())
+	}
+}
+
+func TestLayout(t *testing.T) {
+	l, err := newLayout(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := map[string]int{"h1": 0, "s1": 1, "s2": 2, "h3": 2, "h2": 3}
+	for _, n := range l.Nodes {
+		if n.Level != levels[n.Name] {
+			t.Errorf("expected %s at level %d, got %d", n.Name, levels[n.Name], n.Level)
+		}
+		if n.X-n.W/2 < 0 || n.X+n.W/2 > l.Width || n.Y+n.H/2 > l.Height {
+			t.Errorf("node %s out of the drawing", n.Name)
+		}
+	}
+	for i, a := range l.Nodes {
+		for _, b := range l.Nodes[i+1:] {
+			if a.Level == b.Level && a.X+a.W/2 > b.X-b.W/2 && b.X+b.W/2 > a.X-a.W/2 {
+				t.Errorf("nodes %s and %s overlap", a.Name, b.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package dot
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// svg draws the layout as an SVG document
+func (l *layout) svg() []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="monospace" font-size="%.0f">`+"\n",
+		l.Width, l.Height, l.Width, l.Height, fontSize)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+
+	if l.Label != "" {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n",
+			l.Width/2, margin+fontSize, html.EscapeString(l.Label))
+	}
+
+	for _, e := range l.Edges {
+		color := colorName(e.Attrs["color"])
+		fmt.Fprintf(&b, `<g class="edge"><title>%s</title>`, html.EscapeString(e.Src.Label+"->"+e.Dst.Label))
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"%s/>`,
+			e.From.X, e.From.Y, e.To.X, e.To.Y, color, penWidth(e.Attrs), dashArray(e.Attrs))
+		if l.Directed {
+			a := arrowHead(e)
+			fmt.Fprintf(&b, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="%s" stroke="%s"/>`,
+				a[0].X, a[0].Y, a[1].X, a[1].Y, a[2].X, a[2].Y, color, color)
+		}
+		if label := e.Attrs["label"]; label != "" {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`,
+				(e.From.X+e.To.X)/2+4, (e.From.Y+e.To.Y)/2, color, html.EscapeString(label))
+		}
+		b.WriteString("</g>\n")
+	}
+
+	for _, n := range l.Nodes {
+		color := colorName(n.Attrs["color"])
+		fill := "none"
+		if strings.Contains(n.Attrs["style"], "filled") {
+			fill = colorName(n.Attrs["fillcolor"])
+			if n.Attrs["fillcolor"] == "" {
+				fill = "lightgrey"
+			}
+		}
+		style := fmt.Sprintf(`fill="%s" stroke="%s" stroke-width="%.1f"%s`, fill, color, penWidth(n.Attrs), dashArray(n.Attrs))
+
+		fmt.Fprintf(&b, `<g class="node"><title>%s</title>`, html.EscapeString(n.Name))
+		if shape(n) == "box" {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" %s/>`,
+				n.X-n.W/2, n.Y-n.H/2, n.W, n.H, style)
+		} else {
+			fmt.Fprintf(&b, `<ellipse cx="%.1f" cy="%.1f" rx="%.1f" ry="%.1f" %s/>`,
+				n.X, n.Y, n.W/2, n.H/2, style)
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" dominant-baseline="central" fill="%s">%s</text>`,
+			n.X, n.Y, colorName(n.Attrs["fontcolor"]), html.EscapeString(n.Label))
+		b.WriteString("</g>\n")
+	}
+
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+func dashArray(attrs map[string]string) string {
+	switch {
+	case strings.Contains(attrs["style"], "dashed"):
+		return ` stroke-dasharray="5,2"`
+	case strings.Contains(attrs["style"], "dotted"):
+		return ` stroke-dasharray="1,5"`
+	}
+	return ""
+}
+
+// colorName returns the SVG color for a DOT color, defaults to black
+func colorName(c string) string {
+	if c == "" {
+		return "black"
+	}
+	return html.EscapeString(c)
+}
@@ -0,0 +1,185 @@
+package packets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+)
+
+// Batch item statuses
+const (
+	StatusAccepted = "accepted"
+	StatusSkipped  = "skipped"
+	StatusRejected = "rejected"
+)
+
+// batchSize is the maximum number of packets written per bulk insert
+const batchSize = 500
+
+// Result holds the outcome of a single item of a batch ingestion
+type Result struct {
+	Index   int    `json:"index"`
+	Payload string `json:"payload,omitempty"`
+	Device  string `json:"device,omitempty"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// BatchResult summarizes a batch ingestion
+type BatchResult struct {
+	Accepted int      `json:"accepted"`
+	Skipped  int      `json:"skipped"`
+	Rejected int      `json:"rejected"`
+	Results  []Result `json:"results"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Decode reads packets from r, which may hold either a JSON array or a
+// newline-delimited JSON stream of Packet objects, and calls fn for each
+// item in order. Items that fail to decode are reported through err and
+// do not stop the decoding of the remaining ones.
+func Decode(r io.Reader, fn func(i int, p Packet, err error) error) error {
+	br := bufio.NewReader(r)
+
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if first == '[' {
+		return decodeArray(br, fn)
+	}
+	return decodeStream(br, fn)
+}
+
+func decodeArray(r io.Reader, fn func(i int, p Packet, err error) error) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return err
+	}
+
+	for i, item := range items {
+		var p Packet
+		err := json.Unmarshal(item, &p)
+		if err := fn(i, p, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeStream(r io.Reader, fn func(i int, p Packet, err error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	i := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var p Packet
+		err := json.Unmarshal(line, &p)
+		if err := fn(i, p, err); err != nil {
+			return err
+		}
+		i++
+	}
+	return scanner.Err()
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, r.UnreadByte()
+	}
+}
+
+// Ingest validates and stores the packets read from r using bulk writes,
+// returning the per-item outcome.
+func Ingest(repo Repository, r io.Reader) (*BatchResult, error) {
+
+	result := &BatchResult{Results: []Result{}}
+
+	var pending []Packet
+	var pendingIdx []int
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		err := repo.StoreAll(pending)
+		if be, ok := err.(*BatchError); ok {
+			for j, e := range be.Failed {
+				result.Results[pendingIdx[j]].Status = StatusRejected
+				result.Results[pendingIdx[j]].Reason = e.Error()
+			}
+		} else if err != nil {
+			for _, i := range pendingIdx {
+				result.Results[i].Status = StatusRejected
+				result.Results[i].Reason = err.Error()
+			}
+		}
+		pending = pending[:0]
+		pendingIdx = pendingIdx[:0]
+	}
+
+	err := Decode(r, func(i int, p Packet, err error) error {
+		res := Result{Index: i, Payload: p.Payload, Device: p.Device, Status: StatusAccepted}
+
+		if err == nil {
+			err = p.Validate()
+		}
+
+		switch {
+		case err == ErrEmptyPayload:
+			res.Status = StatusSkipped
+			res.Reason = err.Error()
+		case err != nil:
+			res.Status = StatusRejected
+			res.Reason = err.Error()
+		default:
+			pending = append(pending, p)
+			pendingIdx = append(pendingIdx, len(result.Results))
+		}
+		result.Results = append(result.Results, res)
+
+		if len(pending) >= batchSize {
+			flush()
+		}
+		return nil
+	})
+	flush()
+
+	for _, res := range result.Results {
+		switch res.Status {
+		case StatusAccepted:
+			result.Accepted++
+		case StatusSkipped:
+			result.Skipped++
+		case StatusRejected:
+			result.Rejected++
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, err
+}
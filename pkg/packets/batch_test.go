@@ -0,0 +1,113 @@
+package packets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type stubRepo struct {
+	stored [][]Packet
+	// fail holds the payloads whose packets are not stored
+	fail map[string]bool
+}
+
+func (s *stubRepo) FindAll() ([]Packet, error)                       { return nil, nil }
+func (s *stubRepo) Store(p Packet) error                             { return nil }
+func (s *stubRepo) FindByPayload(payload string) ([]Packet, error)   { return nil, nil }
+func (s *stubRepo) FindInRange(from, to time.Time) ([]Packet, error) { return nil, nil }
+func (s *stubRepo) FindBySession(session string) ([]Packet, error)   { return nil, nil }
+func (s *stubRepo) DeleteBySession(session string) (int64, error)    { return 0, nil }
+func (s *stubRepo) StoreAll(ps []Packet) error {
+	var stored []Packet
+	failed := make(map[int]error)
+	for i, p := range ps {
+		if s.fail[p.Payload] {
+			failed[i] = errors.New("duplicate key")
+			continue
+		}
+		stored = append(stored, p)
+	}
+	s.stored = append(s.stored, stored)
+	if len(failed) > 0 {
+		return &BatchError{failed}
+	}
+	return nil
+}
+
+func TestIngestArray(t *testing.T) {
+	body := `[
+		{"device":"s1-eth1","type":0,"payload":"a","captured_at":"2019-03-16T17:43:26.385Z"},
+		{"device":"s1-eth2","type":0,"payload":"","captured_at":"2019-03-16T17:43:26.386Z"},
+		{"device":"","type":0,"payload":"b","captured_at":"2019-03-16T17:43:26.387Z"},
+		{"device":"s2-eth1","type":"x"}
+	]`
+
+	repo := &stubRepo{}
+	r, err := Ingest(repo, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if r.Accepted != 1 || r.Skipped != 1 || r.Rejected != 2 {
+		t.Errorf("unexpected counts %+v", r)
+	}
+	expected := []string{StatusAccepted, StatusSkipped, StatusRejected, StatusRejected}
+	for i, s := range expected {
+		if r.Results[i].Status != s || r.Results[i].Index != i {
+			t.Errorf("item %d: expected %s, got %+v", i, s, r.Results[i])
+		}
+	}
+	if len(repo.stored) != 1 || len(repo.stored[0]) != 1 {
+		t.Errorf("expected a single bulk write of 1 packet, got %v", repo.stored)
+	}
+}
+
+func TestIngestStream(t *testing.T) {
+	body := `{"device":"s1-eth1","type":1,"payload":"a","captured_at":"2019-03-16T17:43:26.385Z"}
+
+{"device":"s1-eth2","type":1,"payload":"a","captured_at":"2019-03-16T17:43:26.386Z"}
+not json
+`
+	repo := &stubRepo{}
+	r, err := Ingest(repo, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r.Accepted != 2 || r.Rejected != 1 {
+		t.Errorf("unexpected counts %+v", r)
+	}
+	if r.Results[2].Index != 2 {
+		t.Errorf("expected blank lines to be ignored, got index %d", r.Results[2].Index)
+	}
+}
+
+func TestIngestPartialFailure(t *testing.T) {
+	body := `{"device":"s1-eth1","type":1,"payload":"a","captured_at":"2019-03-16T17:43:26.385Z"}
+{"device":"s1-eth2","type":1,"payload":"dup","captured_at":"2019-03-16T17:43:26.386Z"}
+{"device":"s2-eth1","type":1,"payload":"b","captured_at":"2019-03-16T17:43:26.387Z"}
+`
+	repo := &stubRepo{fail: map[string]bool{"dup": true}}
+	r, err := Ingest(repo, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r.Accepted != 2 || r.Rejected != 1 {
+		t.Errorf("expected only the failed packet to be rejected, got %+v", r)
+	}
+	if r.Results[1].Status != StatusRejected || r.Results[1].Reason != "duplicate key" {
+		t.Errorf("expected the duplicate to be rejected, got %+v", r.Results[1])
+	}
+
+	// the observers are only notified of the packets stored
+	var observed []string
+	o := NewObservedRepository(&stubRepo{fail: map[string]bool{"dup": true}}, ObserverFunc(func(p Packet) {
+		observed = append(observed, p.Payload)
+	}))
+	at := time.Now()
+	err = o.StoreAll([]Packet{{Payload: "a", CapturedAt: &at}, {Payload: "dup", CapturedAt: &at}})
+	if _, ok := err.(*BatchError); !ok || len(observed) != 1 || observed[0] != "a" {
+		t.Errorf("expected a to be observed alone, got %v, %v", observed, err)
+	}
+}
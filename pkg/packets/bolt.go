@@ -0,0 +1,205 @@
+package packets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/db/bolt"
+	bbolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	packetsBucket = "packets"
+	// payloadIndexBucket maps payload+capture time+ID keys to packet keys
+	payloadIndexBucket = "packets_by_payload"
+	// timeIndexBucket maps capture time+ID keys to packet keys
+	timeIndexBucket = "packets_by_time"
+	// sessionIndexBucket maps session+capture time+ID keys to packet keys,
+	// packets captured outside of any session are not indexed
+	sessionIndexBucket = "packets_by_session"
+)
+
+type boltRepo struct {
+	db *bbolt.DB
+}
+
+// NewBoltRepository returns a new Repository backed by an embedded BoltDB
+func NewBoltRepository(db *bbolt.DB) Repository {
+	return &boltRepo{db}
+}
+
+func (r *boltRepo) FindAll() ([]Packet, error) {
+	var packets []Packet
+
+	err := bolt.ForEach(r.db, packetsBucket, func(_ string, decode func(interface{}) error) error {
+		var p Packet
+		if err := decode(&p); err != nil {
+			return err
+		}
+		packets = append(packets, p)
+		return nil
+	})
+	return packets, err
+}
+
+func (r *boltRepo) Store(p Packet) error {
+	if p.Payload == "" {
+		return nil
+	}
+	return r.StoreAll([]Packet{p})
+}
+
+func (r *boltRepo) StoreAll(ps []Packet) error {
+	if len(ps) == 0 {
+		return nil
+	}
+
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		buckets := make([]*bbolt.Bucket, 4)
+		for i, name := range []string{packetsBucket, payloadIndexBucket, timeIndexBucket, sessionIndexBucket} {
+			b, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			buckets[i] = b
+		}
+
+		for _, p := range ps {
+			prepare(&p)
+			data, err := bson.Marshal(p)
+			if err != nil {
+				return err
+			}
+			key := []byte(p.ID.Hex())
+			at := timeKey(p.CapturedAtNano)
+
+			if err := buckets[0].Put(key, data); err != nil {
+				return err
+			}
+			if err := buckets[1].Put(concat(keyPrefix(p.Payload), at, key), key); err != nil {
+				return err
+			}
+			if err := buckets[2].Put(concat(at, key), key); err != nil {
+				return err
+			}
+			if p.Session == "" {
+				continue
+			}
+			if err := buckets[3].Put(concat(keyPrefix(p.Session), at, key), key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *boltRepo) FindByPayload(payload string) ([]Packet, error) {
+	prefix := keyPrefix(payload)
+	return r.scan(payloadIndexBucket, prefix, func(k []byte) bool {
+		return bytes.HasPrefix(k, prefix)
+	})
+}
+
+func (r *boltRepo) FindInRange(from, to time.Time) ([]Packet, error) {
+	var start []byte
+	if !from.IsZero() {
+		start = timeKey(from.UnixNano())
+	}
+	return r.scan(timeIndexBucket, start, func(k []byte) bool {
+		return to.IsZero() || bytes.Compare(k[:8], timeKey(to.UnixNano())) < 0
+	})
+}
+
+func (r *boltRepo) FindBySession(session string) ([]Packet, error) {
+	if session == "" {
+		return nil, nil
+	}
+	prefix := keyPrefix(session)
+	return r.scan(sessionIndexBucket, prefix, func(k []byte) bool {
+		return bytes.HasPrefix(k, prefix)
+	})
+}
+
+func (r *boltRepo) DeleteBySession(session string) (int64, error) {
+	pks, err := r.FindBySession(session)
+	if err != nil || len(pks) == 0 {
+		return 0, err
+	}
+
+	err = r.db.Update(func(tx *bbolt.Tx) error {
+		for _, p := range pks {
+			key := []byte(p.ID.Hex())
+			at := timeKey(p.CapturedAtNano)
+			for _, e := range []struct {
+				bucket string
+				key    []byte
+			}{
+				{packetsBucket, key},
+				{payloadIndexBucket, concat(keyPrefix(p.Payload), at, key)},
+				{timeIndexBucket, concat(at, key)},
+				{sessionIndexBucket, concat(keyPrefix(session), at, key)},
+			} {
+				if err := tx.Bucket([]byte(e.bucket)).Delete(e.key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(pks)), nil
+}
+
+// scan walks an index bucket from start while keys satisfy valid, returning
+// the packets referenced by the index entries.
+func (r *boltRepo) scan(index string, start []byte, valid func(k []byte) bool) ([]Packet, error) {
+	var packets []Packet
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		idx := tx.Bucket([]byte(index))
+		data := tx.Bucket([]byte(packetsBucket))
+		if idx == nil || data == nil {
+			return nil
+		}
+
+		c := idx.Cursor()
+		k, v := c.First()
+		if start != nil {
+			k, v = c.Seek(start)
+		}
+		for ; k != nil && valid(k); k, v = c.Next() {
+			var p Packet
+			if err := bson.Unmarshal(data.Get(v), &p); err != nil {
+				return err
+			}
+			packets = append(packets, p)
+		}
+		return nil
+	})
+	return packets, err
+}
+
+// timeKey encodes a timestamp so its byte order matches the time order
+func timeKey(nanos int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(nanos)^(1<<63))
+	return b
+}
+
+// keyPrefix returns the prefix of the index keys of a payload UID or of a
+// session
+func keyPrefix(payload string) []byte {
+	return append([]byte(payload), 0)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
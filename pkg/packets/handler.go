@@ -25,6 +25,7 @@ func (h Handler) Save(response http.ResponseWriter, request *http.Request) {
 	body, err := ioutil.ReadAll(request.Body)
 	if err != nil {
 		writeErr(response, err)
+		return
 	}
 
 	err = json.Unmarshal(body, &packet)
@@ -36,6 +37,7 @@ func (h Handler) Save(response http.ResponseWriter, request *http.Request) {
 	err = h.repo.Store(packet)
 	if err != nil {
 		writeErr(response, err)
+		return
 	}
 
 	err = json.NewEncoder(response).Encode(`{"success":}`)
@@ -44,6 +46,26 @@ func (h Handler) Save(response http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// SaveBatch handles POST requests holding a JSON array or a newline-delimited
+// JSON stream of Packet objects, it returns the outcome of every item
+func (h Handler) SaveBatch(response http.ResponseWriter, request *http.Request) {
+
+	result, err := Ingest(h.repo, request.Body)
+	if err != nil && len(result.Results) == 0 {
+		writeErr(response, err)
+		return
+	}
+	if err != nil {
+		log.Printf("error reading batch after %d items, %v", len(result.Results), err)
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(response).Encode(result)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
 // GetAll handles GET requests to return a JSON representation of Packets objects
 func (h Handler) GetAll(response http.ResponseWriter, request *http.Request) {
 
@@ -59,9 +81,21 @@ func (h Handler) GetAll(response http.ResponseWriter, request *http.Request) {
 
 }
 
+// statusError is implemented by the errors of the packets rejected by the
+// repository by the fault of the client, e.g. tagged with a session that
+// is not open, they are answered with their status
+type statusError interface {
+	Status() int
+}
+
 func writeErr(response http.ResponseWriter, err error) {
-	log.Printf("error %v", err)
+	status := http.StatusInternalServerError
+	if e, ok := err.(statusError); ok {
+		status = e.Status()
+	} else {
+		log.Printf("error %v", err)
+	}
 	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
-	response.WriteHeader(http.StatusInternalServerError)
+	response.WriteHeader(status)
 	response.Write([]byte(msg))
 }
@@ -0,0 +1,149 @@
+package packets
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryRepo struct {
+	lock    sync.RWMutex
+	packets []Packet
+	// byPayload indexes packets positions by payload UID
+	byPayload map[string][]int
+	// byTime holds packets positions sorted by capture time
+	byTime []int
+}
+
+// NewMemoryRepository returns a new thread-safe in-memory Repository
+func NewMemoryRepository() Repository {
+	return &memoryRepo{byPayload: make(map[string][]int)}
+}
+
+func (r *memoryRepo) FindAll() ([]Packet, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	packets := make([]Packet, 0, len(r.packets))
+	for _, p := range r.packets {
+		packets = append(packets, clone(p))
+	}
+	return packets, nil
+}
+
+func (r *memoryRepo) Store(p Packet) error {
+	if p.Payload == "" {
+		return nil
+	}
+	return r.StoreAll([]Packet{p})
+}
+
+func (r *memoryRepo) StoreAll(ps []Packet) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, p := range ps {
+		prepare(&p)
+		r.add(p)
+	}
+	return nil
+}
+
+// add appends a prepared packet and indexes it
+func (r *memoryRepo) add(p Packet) {
+	i := len(r.packets)
+	r.packets = append(r.packets, clone(p))
+	r.byPayload[p.Payload] = append(r.byPayload[p.Payload], i)
+
+	// keep insertion order among packets captured at the same time
+	at := sort.Search(len(r.byTime), func(j int) bool {
+		return r.packets[r.byTime[j]].CapturedAtNano > p.CapturedAtNano
+	})
+	r.byTime = append(r.byTime, 0)
+	copy(r.byTime[at+1:], r.byTime[at:])
+	r.byTime[at] = i
+}
+
+func (r *memoryRepo) FindByPayload(payload string) ([]Packet, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var packets []Packet
+	for _, i := range r.byPayload[payload] {
+		packets = append(packets, clone(r.packets[i]))
+	}
+	sort.SliceStable(packets, func(i, j int) bool {
+		return packets[i].CapturedAtNano < packets[j].CapturedAtNano
+	})
+	return packets, nil
+}
+
+func (r *memoryRepo) FindInRange(from, to time.Time) ([]Packet, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(len(r.byTime), func(j int) bool {
+			return r.packets[r.byTime[j]].CapturedAtNano >= from.UnixNano()
+		})
+	}
+
+	var packets []Packet
+	for _, i := range r.byTime[start:] {
+		p := r.packets[i]
+		if !to.IsZero() && p.CapturedAtNano >= to.UnixNano() {
+			break
+		}
+		packets = append(packets, clone(p))
+	}
+	return packets, nil
+}
+
+func (r *memoryRepo) FindBySession(session string) ([]Packet, error) {
+	if session == "" {
+		return nil, nil
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var packets []Packet
+	for _, i := range r.byTime {
+		if p := r.packets[i]; p.Session == session {
+			packets = append(packets, clone(p))
+		}
+	}
+	return packets, nil
+}
+
+func (r *memoryRepo) DeleteBySession(session string) (int64, error) {
+	if session == "" {
+		return 0, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// the remaining packets are indexed again in insertion order
+	var kept []Packet
+	for _, p := range r.packets {
+		if p.Session != session {
+			kept = append(kept, p)
+		}
+	}
+	deleted := int64(len(r.packets) - len(kept))
+
+	r.packets, r.byPayload, r.byTime = nil, make(map[string][]int), nil
+	for _, p := range kept {
+		r.add(p)
+	}
+	return deleted, nil
+}
+
+// clone returns a copy of p which does not share its timestamp
+func clone(p Packet) Packet {
+	if p.CapturedAt != nil {
+		t := *p.CapturedAt
+		p.CapturedAt = &t
+	}
+	return p
+}
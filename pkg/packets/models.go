@@ -1,6 +1,7 @@
 package packets
 
 import (
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,6 +19,9 @@ type Packet struct {
 	Payload        string             `json:"payload" bson:"Payload"`
 	CapturedAt     *time.Time         `json:"captured_at" bson:"CapturedAt"`
 	CapturedAtNano int64              `bson:"CapturedAtNano"`
+	// Session is the ID of the experiment session the packet was captured
+	// in, empty when captured outside of any session
+	Session string `json:"session,omitempty" bson:"Session,omitempty"`
 }
 
 // GetType returns a string representing it packet's type
@@ -31,3 +35,24 @@ func (p *Packet) GetType() string {
 		return "Unrecognized"
 	}
 }
+
+// ErrEmptyPayload is returned by Validate when the packet carries no payload
+// UID, such packets are ignored instead of being stored.
+var ErrEmptyPayload = errors.New("empty payload")
+
+// Validate checks that the packet holds the data required to build a flow tree
+func (p *Packet) Validate() error {
+	if p.Payload == "" {
+		return ErrEmptyPayload
+	}
+	if p.Device == "" {
+		return errors.New("missing device")
+	}
+	if p.CapturedAt == nil || p.CapturedAt.IsZero() {
+		return errors.New("missing captured_at")
+	}
+	if p.Type != 0 && p.Type != 1 {
+		return errors.New("unrecognized type")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package packets
+
+// Observer is notified of the packets stored through an observed
+// Repository
+type Observer interface {
+	Observe(p Packet)
+}
+
+// ObserverFunc is a function used as an Observer
+type ObserverFunc func(p Packet)
+
+// Observe calls f(p)
+func (f ObserverFunc) Observe(p Packet) {
+	f(p)
+}
+
+type observed struct {
+	Repository
+	observers []Observer
+}
+
+// NewObservedRepository returns a Repository notifying the given observers
+// of every packet successfully stored in r
+func NewObservedRepository(r Repository, observers ...Observer) Repository {
+	return &observed{r, observers}
+}
+
+func (r *observed) Store(p Packet) error {
+	if err := r.Repository.Store(p); err != nil {
+		return err
+	}
+	r.notify(p)
+	return nil
+}
+
+func (r *observed) StoreAll(ps []Packet) error {
+	err := r.Repository.StoreAll(ps)
+	be, partial := err.(*BatchError)
+	if err != nil && !partial {
+		return err
+	}
+	for i, p := range ps {
+		if !partial || be.Failed[i] == nil {
+			r.notify(p)
+		}
+	}
+	return err
+}
+
+func (r *observed) notify(p Packet) {
+	if p.CapturedAt != nil && p.CapturedAtNano == 0 {
+		p.CapturedAtNano = p.CapturedAt.UnixNano()
+	}
+	for _, o := range r.observers {
+		o.Observe(p)
+	}
+}
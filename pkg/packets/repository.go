@@ -2,7 +2,9 @@ package packets
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -17,26 +19,68 @@ type Repository interface {
 	FindAll() ([]Packet, error)
 	// Store stores a new packet
 	Store(p Packet) error
+	// StoreAll stores a set of packets using a single bulk write, when only
+	// some of them could not be stored it returns a *BatchError
+	StoreAll(ps []Packet) error
+	// FindByPayload returns the packets with the given payload UID sorted
+	// by their capture time
+	FindByPayload(payload string) ([]Packet, error)
+	// FindInRange returns the packets captured in [from, to) sorted by
+	// their capture time, a zero time leaves that end of the range open
+	FindInRange(from, to time.Time) ([]Packet, error)
+	// FindBySession returns the packets of the given session sorted by
+	// their capture time, an empty session matches no packet
+	FindBySession(session string) ([]Packet, error)
+	// DeleteBySession deletes the packets of the given session and returns
+	// the number of packets deleted, an empty session matches no packet
+	DeleteBySession(session string) (int64, error)
+}
+
+// BatchError is returned by StoreAll when some of the packets were stored
+// and the others were not, Failed holds the error of every packet not
+// stored by its index
+type BatchError struct {
+	Failed map[int]error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d packets not stored", len(e.Failed))
 }
 
 type repo struct {
-	client *mongo.Client
+	db *mongo.Database
 }
 
-// NewRepository returns a new mongo Repository
-func NewRepository(c *mongo.Client) Repository {
-	return &repo{c}
+// NewRepository returns a new mongo Repository storing into the given database
+func NewRepository(db *mongo.Database) Repository {
+	r := &repo{db}
+	r.ensureIndexes()
+	return r
+}
+
+func (r *repo) ensureIndexes() {
+	collection := r.db.Collection("packets")
+
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "Payload", Value: 1}, {Key: "CapturedAtNano", Value: 1}}},
+		{Keys: bson.D{{Key: "CapturedAtNano", Value: 1}}},
+		{Keys: bson.D{{Key: "Session", Value: 1}, {Key: "CapturedAtNano", Value: 1}}},
+	}
+	_, err := collection.Indexes().CreateMany(context.Background(), models)
+	if err != nil {
+		log.Printf("error creating packets indexes, %v", err)
+	}
 }
 
 func (r *repo) FindAll() ([]Packet, error) {
 
-	collection := r.client.Database("analyzer").Collection("packets")
+	collection := r.db.Collection("packets")
 
 	var packets []Packet
 
 	filter := bson.D{}
 
-	sort := bson.D{{"CreatedAt", 1}}
+	sort := bson.D{{Key: "CreatedAt", Value: 1}}
 
 	options := options.Find()
 	options.SetSort(sort)
@@ -64,12 +108,11 @@ func (r *repo) Store(p Packet) error {
 	if p.Payload == "" || len(p.Payload) == 0 {
 		return nil
 	}
-	p.CapturedAtNano = p.CapturedAt.UnixNano()
+	prepare(&p)
 	log.Printf("Received timestamp: %d, %d", p.CapturedAt.Unix(), p.CapturedAt.UnixNano())
 
-	collection := r.client.Database("analyzer").Collection("packets")
+	collection := r.db.Collection("packets")
 
-	p.ID = primitive.NewObjectID()
 	_, err := collection.InsertOne(context.Background(), p)
 
 	if err != nil {
@@ -78,3 +121,101 @@ func (r *repo) Store(p Packet) error {
 	}
 	return nil
 }
+
+func (r *repo) StoreAll(ps []Packet) error {
+
+	if len(ps) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(ps))
+	for _, p := range ps {
+		prepare(&p)
+		docs = append(docs, p)
+	}
+
+	collection := r.db.Collection("packets")
+
+	_, err := collection.InsertMany(context.Background(), docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		log.Printf("error storing %d packets, %v", len(docs), err)
+	}
+	// the writes are unordered, the packets not failing are stored
+	if bwe, ok := err.(mongo.BulkWriteException); ok && bwe.WriteConcernError == nil && len(bwe.WriteErrors) > 0 {
+		failed := make(map[int]error)
+		for _, we := range bwe.WriteErrors {
+			failed[we.Index] = we.WriteError
+		}
+		return &BatchError{failed}
+	}
+	return err
+}
+
+// prepare fills the fields derived at storage time
+func prepare(p *Packet) {
+	p.CapturedAtNano = p.CapturedAt.UnixNano()
+	p.ID = primitive.NewObjectID()
+}
+
+func (r *repo) FindByPayload(payload string) ([]Packet, error) {
+	return r.find(bson.D{{Key: "Payload", Value: payload}})
+}
+
+func (r *repo) FindInRange(from, to time.Time) ([]Packet, error) {
+	captured := bson.D{}
+	if !from.IsZero() {
+		captured = append(captured, bson.E{Key: "$gte", Value: from.UnixNano()})
+	}
+	if !to.IsZero() {
+		captured = append(captured, bson.E{Key: "$lt", Value: to.UnixNano()})
+	}
+
+	filter := bson.D{}
+	if len(captured) > 0 {
+		filter = append(filter, bson.E{Key: "CapturedAtNano", Value: captured})
+	}
+	return r.find(filter)
+}
+
+func (r *repo) FindBySession(session string) ([]Packet, error) {
+	return r.find(bson.D{{Key: "Session", Value: session}})
+}
+
+func (r *repo) DeleteBySession(session string) (int64, error) {
+	collection := r.db.Collection("packets")
+
+	res, err := collection.DeleteMany(context.Background(), bson.D{{Key: "Session", Value: session}})
+	if err != nil {
+		log.Printf("error deleting packets of session %s, %v", session, err)
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (r *repo) find(filter bson.D) ([]Packet, error) {
+	collection := r.db.Collection("packets")
+
+	options := options.Find()
+	options.SetSort(bson.D{{Key: "CapturedAtNano", Value: 1}})
+
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var packets []Packet
+	for cursor.Next(ctx) {
+		var p Packet
+		if err := cursor.Decode(&p); err != nil {
+			return nil, err
+		}
+		packets = append(packets, p)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Println("error getting data from cursor", err.Error())
+		return nil, err
+	}
+	return packets, nil
+}
@@ -0,0 +1,185 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+// Link types as defined by http://www.tcpdump.org/linktypes.html
+const (
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+)
+
+// EtherTypes
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+)
+
+// IP protocol numbers
+const (
+	protoTCP = 6
+	protoUDP = 17
+)
+
+// Packet types as stored in packets.Packet.Type
+const (
+	typeTCP = 0
+	typeUDP = 1
+)
+
+// uidRegexp matches the payload UID written by the traffic generators
+var uidRegexp = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// Decode extracts the 5-tuple, the L4 type and the payload UID from a
+// captured frame. It returns false if the frame is not a TCP or UDP packet
+// carrying a payload UID.
+func Decode(f Frame) (packets.Packet, bool) {
+	var p packets.Packet
+
+	l3, etherType, ok := network(f.LinkType, f.Data)
+	if !ok {
+		return p, false
+	}
+
+	var proto byte
+	var l4 []byte
+	switch etherType {
+	case etherTypeIPv4:
+		if len(l3) < 20 || l3[0]>>4 != 4 {
+			return p, false
+		}
+		ihl := int(l3[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(l3[2:4]))
+		if ihl < 20 || total < ihl || len(l3) < ihl {
+			return p, false
+		}
+		if total < len(l3) {
+			l3 = l3[:total] // strip the ethernet trailer
+		}
+		// only the first fragment holds the L4 header
+		if binary.BigEndian.Uint16(l3[6:8])&0x1fff != 0 {
+			return p, false
+		}
+		proto = l3[9]
+		p.SrcIP = net.IP(l3[12:16]).String()
+		p.DstIP = net.IP(l3[16:20]).String()
+		l4 = l3[ihl:]
+	case etherTypeIPv6:
+		if len(l3) < 40 || l3[0]>>4 != 6 {
+			return p, false
+		}
+		proto = l3[6]
+		p.SrcIP = net.IP(l3[8:24]).String()
+		p.DstIP = net.IP(l3[24:40]).String()
+		l4 = l3[40:]
+		if plen := int(binary.BigEndian.Uint16(l3[4:6])); plen < len(l4) {
+			l4 = l4[:plen]
+		}
+	default:
+		return p, false
+	}
+
+	var payload []byte
+	switch proto {
+	case protoTCP:
+		if len(l4) < 20 {
+			return p, false
+		}
+		offset := int(l4[12]>>4) * 4
+		if offset < 20 || offset > len(l4) {
+			return p, false
+		}
+		p.Type = typeTCP
+		payload = l4[offset:]
+	case protoUDP:
+		if len(l4) < 8 {
+			return p, false
+		}
+		p.Type = typeUDP
+		payload = l4[8:]
+	default:
+		return p, false
+	}
+	p.SrcPort = strconv.Itoa(int(binary.BigEndian.Uint16(l4[0:2])))
+	p.DstPort = strconv.Itoa(int(binary.BigEndian.Uint16(l4[2:4])))
+
+	uid := uidRegexp.Find(payload)
+	if uid == nil {
+		return p, false
+	}
+	p.Payload = string(uid)
+	p.Device = f.Device
+
+	ts := f.Timestamp
+	p.CapturedAt = &ts
+	p.CapturedAtNano = ts.UnixNano()
+
+	return p, true
+}
+
+// network strips the link layer header returning the network layer data
+// along with its EtherType.
+func network(linkType uint32, data []byte) ([]byte, uint16, bool) {
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, 0, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return nil, 0, false
+			}
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+		return data, etherType, true
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, 0, false
+		}
+		return data[16:], binary.BigEndian.Uint16(data[14:16]), true
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		if len(data) < 1 {
+			return nil, 0, false
+		}
+		switch data[0] >> 4 {
+		case 4:
+			return data, etherTypeIPv4, true
+		case 6:
+			return data, etherTypeIPv6, true
+		}
+	}
+	return nil, 0, false
+}
+
+// Read parses a pcap or pcapng stream returning the packets carrying a
+// payload UID. Frames without one are counted as skipped.
+func Read(r io.Reader, device string) ([]packets.Packet, int, error) {
+	var pks []packets.Packet
+	skipped := 0
+
+	err := ReadFrames(r, device, func(f Frame) error {
+		p, ok := Decode(f)
+		if !ok {
+			skipped++
+			return nil
+		}
+		pks = append(pks, p)
+		return nil
+	})
+	return pks, skipped, err
+}
@@ -0,0 +1,113 @@
+package pcap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+// maxUploadMemory is the amount of a multipart upload kept in memory,
+// the rest is stored in temporary files
+const maxUploadMemory = 32 << 20
+
+// Handler implements capture files import operations
+type Handler struct {
+	repo packets.Repository
+}
+
+// NewHandler returns a new pcap Handler
+func NewHandler(repo packets.Repository) *Handler {
+	return &Handler{repo}
+}
+
+// ImportResult holds the outcome of importing a single capture file
+type ImportResult struct {
+	File     string `json:"file"`
+	Device   string `json:"device"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Import imports the observations of a capture file into the repository
+func Import(repo packets.Repository, r io.Reader, file, device string) ImportResult {
+	if device == "" {
+		device = DeviceFromFilename(file)
+	}
+	result := ImportResult{File: file, Device: device}
+
+	pks, skipped, err := Read(r, device)
+	result.Skipped = skipped
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	err = repo.StoreAll(pks)
+	if be, ok := err.(*packets.BatchError); ok {
+		result.Error = err.Error()
+		result.Imported = len(pks) - len(be.Failed)
+		return result
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Imported = len(pks)
+
+	return result
+}
+
+// Import HTTP POST handler which imports pcap/pcapng capture files. Files
+// are sent either as multipart form files, the device is then taken from
+// each filename, or as the raw request body along with a `device` query
+// parameter.
+func (h *Handler) Import(response http.ResponseWriter, request *http.Request) {
+
+	var results []ImportResult
+
+	if err := request.ParseMultipartForm(maxUploadMemory); err == nil {
+		for _, files := range request.MultipartForm.File {
+			for _, fh := range files {
+				f, err := fh.Open()
+				if err != nil {
+					results = append(results, ImportResult{File: fh.Filename, Error: err.Error()})
+					continue
+				}
+				results = append(results, Import(h.repo, f, fh.Filename, request.FormValue("device")))
+				f.Close()
+			}
+		}
+	} else if err == http.ErrNotMultipart {
+		device := request.URL.Query().Get("device")
+		if device == "" {
+			writeErr(response, fmt.Errorf("missing device query parameter"))
+			return
+		}
+		results = append(results, Import(h.repo, request.Body, device, device))
+	} else {
+		writeErr(response, err)
+		return
+	}
+
+	for _, r := range results {
+		log.Printf("imported %d packets from %s (device %s), skipped %d, error: %q",
+			r.Imported, r.File, r.Device, r.Skipped, r.Error)
+	}
+
+	err := json.NewEncoder(response).Encode(results)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+func writeErr(response http.ResponseWriter, err error) {
+	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
+	log.Println("error ", msg)
+	response.WriteHeader(http.StatusInternalServerError)
+	response.Write([]byte(msg))
+}
@@ -0,0 +1,302 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Magic numbers identifying the supported capture formats
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	magicNG           = 0x0a0d0d0a
+	magicNGByteOrder  = 0x1a2b3c4d
+)
+
+// pcapng block types
+const (
+	blockSectionHeader  = 0x0a0d0d0a
+	blockInterface      = 0x00000001
+	blockPacketObsolete = 0x00000002
+	blockEnhancedPacket = 0x00000006
+)
+
+// pcapng interface description options
+const (
+	optEndOfOpt  = 0
+	optIfName    = 2
+	optIfTsResol = 9
+)
+
+// maxRecordLen bounds the size of a single record to protect against
+// corrupted files.
+const maxRecordLen = 16 * 1024 * 1024
+
+// Frame is a single captured frame along with the metadata stored by the
+// capture file.
+type Frame struct {
+	Device    string
+	LinkType  uint32
+	Timestamp time.Time
+	Data      []byte
+}
+
+// ErrUnknownFormat is returned when the input is neither a pcap nor a pcapng file
+var ErrUnknownFormat = errors.New("unknown capture file format")
+
+// DeviceFromFilename derives the capture device from a file name following
+// the `<node>-<iface>.pcap` convention, e.g. s1-eth1.pcap yields s1-eth1.
+func DeviceFromFilename(name string) string {
+	base := filepath.Base(name)
+	for {
+		ext := filepath.Ext(base)
+		switch strings.ToLower(ext) {
+		case ".pcap", ".pcapng", ".cap":
+			base = strings.TrimSuffix(base, ext)
+			continue
+		}
+		return base
+	}
+}
+
+// ReadFrames reads all the frames stored in a pcap or pcapng stream. The
+// given device is used for every frame unless a pcapng interface description
+// block names its interface.
+func ReadFrames(r io.Reader, device string, fn func(Frame) error) error {
+	br := bufio.NewReader(r)
+
+	head, err := br.Peek(4)
+	if err != nil {
+		return ErrUnknownFormat
+	}
+
+	switch {
+	case binary.BigEndian.Uint32(head) == magicNG:
+		return readNG(br, device, fn)
+	case isPcapMagic(binary.LittleEndian.Uint32(head)), isPcapMagic(binary.BigEndian.Uint32(head)):
+		return readPcap(br, device, fn)
+	}
+	return ErrUnknownFormat
+}
+
+func isPcapMagic(m uint32) bool {
+	return m == magicMicroseconds || m == magicNanoseconds
+}
+
+func readPcap(r io.Reader, device string, fn func(Frame) error) error {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("error reading pcap header, %v", err)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(hdr[0:4])
+	if !isPcapMagic(magic) {
+		order = binary.BigEndian
+		magic = order.Uint32(hdr[0:4])
+	}
+	nanos := magic == magicNanoseconds
+	linkType := order.Uint32(hdr[20:24])
+
+	var rec [16]byte
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error reading pcap record header, %v", err)
+		}
+
+		sec := int64(order.Uint32(rec[0:4]))
+		frac := int64(order.Uint32(rec[4:8]))
+		capLen := order.Uint32(rec[8:12])
+		if capLen > maxRecordLen {
+			return fmt.Errorf("pcap record too large, %d bytes", capLen)
+		}
+
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("error reading pcap record, %v", err)
+		}
+
+		if !nanos {
+			frac *= 1000
+		}
+		f := Frame{
+			Device:    device,
+			LinkType:  linkType,
+			Timestamp: time.Unix(sec, frac).UTC(),
+			Data:      data,
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+type ngInterface struct {
+	name     string
+	linkType uint32
+	// tsUnit is the duration of a single timestamp unit in nanoseconds
+	tsUnit float64
+}
+
+func readNG(r io.Reader, device string, fn func(Frame) error) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var ifaces []ngInterface
+
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error reading pcapng block header, %v", err)
+		}
+
+		blockType := order.Uint32(hdr[0:4])
+
+		if binary.BigEndian.Uint32(hdr[0:4]) == blockSectionHeader {
+			// the byte order of the section is given by the byte-order magic
+			var bom [4]byte
+			if _, err := io.ReadFull(r, bom[:]); err != nil {
+				return fmt.Errorf("error reading pcapng section header, %v", err)
+			}
+			if binary.LittleEndian.Uint32(bom[:]) == magicNGByteOrder {
+				order = binary.LittleEndian
+			} else if binary.BigEndian.Uint32(bom[:]) == magicNGByteOrder {
+				order = binary.BigEndian
+			} else {
+				return errors.New("invalid pcapng byte-order magic")
+			}
+			total := order.Uint32(hdr[4:8])
+			if total < 16 || total > maxRecordLen {
+				return fmt.Errorf("invalid pcapng section header length %d", total)
+			}
+			if _, err := io.CopyN(ioutil.Discard, r, int64(total-12)); err != nil {
+				return fmt.Errorf("error reading pcapng section header, %v", err)
+			}
+			ifaces = ifaces[:0]
+			continue
+		}
+
+		total := order.Uint32(hdr[4:8])
+		if total < 12 || total > maxRecordLen || total%4 != 0 {
+			return fmt.Errorf("invalid pcapng block length %d", total)
+		}
+
+		body := make([]byte, total-8)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("error reading pcapng block, %v", err)
+		}
+		body = body[:len(body)-4] // trailing block length
+
+		switch blockType {
+		case blockInterface:
+			if len(body) < 8 {
+				return errors.New("short pcapng interface description block")
+			}
+			iface := ngInterface{
+				name:     device,
+				linkType: uint32(order.Uint16(body[0:2])),
+				tsUnit:   1000, // microseconds by default
+			}
+			parseNGOptions(order, body[8:], func(code uint16, value []byte) {
+				switch code {
+				case optIfName:
+					if name := strings.TrimRight(string(value), "\x00"); name != "" {
+						iface.name = name
+					}
+				case optIfTsResol:
+					if len(value) > 0 {
+						iface.tsUnit = tsUnit(value[0])
+					}
+				}
+			})
+			ifaces = append(ifaces, iface)
+
+		case blockEnhancedPacket, blockPacketObsolete:
+			if len(body) < 20 {
+				return errors.New("short pcapng packet block")
+			}
+			// both blocks share the layout but the obsolete one stores the
+			// interface id in 16 bits followed by a drops counter
+			ifaceID := order.Uint32(body[0:4])
+			if blockType == blockPacketObsolete {
+				ifaceID = uint32(order.Uint16(body[0:2]))
+			}
+			tsHigh := order.Uint32(body[4:8])
+			tsLow := order.Uint32(body[8:12])
+			capLen := order.Uint32(body[12:16])
+			data := body[20:]
+			if int(capLen) > len(data) {
+				return fmt.Errorf("invalid pcapng packet length %d", capLen)
+			}
+			if int(ifaceID) >= len(ifaces) {
+				return fmt.Errorf("pcapng packet references unknown interface %d", ifaceID)
+			}
+			iface := ifaces[ifaceID]
+
+			ts := uint64(tsHigh)<<32 | uint64(tsLow)
+			f := Frame{
+				Device:    iface.name,
+				LinkType:  iface.linkType,
+				Timestamp: ngTimestamp(ts, iface.tsUnit),
+				Data:      data[:capLen],
+			}
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func parseNGOptions(order binary.ByteOrder, b []byte, fn func(code uint16, value []byte)) {
+	for len(b) >= 4 {
+		code := order.Uint16(b[0:2])
+		length := int(order.Uint16(b[2:4]))
+		if code == optEndOfOpt {
+			return
+		}
+		b = b[4:]
+		if length > len(b) {
+			return
+		}
+		fn(code, b[:length])
+		padded := (length + 3) &^ 3
+		if padded > len(b) {
+			return
+		}
+		b = b[padded:]
+	}
+}
+
+// tsUnit returns the duration in nanoseconds of a timestamp unit given the
+// if_tsresol option value.
+func tsUnit(resol byte) float64 {
+	exp := float64(resol & 0x7f)
+	if resol&0x80 != 0 {
+		return 1e9 / math.Pow(2, exp)
+	}
+	return 1e9 / math.Pow(10, exp)
+}
+
+func ngTimestamp(ts uint64, unit float64) time.Time {
+	if unit == 1000 {
+		return time.Unix(int64(ts/1e6), int64(ts%1e6)*1000).UTC()
+	}
+	if unit == 1 {
+		return time.Unix(int64(ts/1e9), int64(ts%1e9)).UTC()
+	}
+	ns := float64(ts) * unit
+	sec := int64(ns / 1e9)
+	return time.Unix(sec, int64(ns-float64(sec)*1e9)).UTC()
+}
@@ -0,0 +1,142 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+const uid = "2624c054-d068-4513-6631-71d824b428b4"
+
+// udpFrame builds an ethernet/IPv4/UDP frame carrying the given payload
+func udpFrame(payload string) []byte {
+	var b bytes.Buffer
+	b.Write(make([]byte, 12)) // dst and src MAC
+	binary.Write(&b, binary.BigEndian, uint16(etherTypeIPv4))
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+8+len(payload)))
+	ip[9] = protoUDP
+	copy(ip[12:16], []byte{10, 0, 0, 1})
+	copy(ip[16:20], []byte{10, 0, 0, 2})
+	b.Write(ip)
+
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[0:2], 6666)
+	binary.BigEndian.PutUint16(udp[2:4], 80)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	b.Write(udp)
+	b.WriteString(payload)
+	return b.Bytes()
+}
+
+func TestReadPcap(t *testing.T) {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&b, le, uint32(magicMicroseconds))
+	binary.Write(&b, le, uint16(2))
+	binary.Write(&b, le, uint16(4))
+	binary.Write(&b, le, int32(0))
+	binary.Write(&b, le, uint32(0))
+	binary.Write(&b, le, uint32(65535))
+	binary.Write(&b, le, uint32(linkTypeEthernet))
+
+	for i, payload := range []string{"id:" + uid, "no uid here"} {
+		frame := udpFrame(payload)
+		binary.Write(&b, le, uint32(1552758206))
+		binary.Write(&b, le, uint32(385000+i))
+		binary.Write(&b, le, uint32(len(frame)))
+		binary.Write(&b, le, uint32(len(frame)))
+		b.Write(frame)
+	}
+
+	pks, skipped, err := Read(&b, DeviceFromFilename("/tmp/s1-eth1.pcap"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(pks) != 1 || skipped != 1 {
+		t.Fatalf("expected 1 packet and 1 skipped, got %d and %d", len(pks), skipped)
+	}
+
+	p := pks[0]
+	if p.Device != "s1-eth1" || p.Payload != uid || p.GetType() != "UDP" ||
+		p.SrcIP != "10.0.0.1" || p.DstIP != "10.0.0.2" || p.SrcPort != "6666" || p.DstPort != "80" {
+		t.Errorf("unexpected packet %+v", p)
+	}
+	if !p.CapturedAt.Equal(time.Unix(1552758206, 385000000)) {
+		t.Errorf("unexpected timestamp %v", p.CapturedAt)
+	}
+}
+
+func TestReadPcapNG(t *testing.T) {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+
+	// section header block
+	binary.Write(&b, le, uint32(blockSectionHeader))
+	binary.Write(&b, le, uint32(28))
+	binary.Write(&b, le, uint32(magicNGByteOrder))
+	binary.Write(&b, le, uint16(1))
+	binary.Write(&b, le, uint16(0))
+	binary.Write(&b, le, int64(-1))
+	binary.Write(&b, le, uint32(28))
+
+	// interface description block with if_name and nanosecond resolution
+	name := "s2-eth3"
+	opts := new(bytes.Buffer)
+	binary.Write(opts, le, uint16(optIfName))
+	binary.Write(opts, le, uint16(len(name)))
+	opts.WriteString(name)
+	opts.Write(make([]byte, (4-len(name)%4)%4))
+	binary.Write(opts, le, uint16(optIfTsResol))
+	binary.Write(opts, le, uint16(1))
+	opts.Write([]byte{9, 0, 0, 0})
+	binary.Write(opts, le, uint32(0))
+
+	idbLen := uint32(20 + opts.Len())
+	binary.Write(&b, le, uint32(blockInterface))
+	binary.Write(&b, le, idbLen)
+	binary.Write(&b, le, uint16(linkTypeEthernet))
+	binary.Write(&b, le, uint16(0))
+	binary.Write(&b, le, uint32(0))
+	b.Write(opts.Bytes())
+	binary.Write(&b, le, idbLen)
+
+	// enhanced packet block
+	frame := udpFrame(uid)
+	pad := (4 - len(frame)%4) % 4
+	epbLen := uint32(32 + len(frame) + pad)
+	ts := uint64(1552758206385000001)
+	binary.Write(&b, le, uint32(blockEnhancedPacket))
+	binary.Write(&b, le, epbLen)
+	binary.Write(&b, le, uint32(0))
+	binary.Write(&b, le, uint32(ts>>32))
+	binary.Write(&b, le, uint32(ts))
+	binary.Write(&b, le, uint32(len(frame)))
+	binary.Write(&b, le, uint32(len(frame)))
+	b.Write(frame)
+	b.Write(make([]byte, pad))
+	binary.Write(&b, le, epbLen)
+
+	pks, _, err := Read(&b, "capture")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(pks) != 1 {
+		t.Fatalf("expected 1 packet, got %d", len(pks))
+	}
+	if pks[0].Device != name {
+		t.Errorf("expected device %s, got %s", name, pks[0].Device)
+	}
+	if pks[0].CapturedAtNano != int64(ts) {
+		t.Errorf("expected timestamp %d, got %d", ts, pks[0].CapturedAtNano)
+	}
+}
+
+func TestReadUnknownFormat(t *testing.T) {
+	if _, _, err := Read(bytes.NewBufferString("not a capture"), "s1-eth1"); err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
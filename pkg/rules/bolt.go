@@ -0,0 +1,59 @@
+package rules
+
+import (
+	"github.com/letitbeat/dp-analyzer/pkg/db/bolt"
+	bbolt "go.etcd.io/bbolt"
+)
+
+const rulesBucket = "rules"
+
+type boltRepo struct {
+	db *bbolt.DB
+}
+
+// NewBoltRepository returns a new Repository backed by an embedded BoltDB
+func NewBoltRepository(db *bbolt.DB) Repository {
+	return &boltRepo{db}
+}
+
+func (r *boltRepo) Store(t Table) error {
+	return bolt.Put(r.db, rulesBucket, t.Switch, t)
+}
+
+func (r *boltRepo) FindBySwitch(sw string) (*Table, error) {
+	var t Table
+	found, err := bolt.Get(r.db, rulesBucket, sw, &t)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (r *boltRepo) FindAll() ([]Table, error) {
+	var tables []Table
+
+	err := bolt.ForEach(r.db, rulesBucket, func(_ string, decode func(interface{}) error) error {
+		var t Table
+		if err := decode(&t); err != nil {
+			return err
+		}
+		tables = append(tables, t)
+		return nil
+	})
+	sortTables(tables)
+	return tables, err
+}
+
+func (r *boltRepo) Delete(sw string) error {
+	if _, err := r.FindBySwitch(sw); err != nil {
+		return err
+	}
+	return bolt.Delete(r.db, rulesBucket, sw)
+}
+
+func (r *boltRepo) Count() (int64, error) {
+	return bolt.Count(r.db, rulesBucket)
+}
@@ -0,0 +1,195 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+)
+
+// Handler implements forwarding tables operations
+type Handler struct {
+	repo     Repository
+	topoRepo topology.Repository
+	treeRepo tree.Repository
+}
+
+// NewHandler returns a new forwarding tables Handler
+func NewHandler(repo Repository, topoRepo topology.Repository, treeRepo tree.Repository) *Handler {
+	return &Handler{repo, topoRepo, treeRepo}
+}
+
+// GetAll HTTP GET handler which returns every forwarding table
+func (h *Handler) GetAll(response http.ResponseWriter, request *http.Request) {
+
+	tables, err := h.repo.FindAll()
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	if tables == nil {
+		tables = []Table{}
+	}
+
+	err = json.NewEncoder(response).Encode(tables)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Get HTTP GET handler which returns the forwarding table of a switch
+func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
+
+	t, err := h.repo.FindBySwitch(mux.Vars(request)["switch"])
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(t)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Set HTTP PUT handler which replaces the forwarding table of a switch
+func (h *Handler) Set(response http.ResponseWriter, request *http.Request) {
+
+	var t Table
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	if err := json.Unmarshal(body, &t); err != nil {
+		writeStatus(response, http.StatusBadRequest, err)
+		return
+	}
+
+	t.Switch = mux.Vars(request)["switch"]
+	if err := t.Validate(); err != nil {
+		writeStatus(response, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.repo.Store(t); err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(t)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Delete HTTP DELETE handler which deletes the forwarding table of a switch
+func (h *Handler) Delete(response http.ResponseWriter, request *http.Request) {
+
+	err := h.repo.Delete(mux.Vars(request)["switch"])
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// PredictResult is the predicted flow tree of a packet and, when the
+// packet carries the payload UID of a stored flow tree, its comparison
+// with the observed one
+type PredictResult struct {
+	*Prediction
+	Comparison *Comparison `json:"comparison,omitempty"`
+}
+
+// Predict HTTP POST handler which predicts the flow tree of the packet
+// header in the request body, against the topology version active at its
+// capture time
+func (h *Handler) Predict(response http.ResponseWriter, request *http.Request) {
+
+	var p packets.Packet
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		writeStatus(response, http.StatusBadRequest, err)
+		return
+	}
+
+	// the packet is predicted against the topology active when it was
+	// captured, or the latest one
+	at := time.Now()
+	if p.CapturedAt != nil {
+		at = *p.CapturedAt
+	}
+	topo, err := h.topoRepo.FindAt(at)
+	if err == topology.ErrNotFound {
+		writeErr(response, errors.New("no topology has been set"))
+		return
+	}
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	tables, err := h.repo.FindAll()
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	prediction, err := Predict(*topo, tables, p)
+	if err != nil {
+		writeStatus(response, http.StatusBadRequest, err)
+		return
+	}
+	result := PredictResult{Prediction: prediction}
+
+	if p.Payload != "" {
+		observed, err := h.treeRepo.FindByID(p.Payload)
+		if err == tree.ErrNotFound {
+			writeStatus(response, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeErr(response, err)
+			return
+		}
+		c := Compare(prediction.Tree, *observed)
+		result.Comparison = &c
+	}
+
+	err = json.NewEncoder(response).Encode(result)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+func writeErr(response http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == ErrNotFound {
+		status = http.StatusNotFound
+	}
+	writeStatus(response, status, err)
+}
+
+func writeStatus(response http.ResponseWriter, status int, err error) {
+	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
+	log.Println("error ", msg)
+	response.WriteHeader(status)
+	response.Write([]byte(msg))
+}
@@ -0,0 +1,83 @@
+package rules
+
+import (
+	"log"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type memoryRepo struct {
+	lock   sync.RWMutex
+	tables map[string]Table
+}
+
+// NewMemoryRepository returns a new thread-safe in-memory Repository
+func NewMemoryRepository() Repository {
+	return &memoryRepo{tables: make(map[string]Table)}
+}
+
+func (r *memoryRepo) Store(t Table) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.tables[t.Switch] = clone(t)
+	return nil
+}
+
+func (r *memoryRepo) FindBySwitch(sw string) (*Table, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	t, ok := r.tables[sw]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	t = clone(t)
+	return &t, nil
+}
+
+func (r *memoryRepo) FindAll() ([]Table, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var tables []Table
+	for _, t := range r.tables {
+		tables = append(tables, clone(t))
+	}
+	sortTables(tables)
+	return tables, nil
+}
+
+func (r *memoryRepo) Delete(sw string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.tables[sw]; !ok {
+		return ErrNotFound
+	}
+	delete(r.tables, sw)
+	return nil
+}
+
+func (r *memoryRepo) Count() (int64, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return int64(len(r.tables)), nil
+}
+
+// clone returns a deep copy of t
+func clone(t Table) Table {
+	b, err := bson.Marshal(t)
+	if err != nil {
+		log.Printf("error copying forwarding table %s, %v", t.Switch, err)
+		return t
+	}
+	var c Table
+	if err := bson.Unmarshal(b, &c); err != nil {
+		log.Printf("error copying forwarding table %s, %v", t.Switch, err)
+		return t
+	}
+	return c
+}
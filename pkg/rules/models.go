@@ -0,0 +1,163 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+// Table is the forwarding table installed in a switch
+type Table struct {
+	Switch string  `json:"switch" bson:"_id"`
+	Rules  []Rule  `json:"rules" bson:"rules"`
+	Groups []Group `json:"groups,omitempty" bson:"groups,omitempty"`
+}
+
+// Rule forwards the packets matching it, the matching rule with the
+// highest priority applies
+type Rule struct {
+	Priority int   `json:"priority" bson:"priority"`
+	Match    Match `json:"match" bson:"match"`
+	// Output are the ports the packets are sent to, either the interface,
+	// e.g. s1-eth2, its name without the switch, eth2, its number, 2, or
+	// flood to send them to every port but the ingress one
+	Output []string `json:"output,omitempty" bson:"output,omitempty"`
+	// Group is the ID of the multicast group the packets are sent to
+	Group string `json:"group,omitempty" bson:"group,omitempty"`
+	// Drop drops the packets
+	Drop bool `json:"drop,omitempty" bson:"drop,omitempty"`
+}
+
+// Match holds the header fields a rule matches, empty fields match any
+// packet
+type Match struct {
+	InPort string `json:"in_port,omitempty" bson:"in_port,omitempty"`
+	// Type is either TCP or UDP
+	Type string `json:"type,omitempty" bson:"type,omitempty"`
+	// SrcIP and DstIP are either addresses or CIDR blocks
+	SrcIP   string `json:"src_ip,omitempty" bson:"src_ip,omitempty"`
+	DstIP   string `json:"dst_ip,omitempty" bson:"dst_ip,omitempty"`
+	SrcPort string `json:"src_port,omitempty" bson:"src_port,omitempty"`
+	DstPort string `json:"dst_port,omitempty" bson:"dst_port,omitempty"`
+}
+
+// Group is a multicast group sending the packets to every one of its
+// ports
+type Group struct {
+	ID    string   `json:"id" bson:"id"`
+	Ports []string `json:"ports" bson:"ports"`
+}
+
+// flood is the output port sending packets to every port but the ingress
+// one
+const flood = "flood"
+
+// Validate checks the table rules are well formed and only refer to its
+// groups
+func (t *Table) Validate() error {
+	if t.Switch == "" {
+		return errors.New("missing switch")
+	}
+
+	groups := make(map[string]bool)
+	for _, g := range t.Groups {
+		if g.ID == "" {
+			return errors.New("group without id")
+		}
+		groups[g.ID] = true
+	}
+
+	for i, r := range t.Rules {
+		if !r.Drop && len(r.Output) == 0 && r.Group == "" {
+			return fmt.Errorf("rule %d has no action", i)
+		}
+		if r.Drop && (len(r.Output) > 0 || r.Group != "") {
+			return fmt.Errorf("rule %d both drops and forwards", i)
+		}
+		if r.Group != "" && !groups[r.Group] {
+			return fmt.Errorf("rule %d refers to the unknown group %s", i, r.Group)
+		}
+		for _, ip := range []string{r.Match.SrcIP, r.Match.DstIP} {
+			if ip != "" && !validIP(ip) {
+				return fmt.Errorf("rule %d has an invalid address %s", i, ip)
+			}
+		}
+		if typ := r.Match.Type; typ != "" && !strings.EqualFold(typ, "TCP") && !strings.EqualFold(typ, "UDP") {
+			return fmt.Errorf("rule %d has an invalid type %s", i, typ)
+		}
+	}
+	return nil
+}
+
+// lookup returns the rule applying to the packet entering the switch at
+// inPort, nil on a table miss
+func (t *Table) lookup(p packets.Packet, inPort string) *Rule {
+	var best *Rule
+	for i := range t.Rules {
+		r := &t.Rules[i]
+		if (best == nil || r.Priority > best.Priority) && r.Match.matches(t.Switch, p, inPort) {
+			best = r
+		}
+	}
+	return best
+}
+
+// ports returns the interfaces the rule sends the packets to
+func (t *Table) ports(r *Rule) []string {
+	ports := append([]string(nil), r.Output...)
+	for _, g := range t.Groups {
+		if g.ID == r.Group {
+			ports = append(ports, g.Ports...)
+		}
+	}
+	for i, p := range ports {
+		ports[i] = portName(t.Switch, p)
+	}
+	return ports
+}
+
+func (m Match) matches(sw string, p packets.Packet, inPort string) bool {
+	return (m.InPort == "" || portName(sw, m.InPort) == inPort) &&
+		(m.Type == "" || strings.EqualFold(m.Type, p.GetType())) &&
+		matchIP(m.SrcIP, p.SrcIP) && matchIP(m.DstIP, p.DstIP) &&
+		matchPort(m.SrcPort, p.SrcPort) && matchPort(m.DstPort, p.DstPort)
+}
+
+func validIP(s string) bool {
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	return net.ParseIP(s) != nil
+}
+
+func matchIP(want, ip string) bool {
+	if want == "" {
+		return true
+	}
+	if _, block, err := net.ParseCIDR(want); err == nil {
+		addr := net.ParseIP(ip)
+		return addr != nil && block.Contains(addr)
+	}
+	return want == ip
+}
+
+// matchPort matches a port with or without its service name, e.g. 66
+// matches 66(sql-net)
+func matchPort(want, port string) bool {
+	return want == "" || port == want || strings.SplitN(port, "(", 2)[0] == want
+}
+
+// portName returns the interface of the switch port, ports are given as
+// s1-eth2, eth2 or 2
+func portName(sw, port string) string {
+	if port == flood || strings.HasPrefix(port, sw+"-") {
+		return port
+	}
+	if strings.Trim(port, "0123456789") == "" {
+		return fmt.Sprintf("%s-eth%s", sw, port)
+	}
+	return fmt.Sprintf("%s-%s", sw, port)
+}
@@ -0,0 +1,247 @@
+package rules
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/letitbeat/dp-analyzer/pkg/dot"
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+)
+
+// maxHops bounds the predicted paths, the paths are also cut when the
+// packet enters a switch already on them, see Loop
+const maxHops = 64
+
+// maxNodes bounds the predicted tree, flooding over a meshed topology
+// yields a number of paths growing exponentially with its switches
+const maxNodes = 4096
+
+// Prediction is the flow tree a packet is expected to follow according to
+// the forwarding tables
+type Prediction struct {
+	Tree *tree.Tree `json:"-"`
+	// Nodes is the DOT representation of the tree
+	Nodes        string        `json:"nodes"`
+	NodesImg     string        `json:"nodes_img"`
+	NodesImgType string        `json:"nodes_img_type"`
+	Edges        [][]tree.Edge `json:"edges"`
+	// Drops are the switches where the packet is dropped
+	Drops []Drop `json:"drops,omitempty"`
+	// Loops are the switches the packet enters again on a path, it is
+	// forwarded the same way as before from there on
+	Loops []Loop `json:"loops,omitempty"`
+	// Truncated is set when the tree reached maxNodes nodes before every
+	// path was followed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Drop is a switch dropping the packet, either by a rule or on a table
+// miss
+type Drop struct {
+	Switch string `json:"switch"`
+	InPort string `json:"in_port"`
+	Miss   bool   `json:"miss,omitempty"`
+}
+
+// Loop is a switch the packet enters again on a path, at InPort, the path
+// is not followed further
+type Loop struct {
+	Switch string `json:"switch"`
+	InPort string `json:"in_port"`
+}
+
+// predictor walks the forwarding tables over the topology links
+type predictor struct {
+	index  *topology.Index
+	tables map[string]*Table
+	p      packets.Packet
+	tree   *tree.Tree
+	names  map[string]int
+	drops  []Drop
+	loops  []Loop
+	// path holds the switches the packet entered on the path being
+	// followed
+	path      map[string]bool
+	nodes     int
+	truncated bool
+}
+
+// Predict returns the flow tree of the packet according to the forwarding
+// tables. The packet enters the network from the host of its source IP,
+// or from the node connected to its device when the address is unknown.
+func Predict(topo topology.Topology, tables []Table, p packets.Packet) (*Prediction, error) {
+	index := topo.Index()
+	src, ok := index.HostByIP(p.SrcIP)
+	if !ok {
+		var e topology.Endpoint
+		e, ok = index.Peer(p.Device)
+		src = e.Node
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown source host of %s", p.SrcIP)
+	}
+
+	pr := &predictor{index: index, tables: make(map[string]*Table), p: p, names: make(map[string]int), path: make(map[string]bool)}
+	for i := range tables {
+		pr.tables[tables[i].Switch] = &tables[i]
+	}
+
+	root := tree.NewNode(src, src)
+	pr.tree = tree.NewTree(root)
+	pr.names[src]++
+	pr.nodes++
+	for _, n := range index.Neighbors(src) {
+		if in := index.PortTo(n, src); in != "" {
+			pr.forward(root, n, in, 1)
+		}
+	}
+
+	label := fmt.Sprintf("%s %s predicted", p.GetType(), p.DstPort)
+	dotStr := pr.tree.ToDOT(src, label)
+	img, mime, err := dot.Generate(dotStr)
+	if err != nil {
+		log.Printf("error generating predicted tree, %s", err.Error())
+	}
+
+	return &Prediction{
+		Tree:         pr.tree,
+		Nodes:        dotStr,
+		NodesImg:     img,
+		NodesImgType: mime,
+		Edges:        pr.tree.Edges(),
+		Drops:        pr.drops,
+		Loops:        pr.loops,
+		Truncated:    pr.truncated,
+	}, nil
+}
+
+// forward adds the switch the packet enters at inPort to the tree and
+// follows the ports its table sends the packet to, unless the packet
+// already entered it on the same path
+func (pr *predictor) forward(parent *tree.Node, sw, inPort string, hops int) {
+	n := pr.add(parent, sw)
+	if hops == maxHops {
+		return
+	}
+	if pr.path[sw] {
+		pr.loops = append(pr.loops, Loop{Switch: sw, InPort: inPort})
+		return
+	}
+	if pr.nodes >= maxNodes {
+		pr.truncated = true
+		return
+	}
+	pr.path[sw] = true
+	defer delete(pr.path, sw)
+
+	t, ok := pr.tables[sw]
+	var r *Rule
+	if ok {
+		r = t.lookup(pr.p, inPort)
+	}
+	if r == nil || r.Drop {
+		pr.drops = append(pr.drops, Drop{Switch: sw, InPort: inPort, Miss: r == nil})
+		return
+	}
+
+	var out []string
+	for _, port := range t.ports(r) {
+		if port == flood {
+			out = append(out, pr.index.Ports(sw)...)
+		} else {
+			out = append(out, port)
+		}
+	}
+
+	sent := make(map[string]bool)
+	for _, port := range out {
+		if port == inPort || sent[port] {
+			continue
+		}
+		sent[port] = true
+
+		next, ok := pr.index.Peer(port)
+		if !ok {
+			log.Printf("port %s of %s is not linked", port, sw)
+			continue
+		}
+		if node, _ := pr.index.Node(next.Node); node != nil && node.Kind != topology.Host && next.Port != "" {
+			pr.forward(n, next.Node, next.Port, hops+1)
+		} else {
+			pr.add(n, next.Node)
+		}
+	}
+}
+
+// add adds a node for the device as a child of parent, devices showing up
+// more than once are named like the observed trees, e.g. s1_1
+func (pr *predictor) add(parent *tree.Node, device string) *tree.Node {
+	name := device
+	if i := pr.names[device]; i > 0 {
+		name = fmt.Sprintf("%s_%d", device, i-1)
+	}
+	pr.names[device]++
+	pr.nodes++
+
+	n := tree.NewNode(name, device)
+	parent.AddChild(n)
+	pr.tree.AddNode(n)
+	return n
+}
+
+// Comparison is the difference between a predicted and an observed flow
+// tree, edges are compared by node label
+type Comparison struct {
+	Matches bool `json:"matches"`
+	// Missing are the predicted edges not observed
+	Missing []tree.Edge `json:"missing,omitempty"`
+	// Unexpected are the observed edges not predicted
+	Unexpected []tree.Edge `json:"unexpected,omitempty"`
+}
+
+// Compare compares the predicted tree with an observed one
+func Compare(predicted *tree.Tree, observed tree.FlowTree) Comparison {
+	want := edgeSet(predicted.Edges())
+	got := edgeSet(observed.Edges)
+
+	c := Comparison{}
+	for _, e := range sortedEdges(want) {
+		if !got[e] {
+			c.Missing = append(c.Missing, e)
+		}
+	}
+	for _, e := range sortedEdges(got) {
+		if !want[e] {
+			c.Unexpected = append(c.Unexpected, e)
+		}
+	}
+	c.Matches = len(c.Missing) == 0 && len(c.Unexpected) == 0
+	return c
+}
+
+func edgeSet(paths [][]tree.Edge) map[tree.Edge]bool {
+	set := make(map[tree.Edge]bool)
+	for _, path := range paths {
+		for _, e := range path {
+			set[e] = true
+		}
+	}
+	return set
+}
+
+func sortedEdges(set map[tree.Edge]bool) []tree.Edge {
+	var edges []tree.Edge
+	for e := range set {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Src != edges[j].Src {
+			return edges[i].Src < edges[j].Src
+		}
+		return edges[i].Dst < edges[j].Dst
+	})
+	return edges
+}
@@ -0,0 +1,186 @@
+package rules
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+)
+
+var topo = topology.Legacy{
+	Links: []string{
+		"h1:s1-eth1", "s2:s1-eth2", "s3:s1-eth3",
+		"s1:s2-eth1", "h2:s2-eth2",
+		"s1:s3-eth1", "h3:s3-eth2",
+	},
+	Addresses: map[string]string{"h1": "10.0.0.1", "h2": "10.0.0.2", "h3": "10.0.0.3"},
+}.Topology()
+
+var tables = []Table{
+	{
+		Switch: "s1",
+		Rules: []Rule{
+			{Priority: 1, Drop: true},
+			{Priority: 10, Match: Match{DstIP: "10.0.0.2"}, Output: []string{"2"}},
+			{Priority: 5, Match: Match{Type: "udp", DstPort: "80"}, Group: "g"},
+		},
+		Groups: []Group{{ID: "g", Ports: []string{"eth2", "s1-eth3"}}},
+	},
+	{
+		Switch: "s2",
+		Rules:  []Rule{{Match: Match{InPort: "1", DstIP: "10.0.0.0/24"}, Output: []string{flood}}},
+	},
+}
+
+func TestPredict(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     packets.Packet
+		edges string
+		drops string
+	}{
+		{
+			name:  "unicast",
+			p:     packets.Packet{Type: 0, SrcIP: "10.0.0.1", DstIP: "10.0.0.2", DstPort: "22"},
+			edges: "[[{h1 s1} {s1 s2} {s2 h2}]]",
+		},
+		{
+			name:  "multicast group and table miss",
+			p:     packets.Packet{Type: 1, SrcIP: "10.0.0.1", DstIP: "10.0.0.9", DstPort: "80(http)"},
+			edges: "[[{h1 s1} {s1 s2} {s2 h2}] [{h1 s1} {s1 s3}]]",
+			drops: "[{s3 s3-eth1 true}]",
+		},
+		{
+			name:  "drop rule",
+			p:     packets.Packet{Type: 0, SrcIP: "10.0.0.1", DstIP: "10.0.0.9", DstPort: "80"},
+			edges: "[[{h1 s1}]]",
+			drops: "[{s1 s1-eth1 false}]",
+		},
+		{
+			name:  "source from device",
+			p:     packets.Packet{Type: 0, Device: "s1-eth1", DstIP: "10.0.0.2"},
+			edges: "[[{h1 s1} {s1 s2} {s2 h2}]]",
+		},
+	}
+
+	for _, test := range tests {
+		pr, err := Predict(topo, tables, test.p)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if edges := fmt.Sprint(pr.Edges); edges != test.edges {
+			t.Errorf("%s: expected the edges %s, got %s", test.name, test.edges, edges)
+		}
+		drops := ""
+		if len(pr.Drops) > 0 {
+			drops = fmt.Sprint(pr.Drops)
+		}
+		if drops != test.drops {
+			t.Errorf("%s: expected the drops %s, got %s", test.name, test.drops, drops)
+		}
+	}
+
+	if _, err := Predict(topo, tables, packets.Packet{SrcIP: "10.0.0.9"}); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	pr, err := Predict(topo, tables, packets.Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	observed := tree.FlowTree{Edges: [][]tree.Edge{{{Src: "h1", Dst: "s1"}, {Src: "s1", Dst: "s3"}, {Src: "s3", Dst: "h3"}}}}
+	c := Compare(pr.Tree, observed)
+	if c.Matches || fmt.Sprint(c.Missing) != "[{s1 s2} {s2 h2}]" || fmt.Sprint(c.Unexpected) != "[{s1 s3} {s3 h3}]" {
+		t.Errorf("unexpected comparison %+v", c)
+	}
+
+	if c := Compare(pr.Tree, tree.FlowTree{Edges: pr.Edges}); !c.Matches {
+		t.Errorf("expected the prediction to match itself, got %+v", c)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, table := range tables {
+		if err := table.Validate(); err != nil {
+			t.Errorf("expected the table of %s to be valid, got %v", table.Switch, err)
+		}
+	}
+
+	invalid := []Table{
+		{},
+		{Switch: "s1", Rules: []Rule{{}}},
+		{Switch: "s1", Rules: []Rule{{Drop: true, Output: []string{"1"}}}},
+		{Switch: "s1", Rules: []Rule{{Group: "g"}}},
+		{Switch: "s1", Rules: []Rule{{Match: Match{DstIP: "10.0.0/24"}, Drop: true}}},
+		{Switch: "s1", Rules: []Rule{{Match: Match{Type: "ICMP"}, Drop: true}}},
+	}
+	for i, table := range invalid {
+		if err := table.Validate(); err == nil {
+			t.Errorf("expected table %d to be invalid", i)
+		}
+	}
+}
+
+// floodMesh returns a full mesh of n switches, each one flooding the
+// packets it receives, h1 is connected to s1 and h2 to sn
+func floodMesh(n int) (topology.Topology, []Table) {
+	var links []string
+	var tables []Table
+	for i := 1; i <= n; i++ {
+		port := 1
+		for j := 1; j <= n; j++ {
+			if i != j {
+				links = append(links, fmt.Sprintf("s%d:s%d-eth%d", j, i, port))
+				port++
+			}
+		}
+		tables = append(tables, Table{Switch: fmt.Sprintf("s%d", i), Rules: []Rule{{Output: []string{flood}}}})
+	}
+	links = append(links, fmt.Sprintf("h1:s1-eth%d", n), fmt.Sprintf("h2:s%d-eth%d", n, n))
+	return topology.Legacy{Links: links, Addresses: map[string]string{"h1": "10.0.0.1", "h2": "10.0.0.2"}}.Topology(), tables
+}
+
+func TestPredictFloodMesh(t *testing.T) {
+	topo, mesh := floodMesh(5)
+	start := time.Now()
+	pr, err := Predict(topo, mesh, packets.Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("expected the prediction over the mesh to be bounded, took %s", d)
+	}
+	if len(pr.Loops) == 0 || len(pr.Drops) != 0 || pr.Truncated {
+		t.Fatalf("expected the flooding loops to be reported, got %v loops, %v drops and truncated %v", pr.Loops, pr.Drops, pr.Truncated)
+	}
+	// the paths stop once the packet enters a switch already on them, the
+	// last switch being the only one repeated
+	for _, path := range pr.Edges {
+		seen := make(map[string]bool)
+		for i, e := range path {
+			if seen[e.Dst] && i != len(path)-1 {
+				t.Fatalf("expected the path to stop at its first loop, got %v", path)
+			}
+			seen[e.Dst] = true
+		}
+	}
+
+	// larger meshes are cut at maxNodes nodes
+	topo, mesh = floodMesh(10)
+	start = time.Now()
+	if pr, err = Predict(topo, mesh, packets.Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("expected the prediction over the mesh to be bounded, took %s", d)
+	}
+	if !pr.Truncated || len(pr.Edges) > maxNodes {
+		t.Fatalf("expected the prediction to be truncated, got %d paths", len(pr.Edges))
+	}
+}
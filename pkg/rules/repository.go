@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository defines the methods to be implemented by
+// the storage layer.
+type Repository interface {
+	// FindAll returns the forwarding tables sorted by switch
+	FindAll() ([]Table, error)
+	// FindBySwitch returns the forwarding table of the switch or ErrNotFound
+	FindBySwitch(sw string) (*Table, error)
+	// Store stores a forwarding table replacing the previous one of the
+	// same switch
+	Store(t Table) error
+	// Delete deletes the forwarding table of the switch, it returns
+	// ErrNotFound if it does not exist
+	Delete(sw string) error
+	// Count counts the forwarding tables stored
+	Count() (int64, error)
+}
+
+// ErrNotFound is returned when the requested forwarding table does not
+// exist
+var ErrNotFound = errors.New("forwarding table not found")
+
+func sortTables(tables []Table) {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Switch < tables[j].Switch })
+}
+
+type repo struct {
+	db *mongo.Database
+}
+
+// NewRepository returns a new mongo Repository storing into the given database
+func NewRepository(db *mongo.Database) Repository {
+	return &repo{db}
+}
+
+func (r *repo) Store(t Table) error {
+	collection := r.db.Collection("rules")
+
+	filter := bson.M{"_id": t.Switch}
+	_, err := collection.ReplaceOne(context.Background(), filter, t, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("error storing forwarding table, %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *repo) FindBySwitch(sw string) (*Table, error) {
+	collection := r.db.Collection("rules")
+
+	var t Table
+	err := collection.FindOne(context.Background(), bson.M{"_id": sw}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *repo) FindAll() ([]Table, error) {
+	var tables []Table
+
+	collection := r.db.Collection("rules")
+
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return tables, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var t Table
+		if err := cursor.Decode(&t); err != nil {
+			return tables, err
+		}
+		tables = append(tables, t)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Println("error getting data from cursor")
+		return tables, err
+	}
+	sortTables(tables)
+	return tables, nil
+}
+
+func (r *repo) Delete(sw string) error {
+	collection := r.db.Collection("rules")
+
+	res, err := collection.DeleteOne(context.Background(), bson.M{"_id": sw})
+	if err != nil {
+		log.Printf("error deleting forwarding table, %v", err)
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *repo) Count() (int64, error) {
+	collection := r.db.Collection("rules")
+	count, err := collection.EstimatedDocumentCount(context.Background())
+
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
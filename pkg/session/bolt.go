@@ -0,0 +1,82 @@
+package session
+
+import (
+	"github.com/letitbeat/dp-analyzer/pkg/db/bolt"
+	bbolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sessionsBucket = "sessions"
+
+type boltRepo struct {
+	db *bbolt.DB
+}
+
+// NewBoltRepository returns a new Repository backed by an embedded BoltDB
+func NewBoltRepository(db *bbolt.DB) Repository {
+	return &boltRepo{db}
+}
+
+func (r *boltRepo) Store(s Session) (Session, error) {
+	s.ID = primitive.NewObjectID()
+	return s, bolt.Put(r.db, sessionsBucket, s.ID.Hex(), s)
+}
+
+func (r *boltRepo) FindByID(id string) (*Session, error) {
+	var s Session
+	found, err := bolt.Get(r.db, sessionsBucket, id, &s)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (r *boltRepo) FindAll() ([]Session, error) {
+	var sessions []Session
+
+	err := bolt.ForEach(r.db, sessionsBucket, func(_ string, decode func(interface{}) error) error {
+		var s Session
+		if err := decode(&s); err != nil {
+			return err
+		}
+		sessions = append(sessions, s)
+		return nil
+	})
+	sortSessions(sessions)
+	return sessions, err
+}
+
+func (r *boltRepo) FindOpen() ([]Session, error) {
+	all, err := r.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []Session
+	for _, s := range all {
+		if s.Status == Open {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *boltRepo) Update(s Session) error {
+	if _, err := r.FindByID(s.ID.Hex()); err != nil {
+		return err
+	}
+	return bolt.Put(r.db, sessionsBucket, s.ID.Hex(), s)
+}
+
+func (r *boltRepo) Delete(id string) error {
+	if _, err := r.FindByID(id); err != nil {
+		return err
+	}
+	return bolt.Delete(r.db, sessionsBucket, id)
+}
+
+func (r *boltRepo) Count() (int64, error) {
+	return bolt.Count(r.db, sessionsBucket)
+}
@@ -0,0 +1,182 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Scoped is implemented by the repositories of the entities scoped to a
+// session, e.g. the observations and their flow trees
+type Scoped interface {
+	DeleteBySession(session string) (int64, error)
+}
+
+// Handler implements sessions operations
+type Handler struct {
+	repo   Repository
+	scoped []Scoped
+}
+
+// NewHandler returns a new sessions Handler, deleting a session deletes
+// its entities from every scoped repository
+func NewHandler(repo Repository, scoped ...Scoped) *Handler {
+	return &Handler{repo, scoped}
+}
+
+// Create HTTP POST handler which creates a new open session, the request
+// body holds its name and optionally its description
+func (h *Handler) Create(response http.ResponseWriter, request *http.Request) {
+
+	var s Session
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	if err := json.Unmarshal(body, &s); err != nil {
+		writeStatus(response, http.StatusBadRequest, err)
+		return
+	}
+	if s.Name == "" {
+		writeStatus(response, http.StatusBadRequest, errors.New("missing session name"))
+		return
+	}
+
+	s = Session{Name: s.Name, Description: s.Description, Status: Open, CreatedAt: time.Now()}
+	s, err = h.repo.Store(s)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	log.Printf("opened session %s (%s)", s.Name, s.ID.Hex())
+
+	response.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(response).Encode(s)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// GetAll HTTP GET handler which returns the sessions sorted by creation
+// time, only the ones with the status given by the optional status
+// parameter
+func (h *Handler) GetAll(response http.ResponseWriter, request *http.Request) {
+
+	sessions, err := h.repo.FindAll()
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	status := Status(request.URL.Query().Get("status"))
+	filtered := []Session{}
+	for _, s := range sessions {
+		if status == "" || s.Status == status {
+			filtered = append(filtered, s)
+		}
+	}
+
+	err = json.NewEncoder(response).Encode(filtered)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Get HTTP GET handler which returns a single session
+func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
+
+	s, err := h.repo.FindByID(mux.Vars(request)["id"])
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(s)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Close HTTP POST handler which closes a session, its observations are
+// kept but it does not accept new ones
+func (h *Handler) Close(response http.ResponseWriter, request *http.Request) {
+	h.update(response, request, (*Session).Close)
+}
+
+// Archive HTTP POST handler which closes and archives a session, its flow
+// trees are left out of the listings unless requested by session
+func (h *Handler) Archive(response http.ResponseWriter, request *http.Request) {
+	h.update(response, request, (*Session).Archive)
+}
+
+func (h *Handler) update(response http.ResponseWriter, request *http.Request, change func(*Session, time.Time)) {
+
+	s, err := h.repo.FindByID(mux.Vars(request)["id"])
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	change(s, time.Now())
+	if err := h.repo.Update(*s); err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(s)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Delete HTTP DELETE handler which deletes a session along with its
+// observations and flow trees
+func (h *Handler) Delete(response http.ResponseWriter, request *http.Request) {
+
+	id := mux.Vars(request)["id"]
+	if _, err := h.repo.FindByID(id); err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	for _, r := range h.scoped {
+		n, err := r.DeleteBySession(id)
+		if err != nil {
+			writeErr(response, err)
+			return
+		}
+		log.Printf("deleted %d entities of session %s", n, id)
+	}
+
+	if err := h.repo.Delete(id); err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func writeErr(response http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == ErrNotFound {
+		status = http.StatusNotFound
+	}
+	if status == http.StatusInternalServerError {
+		log.Println("error ", err)
+	}
+	writeStatus(response, status, err)
+}
+
+func writeStatus(response http.ResponseWriter, status int, err error) {
+	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
+	response.WriteHeader(status)
+	response.Write([]byte(msg))
+}
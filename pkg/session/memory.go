@@ -0,0 +1,95 @@
+package session
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryRepo struct {
+	lock     sync.RWMutex
+	sessions []Session
+}
+
+// NewMemoryRepository returns a new thread-safe in-memory Repository
+func NewMemoryRepository() Repository {
+	return &memoryRepo{}
+}
+
+func (r *memoryRepo) Store(s Session) (Session, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s.ID = primitive.NewObjectID()
+	r.sessions = append(r.sessions, s)
+	return s, nil
+}
+
+func (r *memoryRepo) FindAll() ([]Session, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var sessions []Session
+	sessions = append(sessions, r.sessions...)
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (r *memoryRepo) FindOpen() ([]Session, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var sessions []Session
+	for _, s := range r.sessions {
+		if s.Status == Open {
+			sessions = append(sessions, s)
+		}
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (r *memoryRepo) FindByID(id string) (*Session, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, s := range r.sessions {
+		if s.ID.Hex() == id {
+			return &s, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryRepo) Update(s Session) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := range r.sessions {
+		if r.sessions[i].ID == s.ID {
+			r.sessions[i] = s
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRepo) Delete(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := range r.sessions {
+		if r.sessions[i].ID.Hex() == id {
+			r.sessions = append(r.sessions[:i], r.sessions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRepo) Count() (int64, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return int64(len(r.sessions)), nil
+}
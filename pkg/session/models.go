@@ -0,0 +1,75 @@
+package session
+
+import (
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Status is the state of an experiment session
+type Status string
+
+// Session statuses, sessions are created open, then closed and archived
+const (
+	// Open sessions accept new observations
+	Open Status = "open"
+	// Closed sessions do not accept observations anymore
+	Closed Status = "closed"
+	// Archived sessions are closed and their flow trees are left out of
+	// the listings unless requested by session
+	Archived Status = "archived"
+)
+
+// Session groups the observations captured during a run of an experiment,
+// their flow trees are built, merged and verified within the session
+type Session struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	Status      Status             `json:"status" bson:"status"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	ClosedAt    *time.Time         `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
+	ArchivedAt  *time.Time         `json:"archived_at,omitempty" bson:"archived_at,omitempty"`
+}
+
+// ErrNotFound is returned when the requested session does not exist
+var ErrNotFound error = &statusError{"session not found", http.StatusNotFound}
+
+// ErrNotOpen is returned when observations are added to a session which
+// is not open
+var ErrNotOpen error = &statusError{"session is not open", http.StatusConflict}
+
+// statusError is an error of the client, it is answered with its status by
+// the handlers of the packets tagged with a session, see packets.Handler
+type statusError struct {
+	msg    string
+	status int
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// Status returns the HTTP status the error is answered with
+func (e *statusError) Status() int {
+	return e.status
+}
+
+// Close closes the session, closing a session not open has no effect
+func (s *Session) Close(at time.Time) {
+	if s.Status != Open {
+		return
+	}
+	s.Status = Closed
+	s.ClosedAt = &at
+}
+
+// Archive closes and archives the session
+func (s *Session) Archive(at time.Time) {
+	s.Close(at)
+	if s.Status != Archived {
+		s.Status = Archived
+		s.ArchivedAt = &at
+	}
+}
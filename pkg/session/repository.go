@@ -0,0 +1,167 @@
+package session
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository defines the methods to be implemented by
+// the storage layer.
+type Repository interface {
+	// FindAll returns the sessions sorted by creation time
+	FindAll() ([]Session, error)
+	// FindByID returns the session with the given ID or ErrNotFound
+	FindByID(id string) (*Session, error)
+	// FindOpen returns the open sessions sorted by creation time
+	FindOpen() ([]Session, error)
+	// Store stores a new session and returns it along with its new ID
+	Store(s Session) (Session, error)
+	// Update updates a session, it returns ErrNotFound if it does not exist
+	Update(s Session) error
+	// Delete deletes a session, it returns ErrNotFound if it does not exist
+	Delete(id string) error
+	// Count counts the sessions stored
+	Count() (int64, error)
+}
+
+// sortSessions sorts sessions by creation time
+func sortSessions(sessions []Session) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+}
+
+type repo struct {
+	db *mongo.Database
+}
+
+// NewRepository returns a new mongo Repository storing into the given database
+func NewRepository(db *mongo.Database) Repository {
+	r := &repo{db}
+	r.ensureIndexes()
+	return r
+}
+
+func (r *repo) ensureIndexes() {
+	collection := r.db.Collection("sessions")
+
+	model := mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}}
+	if _, err := collection.Indexes().CreateOne(context.Background(), model); err != nil {
+		log.Printf("error creating sessions indexes, %v", err)
+	}
+}
+
+func (r *repo) Store(s Session) (Session, error) {
+	collection := r.db.Collection("sessions")
+
+	s.ID = primitive.NewObjectID()
+	_, err := collection.InsertOne(context.Background(), s)
+	if err != nil {
+		log.Printf("error storing session, %v", err)
+		return s, err
+	}
+	return s, nil
+}
+
+func (r *repo) FindByID(id string) (*Session, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	collection := r.db.Collection("sessions")
+
+	var s Session
+	err = collection.FindOne(context.Background(), bson.M{"_id": oid}).Decode(&s)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *repo) FindAll() ([]Session, error) {
+	return r.find(bson.D{})
+}
+
+func (r *repo) FindOpen() ([]Session, error) {
+	return r.find(bson.D{{Key: "status", Value: Open}})
+}
+
+func (r *repo) find(filter bson.D) ([]Session, error) {
+	var sessions []Session
+
+	collection := r.db.Collection("sessions")
+
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return sessions, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var s Session
+		if err := cursor.Decode(&s); err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Println("error getting data from cursor")
+		return sessions, err
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (r *repo) Update(s Session) error {
+	collection := r.db.Collection("sessions")
+
+	res, err := collection.ReplaceOne(context.Background(), bson.M{"_id": s.ID}, s)
+	if err != nil {
+		log.Printf("error updating session, %v", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *repo) Delete(id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	collection := r.db.Collection("sessions")
+
+	res, err := collection.DeleteOne(context.Background(), bson.M{"_id": oid})
+	if err != nil {
+		log.Printf("error deleting session, %v", err)
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *repo) Count() (int64, error) {
+	collection := r.db.Collection("sessions")
+	count, err := collection.EstimatedDocumentCount(context.Background())
+
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+type tagging struct {
+	packets.Repository
+	sessions Repository
+}
+
+// NewTaggingRepository returns a Repository tagging the packets stored in
+// r with their session. Packets without a session are tagged with the
+// latest open session, if any, and packets of an unknown session or of a
+// session not open are rejected with ErrNotFound or ErrNotOpen, the other
+// packets of a batch being stored, see packets.BatchError.
+func NewTaggingRepository(r packets.Repository, sessions Repository) packets.Repository {
+	return &tagging{r, sessions}
+}
+
+func (r *tagging) Store(p packets.Packet) error {
+	ps := []packets.Packet{p}
+	failed, err := r.tag(ps)
+	if err != nil {
+		return err
+	}
+	if err := failed[0]; err != nil {
+		return err
+	}
+	return r.Repository.Store(ps[0])
+}
+
+func (r *tagging) StoreAll(ps []packets.Packet) error {
+	tagged := append([]packets.Packet(nil), ps...)
+	failed, err := r.tag(tagged)
+	if err != nil {
+		return err
+	}
+	if len(failed) == 0 {
+		return r.Repository.StoreAll(tagged)
+	}
+
+	// the packets rejected are left out, the indexes of the packets not
+	// stored are those of the batch given
+	var valid []packets.Packet
+	var index []int
+	for i, p := range tagged {
+		if failed[i] == nil {
+			valid = append(valid, p)
+			index = append(index, i)
+		}
+	}
+	if len(valid) > 0 {
+		err := r.Repository.StoreAll(valid)
+		be, ok := err.(*packets.BatchError)
+		if err != nil && !ok {
+			return err
+		}
+		if ok {
+			for j, err := range be.Failed {
+				failed[index[j]] = err
+			}
+		}
+	}
+	return &packets.BatchError{Failed: failed}
+}
+
+// tag sets the session of the packets without one to the latest open
+// session and returns the errors of the packets of a session not open by
+// index
+func (r *tagging) tag(ps []packets.Packet) (map[int]error, error) {
+	open, err := r.sessions.FindOpen()
+	if err != nil {
+		return nil, err
+	}
+	latest := ""
+	status := make(map[string]error)
+	for _, s := range open {
+		status[s.ID.Hex()] = nil
+		latest = s.ID.Hex()
+	}
+
+	failed := make(map[int]error)
+	for i := range ps {
+		if ps[i].Session == "" {
+			ps[i].Session = latest
+			continue
+		}
+		err, ok := status[ps[i].Session]
+		if !ok {
+			// the sessions not open are looked up once per batch
+			err = ErrNotOpen
+			if _, lookup := r.sessions.FindByID(ps[i].Session); lookup == ErrNotFound {
+				err = ErrNotFound
+			} else if lookup != nil {
+				return nil, lookup
+			}
+			status[ps[i].Session] = err
+		}
+		if err != nil {
+			failed[i] = err
+		}
+	}
+	return failed, nil
+}
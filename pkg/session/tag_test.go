@@ -0,0 +1,83 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+func TestTaggingRepository(t *testing.T) {
+	sessions := NewMemoryRepository()
+	pks := packets.NewMemoryRepository()
+	repo := NewTaggingRepository(pks, sessions)
+
+	at := time.Date(2019, 3, 16, 17, 43, 26, 0, time.UTC)
+	packet := func(payload, session string) packets.Packet {
+		return packets.Packet{Device: "s1-eth1", Payload: payload, Session: session, CapturedAt: &at}
+	}
+
+	// without open session the packets are not tagged
+	if err := repo.Store(packet("a", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := sessions.Store(Session{Name: "first", Status: Open, CreatedAt: at})
+	latest, _ := sessions.Store(Session{Name: "latest", Status: Open, CreatedAt: at.Add(time.Second)})
+	if err := repo.StoreAll([]packets.Packet{packet("b", ""), packet("c", first.ID.Hex())}); err != nil {
+		t.Fatal(err)
+	}
+	if tagged, _ := pks.FindBySession(latest.ID.Hex()); len(tagged) != 1 || tagged[0].Payload != "b" {
+		t.Errorf("expected b to be tagged with the latest open session, got %+v", tagged)
+	}
+	if tagged, _ := pks.FindBySession(first.ID.Hex()); len(tagged) != 1 || tagged[0].Payload != "c" {
+		t.Errorf("expected c to keep its session, got %+v", tagged)
+	}
+
+	first.Close(at.Add(time.Minute))
+	sessions.Update(first)
+	if err := repo.Store(packet("d", first.ID.Hex())); err != ErrNotOpen {
+		t.Errorf("expected ErrNotOpen for a closed session, got %v", err)
+	}
+	if err := repo.Store(packet("d", "unknown")); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for an unknown session, got %v", err)
+	}
+	if all, _ := pks.FindAll(); len(all) != 3 || all[0].Session != "" {
+		t.Errorf("expected a, b and c to be stored, got %+v", all)
+	}
+
+	// the packets of a batch of a session not open are rejected alone
+	err := repo.StoreAll([]packets.Packet{packet("e", first.ID.Hex()), packet("f", ""), packet("g", "unknown")})
+	be, ok := err.(*packets.BatchError)
+	if !ok || len(be.Failed) != 2 || be.Failed[0] != ErrNotOpen || be.Failed[2] != ErrNotFound {
+		t.Fatalf("expected e and g to be rejected, got %v", err)
+	}
+	if tagged, _ := pks.FindBySession(latest.ID.Hex()); len(tagged) != 2 || tagged[1].Payload != "f" {
+		t.Errorf("expected f to be stored, got %+v", tagged)
+	}
+}
+
+func TestTaggingRepositorySave(t *testing.T) {
+	sessions := NewMemoryRepository()
+	at := time.Date(2019, 3, 16, 17, 43, 26, 0, time.UTC)
+	closed, _ := sessions.Store(Session{Name: "closed", Status: Closed, CreatedAt: at})
+	h := packets.NewHandler(NewTaggingRepository(packets.NewMemoryRepository(), sessions))
+
+	// the packets of a session not open are client errors
+	tests := map[string]int{"unknown": http.StatusNotFound, closed.ID.Hex(): http.StatusConflict}
+	for id, status := range tests {
+		body := fmt.Sprintf(`{"device": "s1-eth1", "payload": "a", "session": %q}`, id)
+		rec := httptest.NewRecorder()
+		h.Save(rec, httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(body)))
+		if rec.Code != status {
+			t.Errorf("expected %d for session %s, got %d", status, id, rec.Code)
+		}
+		if strings.Count(rec.Body.String(), "message") != 1 {
+			t.Errorf("expected a single error message, got %s", rec.Body.String())
+		}
+	}
+}
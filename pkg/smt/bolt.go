@@ -0,0 +1,67 @@
+package smt
+
+import (
+	"github.com/letitbeat/dp-analyzer/pkg/db/bolt"
+	bbolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const smtBucket = "smt"
+
+type boltRepo struct {
+	db *bbolt.DB
+}
+
+// NewBoltRepository returns a new Repository backed by an embedded BoltDB
+func NewBoltRepository(db *bbolt.DB) Repository {
+	return &boltRepo{db}
+}
+
+func (r *boltRepo) Store(p Property) (Property, error) {
+	p.ID = primitive.NewObjectID()
+	return p, bolt.Put(r.db, smtBucket, p.ID.Hex(), p)
+}
+
+func (r *boltRepo) FindByID(id string) (*Property, error) {
+	var p Property
+	found, err := bolt.Get(r.db, smtBucket, id, &p)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &p, nil
+}
+
+func (r *boltRepo) Delete(id string) error {
+	if _, err := r.FindByID(id); err != nil {
+		return err
+	}
+	return bolt.Delete(r.db, smtBucket, id)
+}
+
+func (r *boltRepo) FindAll() ([]Property, error) {
+	var t []Property
+
+	err := bolt.ForEach(r.db, smtBucket, func(_ string, decode func(interface{}) error) error {
+		var c Property
+		if err := decode(&c); err != nil {
+			return err
+		}
+		t = append(t, c)
+		return nil
+	})
+	return t, err
+}
+
+func (r *boltRepo) Update(p Property) error {
+	if _, err := r.FindByID(p.ID.Hex()); err != nil {
+		return err
+	}
+	return bolt.Put(r.db, smtBucket, p.ID.Hex(), p)
+}
+
+func (r *boltRepo) Count() (int64, error) {
+	return bolt.Count(r.db, smtBucket)
+}
@@ -0,0 +1,145 @@
+package smt
+
+import (
+	"strings"
+)
+
+// EdgeRef identifies an edge of a flow tree path as encoded in the SMT
+// formula, Index is 1-based as in the e<path>_<index> constants.
+type EdgeRef struct {
+	Path  int    `json:"path" bson:"path"`
+	Index int    `json:"index" bson:"index"`
+	Src   string `json:"src" bson:"src"`
+	Dst   string `json:"dst" bson:"dst"`
+}
+
+// Counterexample holds the paths and edges of a flow tree involved in a
+// verification result, taken from the model of sat results or from the
+// unsat core of unsat ones.
+type Counterexample struct {
+	Paths []int     `json:"paths" bson:"paths"`
+	Edges []EdgeRef `json:"edges" bson:"edges"`
+}
+
+// Empty reports whether the counterexample references no path nor edge
+func (c *Counterexample) Empty() bool {
+	return c == nil || (len(c.Paths) == 0 && len(c.Edges) == 0)
+}
+
+// Assignment is a constant of a model
+type Assignment struct {
+	Name  string
+	Sort  string
+	Value string
+}
+
+// ParseModel parses the (define-fun <name> () <sort> <value>) entries of
+// a model, functions taking arguments are ignored.
+func ParseModel(model string) []Assignment {
+	var as []Assignment
+
+	exprs := SExprs(strings.TrimSpace(model))
+	if len(exprs) == 1 {
+		// the model itself is a list, (model ...) for older z3 versions
+		inner := SExprs(unwrap(exprs[0]))
+		if len(inner) > 0 && inner[0] == "model" {
+			inner = inner[1:]
+		}
+		if len(inner) == 0 || inner[0] != "define-fun" {
+			exprs = inner
+		}
+	}
+
+	for _, e := range exprs {
+		parts := SExprs(unwrap(e))
+		if len(parts) != 5 || parts[0] != "define-fun" || parts[2] != "()" {
+			continue
+		}
+		as = append(as, Assignment{Name: parts[1], Sort: parts[3], Value: parts[4]})
+	}
+	return as
+}
+
+// ParseCore parses an unsat core returning the names of its assertions
+func ParseCore(core string) []string {
+	return SExprs(unwrap(strings.TrimSpace(core)))
+}
+
+// PairValue returns the source and destination of a (mk-pair "a" "b") value
+func PairValue(v string) (string, string, bool) {
+	parts := SExprs(unwrap(v))
+	if len(parts) != 3 || parts[0] != "mk-pair" {
+		return "", "", false
+	}
+	return unquote(parts[1]), unquote(parts[2]), true
+}
+
+// SExprs splits s into its top-level s-expressions and atoms
+func SExprs(s string) []string {
+	var exprs []string
+	depth := 0
+	start := -1
+	inString := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inString:
+			if c == '"' {
+				// "" is an escaped quote in SMT-LIB2 strings
+				if i+1 < len(s) && s[i+1] == '"' {
+					i++
+					continue
+				}
+				inString = false
+				if depth == 0 {
+					exprs = append(exprs, s[start:i+1])
+					start = -1
+				}
+			}
+		case c == '"':
+			inString = true
+			if depth == 0 {
+				start = i
+			}
+		case c == '(':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 && start >= 0 {
+				exprs = append(exprs, s[start:i+1])
+				start = -1
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if depth == 0 && start >= 0 {
+				exprs = append(exprs, s[start:i])
+				start = -1
+			}
+		default:
+			if depth == 0 && start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 && depth == 0 && !inString {
+		exprs = append(exprs, s[start:])
+	}
+	return exprs
+}
+
+func unwrap(s string) string {
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.Replace(s[1:len(s)-1], `""`, `"`, -1)
+	}
+	return s
+}
@@ -6,79 +6,134 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+
+	"github.com/gorilla/mux"
 )
 
-// Handler implements topology operations
+// Handler implements properties operations
 type Handler struct {
 	repo Repository
 }
 
-// NewHandler returns a new topology Handler
+// NewHandler returns a new properties Handler
 func NewHandler(repo Repository) *Handler {
 	return &Handler{repo}
 }
 
-// Get HTTP GET handler which returns the data-plane topology
-func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
+// GetAll HTTP GET handler which returns all the stored properties
+func (h *Handler) GetAll(response http.ResponseWriter, request *http.Request) {
 
 	props, err := h.repo.FindAll()
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	if props == nil {
+		props = []Property{}
+	}
+
+	err = json.NewEncoder(response).Encode(props)
 	if err != nil {
 		writeErr(response, err)
 	}
+}
+
+// Get HTTP GET handler which returns a single property
+func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
 
-	var p Property
-	if len(props) > 0 {
-		p = props[0]
+	p, err := h.repo.FindByID(mux.Vars(request)["id"])
+	if err != nil {
+		writeErr(response, err)
+		return
 	}
+
 	err = json.NewEncoder(response).Encode(p)
 	if err != nil {
 		writeErr(response, err)
 	}
 }
 
-// Save HTTP POST handler which stores the data-plane topology
+// Save HTTP POST handler which stores a new property
 func (h *Handler) Save(response http.ResponseWriter, request *http.Request) {
 
-	var property Property
+	property, err := readProperty(request)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
 
-	body, err := ioutil.ReadAll(request.Body)
+	property, err = h.repo.Store(property)
 	if err != nil {
 		writeErr(response, err)
+		return
 	}
 
-	err = json.Unmarshal(body, &property)
+	response.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(response).Encode(property)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Update HTTP PUT handler which updates an existing property
+func (h *Handler) Update(response http.ResponseWriter, request *http.Request) {
+
+	current, err := h.repo.FindByID(mux.Vars(request)["id"])
 	if err != nil {
 		writeErr(response, err)
 		return
 	}
 
-	count, _ := h.repo.Count()
-
-	if count > 0 {
-		props, err := h.repo.FindAll()
-		if err != nil {
-			writeErr(response, err)
-			return
-		}
-		property.ID = props[0].ID
-		h.repo.Update(property)
-	} else {
-		err := h.repo.Store(property)
-		if err != nil {
-			writeErr(response, err)
-			return
-		}
+	property, err := readProperty(request)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	property.ID = current.ID
+
+	err = h.repo.Update(property)
+	if err != nil {
+		writeErr(response, err)
+		return
 	}
 
-	err = json.NewEncoder(response).Encode("{\"status\":\"ok\"}")
+	err = json.NewEncoder(response).Encode(property)
 	if err != nil {
 		writeErr(response, err)
 	}
 }
 
+// Delete HTTP DELETE handler which deletes a property
+func (h *Handler) Delete(response http.ResponseWriter, request *http.Request) {
+
+	err := h.repo.Delete(mux.Vars(request)["id"])
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func readProperty(request *http.Request) (Property, error) {
+	var property Property
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return property, err
+	}
+
+	err = json.Unmarshal(body, &property)
+	return property, err
+}
+
 func writeErr(response http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == ErrNotFound {
+		status = http.StatusNotFound
+	}
 	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
 	log.Println("error ", msg)
-	response.WriteHeader(http.StatusInternalServerError)
+	response.WriteHeader(status)
 	response.Write([]byte(msg))
 }
@@ -0,0 +1,80 @@
+package smt
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryRepo struct {
+	lock  sync.RWMutex
+	props []Property
+}
+
+// NewMemoryRepository returns a new thread-safe in-memory Repository
+func NewMemoryRepository() Repository {
+	return &memoryRepo{}
+}
+
+func (r *memoryRepo) Store(p Property) (Property, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	p.ID = primitive.NewObjectID()
+	r.props = append(r.props, p)
+	return p, nil
+}
+
+func (r *memoryRepo) FindAll() ([]Property, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var t []Property
+	t = append(t, r.props...)
+	return t, nil
+}
+
+func (r *memoryRepo) FindByID(id string) (*Property, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, p := range r.props {
+		if p.ID.Hex() == id {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryRepo) Update(p Property) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := range r.props {
+		if r.props[i].ID == p.ID {
+			r.props[i] = p
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRepo) Delete(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := range r.props {
+		if r.props[i].ID.Hex() == id {
+			r.props = append(r.props[:i], r.props[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRepo) Count() (int64, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return int64(len(r.props)), nil
+}
@@ -1,6 +1,10 @@
 package smt
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // Property struct contains information about the properties to be
 // verified
@@ -10,3 +14,28 @@ type Property struct {
 	Description string             `json:"description" bson:"description"`
 	Text        string             `json:"text" bson:"text"`
 }
+
+// Verdict is the outcome of verifying a property
+type Verdict string
+
+// Possible verdicts of a property verification, see also Timeout
+const (
+	Sat     Verdict = "sat"
+	Unsat   Verdict = "unsat"
+	Unknown Verdict = "unknown"
+	Error   Verdict = "error"
+)
+
+// Result holds the outcome of verifying a property against a flow tree
+type Result struct {
+	PropertyID primitive.ObjectID `json:"property_id" bson:"property_id"`
+	Title      string             `json:"title" bson:"title"`
+	Verdict    Verdict            `json:"verdict" bson:"verdict"`
+	// SolverTime is the time spent by the solver in nanoseconds
+	SolverTime time.Duration `json:"solver_time" bson:"solver_time"`
+	Error      string        `json:"error,omitempty" bson:"error,omitempty"`
+	// Model is the model returned by the solver for sat results
+	Model string `json:"model,omitempty" bson:"model,omitempty"`
+	// Counterexample holds the paths and edges involved in the result
+	Counterexample *Counterexample `json:"counterexample,omitempty" bson:"counterexample,omitempty"`
+}
@@ -2,6 +2,7 @@ package smt
 
 import (
 	"context"
+	"errors"
 	"log"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,42 +14,87 @@ import (
 // Repository defines the methods to be implemented by
 // the storage layer.
 type Repository interface {
-	// FindAll returns all the packets from storage
+	// FindAll returns all the properties from storage
 	FindAll() ([]Property, error)
-	// Store stores a new packet
-	Store(p Property) error
-	// Update updates a property
+	// FindByID returns the property with the given ID or ErrNotFound
+	FindByID(id string) (*Property, error)
+	// Store stores a new property and returns it along with its new ID
+	Store(p Property) (Property, error)
+	// Update updates a property, it returns ErrNotFound if it does not exist
 	Update(t Property) error
+	// Delete deletes a property, it returns ErrNotFound if it does not exist
+	Delete(id string) error
 	// Count counts the properties objects stored
 	Count() (int64, error)
 }
 
+// ErrNotFound is returned when the requested property does not exist
+var ErrNotFound = errors.New("property not found")
+
 type repo struct {
-	client *mongo.Client
+	db *mongo.Database
 }
 
-// NewRepository returns a new mongo Repository
-func NewRepository(c *mongo.Client) Repository {
-	return &repo{c}
+// NewRepository returns a new mongo Repository storing into the given database
+func NewRepository(db *mongo.Database) Repository {
+	return &repo{db}
 }
 
-func (r *repo) Store(p Property) error {
-	collection := r.client.Database("analyzer").Collection("smt")
+func (r *repo) Store(p Property) (Property, error) {
+	collection := r.db.Collection("smt")
 
 	p.ID = primitive.NewObjectID()
 	_, err := collection.InsertOne(context.Background(), p)
 
 	if err != nil {
 		log.Printf("error storing properties, %v", err)
+		return p, err
+	}
+	return p, nil
+}
+
+func (r *repo) FindByID(id string) (*Property, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	collection := r.db.Collection("smt")
+
+	var p Property
+	err = collection.FindOne(context.Background(), bson.M{"_id": oid}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *repo) Delete(id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	collection := r.db.Collection("smt")
+
+	res, err := collection.DeleteOne(context.Background(), bson.M{"_id": oid})
+	if err != nil {
+		log.Printf("error deleting property, %v", err)
 		return err
 	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
 func (r *repo) FindAll() ([]Property, error) {
 	var t []Property
 
-	collection := r.client.Database("analyzer").Collection("smt")
+	collection := r.db.Collection("smt")
 
 	ctx := context.Background()
 	cursor, err := collection.Find(ctx, bson.D{})
@@ -70,28 +116,29 @@ func (r *repo) FindAll() ([]Property, error) {
 }
 
 func (r *repo) Update(p Property) error {
-	collection := r.client.Database("analyzer").Collection("smt")
+	collection := r.db.Collection("smt")
 
 	filter := bson.M{"_id": p.ID}
-	update := bson.D{{"$set",
-		bson.D{
-			{"title", p.Title},
-			{"description", p.Description},
-			{"text", p.Text},
-		},
-	}}
-	_, err := collection.UpdateOne(context.Background(), filter, update)
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "title", Value: p.Title},
+		{Key: "description", Value: p.Description},
+		{Key: "text", Value: p.Text},
+	}}}
+	res, err := collection.UpdateOne(context.Background(), filter, update)
 
 	if err != nil {
 		log.Printf("error updating property, %v", err)
 		return err
 	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
 	log.Printf("updated property %v", update)
 	return nil
 }
 
 func (r *repo) Count() (int64, error) {
-	collection := r.client.Database("analyzer").Collection("smt")
+	collection := r.db.Collection("smt")
 	count, err := collection.EstimatedDocumentCount(context.Background())
 
 	if err != nil {
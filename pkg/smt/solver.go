@@ -0,0 +1,184 @@
+package smt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout is the verdict of a verification the solver could not finish in time
+const Timeout Verdict = "timeout"
+
+// Supported solver backends
+const (
+	Z3   = "z3"
+	CVC5 = "cvc5"
+)
+
+// Outcome holds the result of solving a formula
+type Outcome struct {
+	Verdict Verdict
+	// Model is the model returned by the solver for sat formulas
+	Model string
+	// Core holds the names of the assertions of the unsat core returned
+	// by the solver for unsat formulas
+	Core []string
+	// Output is the raw solver output
+	Output string
+	// Duration is the time spent solving the formula
+	Duration time.Duration
+}
+
+// Solver solves SMT-LIB2 formulas
+type Solver interface {
+	// Solve checks the satisfiability of the formula. Solver errors and
+	// timeouts are reported both through the outcome verdict and the
+	// returned error.
+	Solve(ctx context.Context, formula string) (Outcome, error)
+}
+
+// NewSolver returns the solver backend with the given name, defaults to z3.
+// path is the solver binary, looked up in PATH by its name when empty.
+func NewSolver(name, path string, timeout time.Duration) (Solver, error) {
+	if name == "" {
+		name = Z3
+	}
+	if path == "" {
+		path = name
+	}
+	switch name {
+	case Z3:
+		return NewBinarySolver(path, []string{"-in", "-smt2"}, timeout), nil
+	case CVC5:
+		return NewBinarySolver(path, []string{"--lang=smt2", "--produce-models"}, timeout), nil
+	}
+	return nil, fmt.Errorf("unknown solver %q", name)
+}
+
+// BinarySolver pipes formulas to a solver executable through its
+// standard input.
+type BinarySolver struct {
+	path    string
+	args    []string
+	timeout time.Duration
+}
+
+// NewBinarySolver returns a solver running the given executable, a zero
+// timeout means no timeout.
+func NewBinarySolver(path string, args []string, timeout time.Duration) *BinarySolver {
+	return &BinarySolver{path, args, timeout}
+}
+
+// Solve pipes the formula followed by (check-sat), (get-model) and
+// (get-unsat-core) to the solver and parses its output.
+func (s *BinarySolver) Solve(ctx context.Context, formula string) (Outcome, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	var script strings.Builder
+	script.WriteString("(set-option :produce-models true)\n")
+	script.WriteString("(set-option :produce-unsat-cores true)\n")
+	script.WriteString(formula)
+	script.WriteString("\n(check-sat)\n(get-model)\n(get-unsat-core)\n")
+
+	cmd := exec.CommandContext(ctx, s.path, s.args...)
+	cmd.Stdin = strings.NewReader(script.String())
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		o := Outcome{Verdict: Timeout, Output: out.String(), Duration: duration}
+		return o, fmt.Errorf("solver timed out after %s", duration)
+	}
+
+	o, perr := ParseOutput(out.String())
+	o.Duration = duration
+	if perr != nil {
+		if err != nil {
+			perr = fmt.Errorf("%v, %v: %s", perr, err, strings.TrimSpace(stderr.String()))
+		}
+		return o, perr
+	}
+	// solvers exit with an error status when (get-model) follows an unsat
+	// result, or (get-unsat-core) a sat one, the verdict is still valid
+	return o, nil
+}
+
+// ParseOutput parses the output of a solver run of a script made of a
+// formula, (check-sat), (get-model) and (get-unsat-core).
+func ParseOutput(out string) (Outcome, error) {
+	o := Outcome{Verdict: Error, Output: out}
+
+	exprs := SExprs(out)
+	for i, e := range exprs {
+		switch {
+		case strings.HasPrefix(e, "(error"):
+			// errors before the verdict come from the formula itself
+			return o, fmt.Errorf("solver error %s", e)
+		case e == string(Sat), e == string(Unsat), e == string(Unknown):
+			o.Verdict = Verdict(e)
+			// the answers to (get-model) and (get-unsat-core) follow, only
+			// one of them succeeds depending on the verdict
+			for _, r := range exprs[i+1:] {
+				if strings.HasPrefix(r, "(error") {
+					continue
+				}
+				if o.Verdict == Sat && o.Model == "" {
+					o.Model = r
+				} else if o.Verdict == Unsat && o.Core == nil {
+					o.Core = ParseCore(r)
+				}
+			}
+			return o, nil
+		case e == "success":
+			continue
+		default:
+			return o, fmt.Errorf("unexpected solver output %q", e)
+		}
+	}
+	return o, errors.New("no verdict in solver output")
+}
+
+// MockSolver is a Solver meant for tests, it returns the outcome computed
+// by Fn, or the fixed Outcome when Fn is nil, and records every formula.
+type MockSolver struct {
+	Outcome Outcome
+	Err     error
+	Fn      func(formula string) (Outcome, error)
+
+	lock     sync.Mutex
+	formulas []string
+}
+
+// Solve records the formula and returns the configured outcome
+func (m *MockSolver) Solve(ctx context.Context, formula string) (Outcome, error) {
+	m.lock.Lock()
+	m.formulas = append(m.formulas, formula)
+	m.lock.Unlock()
+
+	if m.Fn != nil {
+		return m.Fn(formula)
+	}
+	return m.Outcome, m.Err
+}
+
+// Formulas returns the formulas solved so far
+func (m *MockSolver) Formulas() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]string(nil), m.formulas...)
+}
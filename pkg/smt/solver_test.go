@@ -0,0 +1,92 @@
+package smt
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOutput(t *testing.T) {
+	cases := []struct {
+		out     string
+		verdict Verdict
+		model   string
+		err     bool
+	}{
+		{"sat\n(\n  (define-fun i () Int 1)\n)\n(error \"line 13 column 0: unsat core is not available\")\n", Sat, "(\n  (define-fun i () Int 1)\n)", false},
+		{"unsat\n(error \"line 12 column 10: model is not available\")\n(pe1_2)\n", Unsat, "", false},
+		{"unknown\n", Unknown, "", false},
+		{"(error \"line 3 column 1: unknown constant p9\")\nsat\n", Error, "", true},
+		{"", Error, "", true},
+		{"segmentation fault\n", Error, "", true},
+	}
+
+	for _, c := range cases {
+		o, err := ParseOutput(c.out)
+		if (err != nil) != c.err {
+			t.Errorf("%q: expected error %v, got %v", c.out, c.err, err)
+		}
+		if o.Verdict != c.verdict || o.Model != c.model {
+			t.Errorf("%q: expected %s %q, got %s %q", c.out, c.verdict, c.model, o.Verdict, o.Model)
+		}
+	}
+}
+
+// fakeSolver writes an executable script standing for a solver binary
+func fakeSolver(t *testing.T, body string) (string, func()) {
+	dir, err := ioutil.TempDir("", "solver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "z3")
+	script := "#!/bin/sh\n" + body + "\n"
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestBinarySolver(t *testing.T) {
+	// the fake solver echoes its input so the piped script can be checked
+	path, cleanup := fakeSolver(t, `input=$(cat); echo sat; echo "$input"`)
+	defer cleanup()
+
+	s, err := NewSolver(Z3, path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.Solve(context.Background(), "(assert true)")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if o.Verdict != Sat {
+		t.Errorf("expected sat, got %s", o.Verdict)
+	}
+	if !strings.Contains(o.Output, "(assert true)\n(check-sat)\n(get-model)\n(get-unsat-core)") {
+		t.Errorf("expected the formula to be piped followed by check-sat, get-model and get-unsat-core, got %q", o.Output)
+	}
+}
+
+func TestBinarySolverTimeout(t *testing.T) {
+	path, cleanup := fakeSolver(t, "exec sleep 5")
+	defer cleanup()
+
+	s := NewBinarySolver(path, nil, 50*time.Millisecond)
+	o, err := s.Solve(context.Background(), "(assert true)")
+	if err == nil || o.Verdict != Timeout {
+		t.Errorf("expected a timeout, got %s, %v", o.Verdict, err)
+	}
+}
+
+func TestBinarySolverMissing(t *testing.T) {
+	s := NewBinarySolver("/nonexistent/z3", nil, time.Second)
+	o, err := s.Solve(context.Background(), "(assert true)")
+	if err == nil || o.Verdict != Error {
+		t.Errorf("expected a solver error, got %s, %v", o.Verdict, err)
+	}
+}
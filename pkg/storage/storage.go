@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/letitbeat/dp-analyzer/pkg/db/bolt"
+	"github.com/letitbeat/dp-analyzer/pkg/db/mongo"
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/rules"
+	"github.com/letitbeat/dp-analyzer/pkg/session"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+)
+
+// Supported storage backends
+const (
+	Mongo  = "mongo"
+	Memory = "memory"
+	Bolt   = "bolt"
+)
+
+// DefaultDatabase is the MongoDB database used when none is configured
+const DefaultDatabase = "analyzer"
+
+// Config selects and configures the storage backend
+type Config struct {
+	// Backend is one of mongo, memory or bolt, defaults to mongo
+	Backend string
+	// URI is the MongoDB connection URI
+	URI string
+	// Database is the MongoDB database, defaults to DefaultDatabase
+	Database string
+	// Path is the BoltDB database file
+	Path string
+}
+
+// Repositories holds the repositories of every stored entity
+type Repositories struct {
+	Packets  packets.Repository
+	Topology topology.Repository
+	SMT      smt.Repository
+	Trees    tree.Repository
+	Rules    rules.Repository
+	Sessions session.Repository
+
+	close func() error
+}
+
+// Open opens the configured backend and returns its repositories
+func Open(ctx context.Context, c Config) (*Repositories, error) {
+
+	switch c.Backend {
+	case Mongo, "":
+		client, err := mongo.Connect(ctx, c.URI)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to db, %v", err)
+		}
+		name := c.Database
+		if name == "" {
+			name = DefaultDatabase
+		}
+		db := client.Database(name)
+		return &Repositories{
+			Packets:  packets.NewRepository(db),
+			Topology: topology.NewRepository(db),
+			SMT:      smt.NewRepository(db),
+			Trees:    tree.NewRepository(db),
+			Rules:    rules.NewRepository(db),
+			Sessions: session.NewRepository(db),
+			close: func() error {
+				return client.Disconnect(context.Background())
+			},
+		}, nil
+
+	case Memory:
+		return &Repositories{
+			Packets:  packets.NewMemoryRepository(),
+			Topology: topology.NewMemoryRepository(),
+			SMT:      smt.NewMemoryRepository(),
+			Trees:    tree.NewMemoryRepository(),
+			Rules:    rules.NewMemoryRepository(),
+			Sessions: session.NewMemoryRepository(),
+			close:    func() error { return nil },
+		}, nil
+
+	case Bolt:
+		if c.Path == "" {
+			return nil, fmt.Errorf("missing database path for the %s backend", Bolt)
+		}
+		db, err := bolt.Open(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening db %s, %v", c.Path, err)
+		}
+		return &Repositories{
+			Packets:  packets.NewBoltRepository(db),
+			Topology: topology.NewBoltRepository(db),
+			SMT:      smt.NewBoltRepository(db),
+			Trees:    tree.NewBoltRepository(db),
+			Rules:    rules.NewBoltRepository(db),
+			Sessions: session.NewBoltRepository(db),
+			close:    db.Close,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %q", c.Backend)
+}
+
+// Close releases the resources held by the backend
+func (r *Repositories) Close() error {
+	return r.close()
+}
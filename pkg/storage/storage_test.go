@@ -0,0 +1,74 @@
+package storage_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/letitbeat/dp-analyzer/pkg/db/mongo"
+	"github.com/letitbeat/dp-analyzer/pkg/storage"
+	"github.com/letitbeat/dp-analyzer/pkg/storage/storagetest"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (*storage.Repositories, func()) {
+		repos, err := storage.Open(context.Background(), storage.Config{Backend: storage.Memory})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repos, func() { repos.Close() }
+	})
+}
+
+func TestBolt(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (*storage.Repositories, func()) {
+		dir, err := ioutil.TempDir("", "dp-analyzer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		repos, err := storage.Open(context.Background(), storage.Config{
+			Backend: storage.Bolt,
+			Path:    filepath.Join(dir, "analyzer.db"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repos, func() {
+			repos.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+// TestMongo runs the suite against the MongoDB instance given by the
+// DP_ANALYZER_TEST_MONGO_URI environment variable, the analyzer database
+// is dropped before every test.
+func TestMongo(t *testing.T) {
+	uri := os.Getenv("DP_ANALYZER_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("DP_ANALYZER_TEST_MONGO_URI not set")
+	}
+
+	storagetest.Run(t, func(t *testing.T) (*storage.Repositories, func()) {
+		ctx := context.Background()
+		if err := dropDatabase(ctx, uri); err != nil {
+			t.Fatal(err)
+		}
+		repos, err := storage.Open(ctx, storage.Config{Backend: storage.Mongo, URI: uri})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repos, func() { repos.Close() }
+	})
+}
+
+func dropDatabase(ctx context.Context, uri string) error {
+	client, err := mongo.Connect(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	return client.Database(storage.DefaultDatabase).Drop(ctx)
+}
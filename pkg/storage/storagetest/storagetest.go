@@ -0,0 +1,746 @@
+// Package storagetest provides the conformance test suite every storage
+// backend must pass.
+package storagetest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/rules"
+	"github.com/letitbeat/dp-analyzer/pkg/session"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/storage"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Factory returns a new set of empty repositories, the returned function
+// is called at the end of each test to release them.
+type Factory func(t *testing.T) (*storage.Repositories, func())
+
+// Run runs the whole conformance suite against the given backend
+func Run(t *testing.T, f Factory) {
+	t.Run("Packets", func(t *testing.T) { testPackets(t, f) })
+	t.Run("PacketsQueries", func(t *testing.T) { testPacketsQueries(t, f) })
+	t.Run("PacketsConcurrent", func(t *testing.T) { testPacketsConcurrent(t, f) })
+	t.Run("PacketsSessions", func(t *testing.T) { testPacketsSessions(t, f) })
+	t.Run("Topology", func(t *testing.T) { testTopology(t, f) })
+	t.Run("SMT", func(t *testing.T) { testSMT(t, f) })
+	t.Run("Trees", func(t *testing.T) { testTrees(t, f) })
+	t.Run("TreesSessions", func(t *testing.T) { testTreesSessions(t, f) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, f) })
+	t.Run("Rules", func(t *testing.T) { testRules(t, f) })
+}
+
+func packet(device, payload string, at time.Time) packets.Packet {
+	return packets.Packet{
+		Device:     device,
+		Type:       0,
+		SrcIP:      "10.0.0.1",
+		DstIP:      "10.0.0.2",
+		SrcPort:    "6666",
+		DstPort:    "80",
+		Payload:    payload,
+		CapturedAt: &at,
+	}
+}
+
+func testPackets(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Packets
+
+	base := time.Date(2019, 3, 16, 17, 43, 26, 385000001, time.UTC)
+
+	if err := repo.Store(packet("s1-eth1", "a", base)); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if err := repo.Store(packet("s1-eth1", "", base)); err != nil {
+		t.Fatalf("Store with empty payload: %v", err)
+	}
+	err := repo.StoreAll([]packets.Packet{
+		packet("s1-eth2", "a", base.Add(time.Millisecond)),
+		packet("s2-eth1", "a", base.Add(2*time.Millisecond)),
+	})
+	if err != nil {
+		t.Fatalf("StoreAll: %v", err)
+	}
+	if err := repo.StoreAll(nil); err != nil {
+		t.Fatalf("StoreAll with no packets: %v", err)
+	}
+
+	pks, err := repo.FindAll()
+	if err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+	if len(pks) != 3 {
+		t.Fatalf("expected 3 packets, packets without payload must not be stored, got %d", len(pks))
+	}
+
+	ids := make(map[string]bool)
+	for i, p := range pks {
+		if p.ID.IsZero() {
+			t.Errorf("packet %d has no ID", i)
+		}
+		ids[p.ID.Hex()] = true
+		expected := base.Add(time.Duration(i) * time.Millisecond)
+		if p.CapturedAtNano != expected.UnixNano() {
+			t.Errorf("packet %d: expected CapturedAtNano %d, got %d", i, expected.UnixNano(), p.CapturedAtNano)
+		}
+		if p.Payload != "a" || p.SrcIP != "10.0.0.1" || p.DstPort != "80" {
+			t.Errorf("packet %d not stored as is: %+v", i, p)
+		}
+	}
+	if len(ids) != 3 {
+		t.Errorf("expected unique IDs, got %v", ids)
+	}
+	if pks[0].Device != "s1-eth1" || pks[1].Device != "s1-eth2" || pks[2].Device != "s2-eth1" {
+		t.Errorf("expected packets in insertion order, got %s, %s, %s", pks[0].Device, pks[1].Device, pks[2].Device)
+	}
+}
+
+func testPacketsQueries(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Packets
+
+	base := time.Date(2019, 3, 16, 17, 43, 26, 0, time.UTC)
+
+	// stored out of order on purpose
+	err := repo.StoreAll([]packets.Packet{
+		packet("s2-eth1", "a", base.Add(3*time.Second)),
+		packet("s1-eth1", "a", base),
+		packet("s1-eth1", "b", base.Add(time.Second)),
+		packet("s1-eth2", "a", base.Add(2*time.Second)),
+		packet("s1-eth1", "ab", base.Add(4*time.Second)),
+	})
+	if err != nil {
+		t.Fatalf("StoreAll: %v", err)
+	}
+
+	pks, err := repo.FindByPayload("a")
+	if err != nil {
+		t.Fatalf("FindByPayload: %v", err)
+	}
+	devices := []string{"s1-eth1", "s1-eth2", "s2-eth1"}
+	if len(pks) != len(devices) {
+		t.Fatalf("FindByPayload: expected %d packets, got %d", len(devices), len(pks))
+	}
+	for i, d := range devices {
+		if pks[i].Device != d || pks[i].Payload != "a" {
+			t.Errorf("FindByPayload: expected %s at %d sorted by time, got %+v", d, i, pks[i])
+		}
+	}
+
+	if pks, err := repo.FindByPayload("c"); err != nil || len(pks) != 0 {
+		t.Errorf("FindByPayload: expected no packets for unknown payload, got %d, %v", len(pks), err)
+	}
+
+	pks, err = repo.FindInRange(base.Add(time.Second), base.Add(3*time.Second))
+	if err != nil {
+		t.Fatalf("FindInRange: %v", err)
+	}
+	if len(pks) != 2 || pks[0].Payload != "b" || pks[1].Device != "s1-eth2" {
+		t.Errorf("FindInRange: expected packets captured in [1s, 3s) sorted by time, got %+v", pks)
+	}
+
+	pks, err = repo.FindInRange(base.Add(3*time.Second), time.Time{})
+	if err != nil || len(pks) != 2 {
+		t.Errorf("FindInRange: expected 2 packets with open end, got %d, %v", len(pks), err)
+	}
+
+	pks, err = repo.FindInRange(time.Time{}, time.Time{})
+	if err != nil || len(pks) != 5 {
+		t.Errorf("FindInRange: expected all packets with open range, got %d, %v", len(pks), err)
+	}
+}
+
+func testPacketsSessions(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Packets
+
+	base := time.Date(2019, 3, 16, 17, 43, 26, 0, time.UTC)
+	tagged := func(device, payload, session string, at time.Time) packets.Packet {
+		p := packet(device, payload, at)
+		p.Session = session
+		return p
+	}
+	err := repo.StoreAll([]packets.Packet{
+		tagged("s1-eth2", "a", "s1", base.Add(time.Second)),
+		tagged("s1-eth1", "a", "s1", base),
+		tagged("s1-eth1", "b", "s2", base),
+		packet("s1-eth1", "c", base),
+	})
+	if err != nil {
+		t.Fatalf("StoreAll: %v", err)
+	}
+
+	pks, err := repo.FindBySession("s1")
+	if err != nil || len(pks) != 2 || pks[0].Device != "s1-eth1" || pks[1].Device != "s1-eth2" || pks[0].Session != "s1" {
+		t.Errorf("FindBySession: expected the packets of s1 sorted by time, got %+v, %v", pks, err)
+	}
+
+	if n, err := repo.DeleteBySession("s1"); err != nil || n != 2 {
+		t.Errorf("DeleteBySession: expected 2 packets deleted, got %d, %v", n, err)
+	}
+	if pks, err := repo.FindBySession("s1"); err != nil || len(pks) != 0 {
+		t.Errorf("FindBySession: expected no packets after DeleteBySession, got %d, %v", len(pks), err)
+	}
+	if pks, err := repo.FindByPayload("a"); err != nil || len(pks) != 0 {
+		t.Errorf("FindByPayload: expected no packets after DeleteBySession, got %d, %v", len(pks), err)
+	}
+	pks, err = repo.FindInRange(time.Time{}, time.Time{})
+	if err != nil || len(pks) != 2 || pks[0].Payload == "a" || pks[1].Payload == "a" {
+		t.Errorf("FindInRange: expected the packets of the other sessions, got %+v, %v", pks, err)
+	}
+	if n, err := repo.DeleteBySession("unknown"); err != nil || n != 0 {
+		t.Errorf("DeleteBySession: expected nothing deleted for unknown session, got %d, %v", n, err)
+	}
+}
+
+func testPacketsConcurrent(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Packets
+
+	const writers, perWriter = 8, 25
+
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		go func() {
+			for i := 0; i < perWriter; i++ {
+				if err := repo.Store(packet("s1-eth1", "a", time.Now())); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := repo.FindAll(); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for w := 0; w < writers; w++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("concurrent access: %v", err)
+		}
+	}
+
+	pks, err := repo.FindAll()
+	if err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+	if len(pks) != writers*perWriter {
+		t.Errorf("expected %d packets, got %d", writers*perWriter, len(pks))
+	}
+}
+
+func testTopology(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Topology
+
+	if c, err := repo.Count(); err != nil || c != 0 {
+		t.Fatalf("expected an empty repository, got %d, %v", c, err)
+	}
+
+	topo := topologyFixture()
+	created, err := repo.Store(topo)
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if created.ID.IsZero() || created.Version != 1 {
+		t.Errorf("Store: expected the stored topology to have an ID and version 1, got %s, %d", created.ID.Hex(), created.Version)
+	}
+
+	if c, err := repo.Count(); err != nil || c != 1 {
+		t.Fatalf("expected 1 topology, got %d, %v", c, err)
+	}
+
+	topos, err := repo.FindAll()
+	if err != nil || len(topos) != 1 {
+		t.Fatalf("FindAll: expected 1 topology, got %d, %v", len(topos), err)
+	}
+	stored := topos[0]
+	if stored.ID != created.ID {
+		t.Errorf("expected the topology stored with ID %s, got %s", created.ID.Hex(), stored.ID.Hex())
+	}
+	if len(stored.Links) != 2 || stored.Links[1].A.Port != "h2-eth0" || len(stored.Nodes) != 3 || stored.DOT != topo.DOT {
+		t.Errorf("topology not stored as is: %+v", stored)
+	}
+
+	if stored.Version != 1 || !stored.CreatedAt.Equal(topo.CreatedAt) {
+		t.Errorf("version not stored as is: %d, %v", stored.Version, stored.CreatedAt)
+	}
+
+	next := topologyFixture()
+	next.CreatedAt = topo.CreatedAt.Add(time.Hour)
+	next.Nodes = append(next.Nodes, topology.Node{Name: "h3", Kind: topology.Host})
+	if _, err := repo.Store(next); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	topos, err = repo.FindAll()
+	if err != nil || len(topos) != 2 || topos[0].Version != 1 || topos[1].Version != 2 {
+		t.Fatalf("FindAll: expected 2 versions in creation order, got %+v, %v", topos, err)
+	}
+
+	for _, c := range []struct {
+		at      time.Time
+		version int
+	}{
+		{topo.CreatedAt.Add(-time.Hour), 1},
+		{topo.CreatedAt.Add(time.Minute), 1},
+		{next.CreatedAt, 2},
+		{next.CreatedAt.Add(time.Hour), 2},
+	} {
+		active, err := repo.FindAt(c.at)
+		if err != nil || active.Version != c.version {
+			t.Errorf("FindAt(%v): expected version %d, got %+v, %v", c.at, c.version, active, err)
+		}
+	}
+
+	found, err := repo.FindByID(topos[1].ID.Hex())
+	if err != nil || found.ID != topos[1].ID || len(found.Hosts()) != 3 {
+		t.Errorf("FindByID: expected the second version, got %+v, %v", found, err)
+	}
+	if _, err := repo.FindByID(primitive.NewObjectID().Hex()); err != topology.ErrNotFound {
+		t.Errorf("FindByID: expected ErrNotFound, got %v", err)
+	}
+
+	// versions stored concurrently are numbered apart and created in the
+	// order of their numbers
+	var wg sync.WaitGroup
+	numbered := make(chan int, 8)
+	for i := 0; i < cap(numbered); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fixture := topologyFixture()
+			fixture.CreatedAt = time.Time{}
+			v, err := repo.Store(fixture)
+			if err != nil {
+				t.Errorf("Store: %v", err)
+			}
+			numbered <- v.Version
+		}()
+	}
+	wg.Wait()
+	close(numbered)
+	seen := make(map[int]bool)
+	for v := range numbered {
+		if v <= 2 || seen[v] {
+			t.Errorf("Store: expected a new version number, got %d", v)
+		}
+		seen[v] = true
+	}
+	topos, err = repo.FindAll()
+	if err != nil || len(topos) != 10 {
+		t.Fatalf("FindAll: expected 10 versions, got %d, %v", len(topos), err)
+	}
+	for i := 3; i < len(topos); i++ {
+		if topos[i].Version <= topos[i-1].Version || topos[i].CreatedAt.Before(topos[i-1].CreatedAt) {
+			t.Errorf("FindAll: expected the versions to be created in order, got %d at %v after %d at %v",
+				topos[i].Version, topos[i].CreatedAt, topos[i-1].Version, topos[i-1].CreatedAt)
+		}
+	}
+
+	if err := repo.DeleteAll(); err != nil {
+		t.Fatalf("DeleteAll: %v", err)
+	}
+	if c, err := repo.Count(); err != nil || c != 0 {
+		t.Errorf("expected an empty repository after DeleteAll, got %d, %v", c, err)
+	}
+	if _, err := repo.FindAt(time.Now()); err != topology.ErrNotFound {
+		t.Errorf("FindAt: expected ErrNotFound on an empty repository, got %v", err)
+	}
+}
+
+func testSMT(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.SMT
+
+	stored, err := repo.Store(smt.Property{Title: "reach", Text: "(assert true)"})
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if stored.ID.IsZero() {
+		t.Fatalf("Store: expected the stored property to have an ID")
+	}
+	if _, err := repo.Store(smt.Property{Title: "loop", Text: "(assert false)"}); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if c, err := repo.Count(); err != nil || c != 2 {
+		t.Fatalf("expected 2 properties, got %d, %v", c, err)
+	}
+
+	props, err := repo.FindAll()
+	if err != nil || len(props) != 2 {
+		t.Fatalf("FindAll: expected 2 properties, got %d, %v", len(props), err)
+	}
+
+	p, err := repo.FindByID(stored.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if p.ID != stored.ID || p.Title != "reach" || p.Text != "(assert true)" {
+		t.Errorf("property not stored as is: %+v", p)
+	}
+	if _, err := repo.FindByID(primitive.NewObjectID().Hex()); err != smt.ErrNotFound {
+		t.Errorf("FindByID: expected ErrNotFound for unknown ID, got %v", err)
+	}
+	if _, err := repo.FindByID("not-an-id"); err != smt.ErrNotFound {
+		t.Errorf("FindByID: expected ErrNotFound for invalid ID, got %v", err)
+	}
+
+	p.Text = "(assert (not false))"
+	if err := repo.Update(*p); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if p, err := repo.FindByID(stored.ID.Hex()); err != nil || p.Text != "(assert (not false))" {
+		t.Errorf("property not updated: %+v, %v", p, err)
+	}
+	if err := repo.Update(smt.Property{ID: primitive.NewObjectID()}); err != smt.ErrNotFound {
+		t.Errorf("Update: expected ErrNotFound for unknown ID, got %v", err)
+	}
+
+	if err := repo.Delete(stored.ID.Hex()); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Delete(stored.ID.Hex()); err != smt.ErrNotFound {
+		t.Errorf("Delete: expected ErrNotFound for deleted ID, got %v", err)
+	}
+	if props, err := repo.FindAll(); err != nil || len(props) != 1 || props[0].Title != "loop" {
+		t.Errorf("FindAll after Delete: expected the loop property only, got %+v, %v", props, err)
+	}
+}
+
+func flowTree(id, dstPort string, at time.Time) tree.FlowTree {
+	return tree.FlowTree{
+		ID:         id,
+		Type:       "TCP",
+		DstPort:    dstPort,
+		Nodes:      "digraph T { h1->s1; }",
+		CapturedAt: at.UnixNano(),
+		Level:      2,
+		Edges:      [][]tree.Edge{{{Src: "h1", Dst: "s1"}}},
+	}
+}
+
+func testTrees(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Trees
+
+	base := time.Date(2019, 3, 16, 17, 43, 26, 100, time.UTC)
+
+	a := flowTree("a", "80", base)
+	a.Results = []smt.Result{{
+		PropertyID:     primitive.NewObjectID(),
+		Verdict:        smt.Unsat,
+		SolverTime:     time.Millisecond,
+		Counterexample: &smt.Counterexample{Paths: []int{1}, Edges: []smt.EdgeRef{{Path: 1, Index: 1, Src: "h1", Dst: "s1"}}},
+	}}
+	for _, ft := range []tree.FlowTree{
+		a,
+		flowTree("b", "80", base.Add(time.Millisecond)),
+		flowTree("c", "8080", base.Add(2*time.Millisecond)),
+		flowTree("d", "80(http)", base.Add(time.Second)),
+	} {
+		if err := repo.Store(ft); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+	}
+
+	// storing a tree again replaces it
+	a.IsSat = true
+	if err := repo.Store(a); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if c, err := repo.Count(); err != nil || c != 4 {
+		t.Fatalf("expected 4 trees, got %d, %v", c, err)
+	}
+
+	ft, err := repo.FindByID("a")
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if !ft.IsSat || len(ft.Edges) != 1 || ft.Edges[0][0] != (tree.Edge{Src: "h1", Dst: "s1"}) {
+		t.Errorf("tree not stored as is: %+v", ft)
+	}
+	if len(ft.Results) != 1 || ft.Results[0].SolverTime != time.Millisecond ||
+		ft.Results[0].Counterexample == nil || ft.Results[0].Counterexample.Edges[0].Dst != "s1" {
+		t.Errorf("verification results not stored as is: %+v", ft.Results)
+	}
+	if _, err := repo.FindByID("unknown"); err != tree.ErrNotFound {
+		t.Errorf("FindByID: expected ErrNotFound, got %v", err)
+	}
+
+	trees, err := repo.FindAll()
+	if err != nil || len(trees) != 4 || trees[0].ID != "d" || trees[3].ID != "a" {
+		t.Errorf("FindAll: expected d, c, b, a, got %+v, %v", ids(trees), err)
+	}
+
+	page, err := repo.FindPage(tree.Query{Limit: 2})
+	if err != nil || len(page.Trees) != 2 || page.Trees[0].ID != "d" || page.Trees[1].ID != "c" || page.NextCursor == "" {
+		t.Fatalf("FindPage: expected d and c and a next page, got %v, %q, %v", ids(page.Trees), page.NextCursor, err)
+	}
+	cursor, err := tree.ParseCursor(page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err = repo.FindPage(tree.Query{Limit: 2, Cursor: cursor})
+	if err != nil || len(page.Trees) != 2 || page.Trees[0].ID != "b" || page.Trees[1].ID != "a" || page.NextCursor != "" {
+		t.Errorf("FindPage: expected b and a on the last page, got %v, %q, %v", ids(page.Trees), page.NextCursor, err)
+	}
+	if page.Trees[0].Nodes == "" {
+		t.Errorf("FindPage: expected whole trees, got %+v", page.Trees[0])
+	}
+	sat := true
+	for _, c := range []struct {
+		q    tree.Query
+		want string
+	}{
+		{tree.Query{DstPort: "80"}, "d b a"},
+		{tree.Query{From: base.Add(time.Millisecond), To: base.Add(time.Second)}, "c b"},
+		{tree.Query{Sat: &sat}, "a"},
+		{tree.Query{Type: "UDP"}, ""},
+	} {
+		c.q.Limit = 10
+		page, err := repo.FindPage(c.q)
+		if got := strings.Join(ids(page.Trees), " "); err != nil || got != c.want {
+			t.Errorf("FindPage %+v: expected %q, got %q, %v", c.q, c.want, got, err)
+		}
+	}
+
+	// the ports are matched with or without their service name
+	// the cursor and limit are ignored and the images left out
+	matching, err := repo.FindMatching(tree.Query{DstPort: "80", Limit: 1, Cursor: cursor})
+	if err != nil || len(matching) != 3 || matching[0].ID != "d" || matching[2].ID != "a" {
+		t.Fatalf("FindMatching: expected d, b, a, got %v, %v", ids(matching), err)
+	}
+	if m := matching[2]; m.Nodes != "" || len(m.Edges) != 1 || len(m.Results) != 1 {
+		t.Errorf("FindMatching: expected the tree without its DOT representation, got %+v", m)
+	}
+
+	group, err := repo.FindByGroup(a)
+	if err != nil || len(group) != 2 || group[0].ID != "a" || group[1].ID != "b" {
+		t.Errorf("FindByGroup: expected a and b, got %v, %v", ids(group), err)
+	}
+
+	merged := tree.NewMergedGraph("TCP 80")
+	merged.AddPaths("a", a.Edges)
+	view := a
+	view.Merged = merged
+	if err := repo.StoreGroup(a.Group(), []tree.FlowTree{view, group[1]}); err != nil {
+		t.Fatalf("StoreGroup: %v", err)
+	}
+	if err := repo.StoreGroup(a.Group(), []tree.FlowTree{view}); err != nil {
+		t.Fatalf("StoreGroup: %v", err)
+	}
+	d := flowTree("d", "80(http)", base.Add(time.Second))
+	if err := repo.StoreGroup(d.Group(), []tree.FlowTree{d}); err != nil {
+		t.Fatalf("StoreGroup: %v", err)
+	}
+
+	views, err := repo.FindGroups()
+	if err != nil || len(views) != 2 || views[0].ID != "d" || views[1].ID != "a" {
+		t.Fatalf("FindGroups: expected d and a, got %v, %v", ids(views), err)
+	}
+	if views[1].Merged == nil || len(views[1].Merged.Edges) != 1 || views[1].Merged.Edges[0].Payloads[0] != "a" {
+		t.Errorf("merged view not stored as is: %+v", views[1].Merged)
+	}
+}
+
+func testTreesSessions(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Trees
+
+	base := time.Date(2019, 3, 16, 17, 43, 26, 100, time.UTC)
+	a, b, c := flowTree("a", "80", base), flowTree("b", "80", base), flowTree("c", "80", base)
+	a.Session, b.Session = "s1", "s1"
+	for _, ft := range []tree.FlowTree{a, b, c} {
+		if err := repo.Store(ft); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+	}
+
+	// trees of hidden sessions are only found by session
+	q := tree.Query{Limit: 10}
+	q.Hide("s1")
+	if page, err := repo.FindPage(q); err != nil || len(page.Trees) != 1 || page.Trees[0].ID != "c" {
+		t.Errorf("FindPage: expected c only with s1 hidden, got %v, %v", ids(page.Trees), err)
+	}
+	q.Session = "s1"
+	if trees, err := repo.FindMatching(q); err != nil || len(trees) != 2 {
+		t.Errorf("FindMatching: expected the trees of s1, got %v, %v", ids(trees), err)
+	}
+
+	// trees of other sessions are not in the same group
+	if group, err := repo.FindByGroup(a); err != nil || len(group) != 2 || group[0].ID != "a" || group[1].ID != "b" {
+		t.Errorf("FindByGroup: expected a and b, got %v, %v", ids(group), err)
+	}
+	if group, err := repo.FindByGroup(c); err != nil || len(group) != 1 || group[0].ID != "c" {
+		t.Errorf("FindByGroup: expected c only, got %v, %v", ids(group), err)
+	}
+	if err := repo.StoreGroup(a.Group(), []tree.FlowTree{a}); err != nil {
+		t.Fatalf("StoreGroup: %v", err)
+	}
+	if err := repo.StoreGroup(c.Group(), []tree.FlowTree{c}); err != nil {
+		t.Fatalf("StoreGroup: %v", err)
+	}
+
+	if n, err := repo.DeleteBySession("s1"); err != nil || n != 2 {
+		t.Errorf("DeleteBySession: expected 2 trees deleted, got %d, %v", n, err)
+	}
+	if trees, err := repo.FindAll(); err != nil || len(trees) != 1 || trees[0].ID != "c" {
+		t.Errorf("FindAll: expected c only after DeleteBySession, got %v, %v", ids(trees), err)
+	}
+	if views, err := repo.FindGroups(); err != nil || len(views) != 1 || views[0].ID != "c" {
+		t.Errorf("FindGroups: expected the group of c only after DeleteBySession, got %v, %v", ids(views), err)
+	}
+}
+
+func testSessions(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Sessions
+
+	base := time.Date(2019, 3, 16, 17, 43, 26, 0, time.UTC)
+	second, err := repo.Store(session.Session{Name: "second", Status: session.Open, CreatedAt: base.Add(time.Second)})
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if second.ID.IsZero() {
+		t.Fatalf("Store: expected the stored session to have an ID")
+	}
+	first, err := repo.Store(session.Session{Name: "first", Status: session.Open, CreatedAt: base})
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if c, err := repo.Count(); err != nil || c != 2 {
+		t.Fatalf("expected 2 sessions, got %d, %v", c, err)
+	}
+
+	sessions, err := repo.FindAll()
+	if err != nil || len(sessions) != 2 || sessions[0].Name != "first" || sessions[1].Name != "second" {
+		t.Errorf("FindAll: expected the sessions sorted by creation time, got %+v, %v", sessions, err)
+	}
+
+	first.Archive(base.Add(time.Minute))
+	if err := repo.Update(first); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	s, err := repo.FindByID(first.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if s.Status != session.Archived || s.ClosedAt == nil || !s.ArchivedAt.Equal(base.Add(time.Minute)) {
+		t.Errorf("session not updated: %+v", s)
+	}
+	if open, err := repo.FindOpen(); err != nil || len(open) != 1 || open[0].ID != second.ID {
+		t.Errorf("FindOpen: expected the second session only, got %+v, %v", open, err)
+	}
+	if _, err := repo.FindByID("not-an-id"); err != session.ErrNotFound {
+		t.Errorf("FindByID: expected ErrNotFound for invalid ID, got %v", err)
+	}
+	if err := repo.Update(session.Session{ID: primitive.NewObjectID()}); err != session.ErrNotFound {
+		t.Errorf("Update: expected ErrNotFound for unknown ID, got %v", err)
+	}
+
+	if err := repo.Delete(first.ID.Hex()); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Delete(first.ID.Hex()); err != session.ErrNotFound {
+		t.Errorf("Delete: expected ErrNotFound for deleted ID, got %v", err)
+	}
+	if sessions, err := repo.FindAll(); err != nil || len(sessions) != 1 || sessions[0].ID != second.ID {
+		t.Errorf("FindAll after Delete: expected the second session only, got %+v, %v", sessions, err)
+	}
+}
+
+func ids(trees []tree.FlowTree) []string {
+	var ids []string
+	for _, ft := range trees {
+		ids = append(ids, ft.ID)
+	}
+	return ids
+}
+
+func topologyFixture() topology.Topology {
+	topo := topology.Legacy{
+		Hosts:    []string{"h1", "h2"},
+		Switches: []string{"s1"},
+		Links:    []string{"s1:h1-eth0", "s1:h2-eth0"},
+	}.Topology()
+	topo.DOT = "graph G { h1 -- s1; s1 -- h2; }"
+	topo.Version = 1
+	topo.CreatedAt = time.Date(2019, 3, 16, 17, 0, 0, 0, time.UTC)
+	return topo
+}
+
+func testRules(t *testing.T, f Factory) {
+	repos, done := f(t)
+	defer done()
+	repo := repos.Rules
+
+	s2 := rules.Table{
+		Switch: "s2",
+		Rules:  []rules.Rule{{Priority: 10, Match: rules.Match{DstIP: "10.0.0.0/24"}, Group: "all"}},
+		Groups: []rules.Group{{ID: "all", Ports: []string{"1", "2"}}},
+	}
+	s1 := rules.Table{Switch: "s1", Rules: []rules.Rule{{Drop: true}}}
+	for _, table := range []rules.Table{s2, s1} {
+		if err := repo.Store(table); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+	}
+	if c, err := repo.Count(); err != nil || c != 2 {
+		t.Fatalf("expected 2 tables, got %d, %v", c, err)
+	}
+
+	tables, err := repo.FindAll()
+	if err != nil || len(tables) != 2 || tables[0].Switch != "s1" || tables[1].Switch != "s2" {
+		t.Fatalf("FindAll: expected the tables of s1 and s2, got %+v, %v", tables, err)
+	}
+
+	got, err := repo.FindBySwitch("s2")
+	if err != nil {
+		t.Fatalf("FindBySwitch: %v", err)
+	}
+	if len(got.Rules) != 1 || got.Rules[0].Match.DstIP != "10.0.0.0/24" || got.Rules[0].Group != "all" ||
+		len(got.Groups) != 1 || len(got.Groups[0].Ports) != 2 {
+		t.Errorf("table not stored as is: %+v", got)
+	}
+	if _, err := repo.FindBySwitch("s9"); err != rules.ErrNotFound {
+		t.Errorf("FindBySwitch: expected ErrNotFound for unknown switch, got %v", err)
+	}
+
+	s1.Rules = []rules.Rule{{Output: []string{"2"}}}
+	if err := repo.Store(s1); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if got, err := repo.FindBySwitch("s1"); err != nil || len(got.Rules) != 1 || got.Rules[0].Drop {
+		t.Errorf("table not replaced: %+v, %v", got, err)
+	}
+	if c, err := repo.Count(); err != nil || c != 2 {
+		t.Errorf("expected 2 tables after replacing one, got %d, %v", c, err)
+	}
+
+	if err := repo.Delete("s1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Delete("s1"); err != rules.ErrNotFound {
+		t.Errorf("Delete: expected ErrNotFound for deleted switch, got %v", err)
+	}
+	if tables, err := repo.FindAll(); err != nil || len(tables) != 1 || tables[0].Switch != "s2" {
+		t.Errorf("FindAll after Delete: expected the s2 table only, got %+v, %v", tables, err)
+	}
+}
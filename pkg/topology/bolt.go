@@ -0,0 +1,83 @@
+package topology
+
+import (
+	"sync"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/db/bolt"
+	bbolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const topologyBucket = "topology"
+
+type boltRepo struct {
+	db *bbolt.DB
+	// lock serializes the numbering of the versions, the database is not
+	// shared with other processes
+	lock sync.Mutex
+}
+
+// NewBoltRepository returns a new Repository backed by an embedded BoltDB
+func NewBoltRepository(db *bbolt.DB) Repository {
+	return &boltRepo{db: db}
+}
+
+func (r *boltRepo) FindAll() ([]Topology, error) {
+	var t []Topology
+
+	err := bolt.ForEach(r.db, topologyBucket, func(_ string, decode func(interface{}) error) error {
+		var c Topology
+		if err := decode(&c); err != nil {
+			return err
+		}
+		t = append(t, c)
+		return nil
+	})
+	sortVersions(t)
+	return t, err
+}
+
+func (r *boltRepo) FindByID(id string) (*Topology, error) {
+	var t Topology
+	found, err := bolt.Get(r.db, topologyBucket, id, &t)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (r *boltRepo) FindAt(at time.Time) (*Topology, error) {
+	topos, err := r.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return ActiveAt(topos, at)
+}
+
+func (r *boltRepo) Store(t Topology) (Topology, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	topos, err := r.FindAll()
+	if err != nil {
+		return t, err
+	}
+	t.ID = primitive.NewObjectID()
+	t.Version = latestVersion(topos) + 1
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now().UTC()
+	}
+	return t, bolt.Put(r.db, topologyBucket, t.ID.Hex(), t)
+}
+
+func (r *boltRepo) DeleteAll() error {
+	return bolt.DeleteAll(r.db, topologyBucket)
+}
+
+func (r *boltRepo) Count() (int64, error) {
+	return bolt.Count(r.db, topologyBucket)
+}
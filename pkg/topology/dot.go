@@ -0,0 +1,118 @@
+package topology
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// shapes of the nodes in the DOT representation by kind
+var shapes = map[NodeKind]string{
+	Host:   "ellipse",
+	Switch: "box",
+	Router: "diamond",
+}
+
+// ToDOT returns the undirected DOT graph of the topology, links are
+// labeled with their bandwidth and latency when known
+func (t *Topology) ToDOT() string {
+	g := gographviz.NewGraph()
+	if err := g.SetName("topology"); err != nil {
+		log.Println(err)
+	}
+
+	for _, n := range t.Nodes {
+		attrs := map[string]string{"shape": shapes[n.Kind]}
+		if err := g.AddNode("topology", dotID(n.Name), attrs); err != nil {
+			log.Println(err)
+		}
+	}
+
+	for _, l := range t.Links {
+		attrs := make(map[string]string)
+		var label []string
+		if l.Bandwidth > 0 {
+			label = append(label, fmt.Sprintf("%gMbps", l.Bandwidth))
+		}
+		if l.Latency > 0 {
+			label = append(label, time.Duration(l.Latency).String())
+		}
+		if len(label) > 0 {
+			attrs["label"] = fmt.Sprintf("%q", strings.Join(label, " "))
+		}
+		if err := g.AddEdge(dotID(l.A.Node), dotID(l.B.Node), false, attrs); err != nil {
+			log.Println(err)
+		}
+	}
+	return g.String()
+}
+
+var plainID = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// dotID quotes the name when it is not a plain DOT identifier
+func dotID(s string) string {
+	if plainID.MatchString(s) {
+		return s
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+// importDOT imports a DOT graph, e.g. the one of ToDOT. The kind of the
+// nodes is given by their shape, see ToDOT, the ports of the edges by the
+// node:port syntax or the tailport and headport attributes, and their
+// bandwidth and latency by a label like 10Mbps 1.5ms.
+func importDOT(b []byte) (Topology, error) {
+	g, err := gographviz.Read(b)
+	if err != nil {
+		return Topology{}, err
+	}
+
+	kinds := make(map[string]NodeKind)
+	for k, shape := range shapes {
+		kinds[shape] = k
+	}
+
+	a := newAssembler()
+	for _, n := range g.Nodes.Nodes {
+		a.node(unquote(n.Name), kinds[unquote(n.Attrs["shape"])])
+	}
+
+	for i, e := range g.Edges.Edges {
+		link := Link{
+			A: Endpoint{Node: unquote(e.Src), Port: unquote(strings.TrimPrefix(e.SrcPort, ":"))},
+			B: Endpoint{Node: unquote(e.Dst), Port: unquote(strings.TrimPrefix(e.DstPort, ":"))},
+		}
+		if link.A.Port == "" {
+			link.A.Port = unquote(e.Attrs["tailport"])
+		}
+		if link.B.Port == "" {
+			link.B.Port = unquote(e.Attrs["headport"])
+		}
+
+		for _, f := range strings.Fields(unquote(e.Attrs["label"])) {
+			if strings.HasSuffix(f, "Mbps") {
+				link.Bandwidth, err = parseBandwidth(f)
+			} else {
+				link.Latency, err = parseLatency(f)
+			}
+			if err != nil {
+				return Topology{}, fmt.Errorf("edge %d: %v", i, err)
+			}
+		}
+		a.link(link)
+	}
+	return a.topology(), nil
+}
+
+// unquote returns the DOT identifier without its quotes
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
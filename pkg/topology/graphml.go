@@ -0,0 +1,118 @@
+package topology
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// graphML is a GraphML document, data elements refer to the keys
+// declaring their attribute name
+type graphML struct {
+	Keys []struct {
+		ID   string `xml:"id,attr"`
+		Name string `xml:"attr.name,attr"`
+	} `xml:"key"`
+	Graphs []struct {
+		Nodes []struct {
+			ID    string        `xml:"id,attr"`
+			Ports []graphMLPort `xml:"port"`
+			Data  []graphMLData `xml:"data"`
+		} `xml:"node"`
+		Edges []struct {
+			Source     string        `xml:"source,attr"`
+			Target     string        `xml:"target,attr"`
+			SourcePort string        `xml:"sourceport,attr"`
+			TargetPort string        `xml:"targetport,attr"`
+			Data       []graphMLData `xml:"data"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLPort struct {
+	Name string `xml:"name,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// importGraphML imports the first graph of a GraphML document. Nodes may
+// have kind and ip attributes, edges bandwidth in Mbit/s and latency
+// attributes. The ports of the edges are given by their sourceport and
+// targetport, or by source_port and target_port attributes.
+func importGraphML(b []byte) (Topology, error) {
+	var doc graphML
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return Topology{}, err
+	}
+	if len(doc.Graphs) == 0 {
+		return Topology{}, fmt.Errorf("no graph found")
+	}
+	graph := doc.Graphs[0]
+
+	// names maps the keys to their attribute name
+	names := make(map[string]string)
+	for _, k := range doc.Keys {
+		names[k.ID] = k.Name
+	}
+	attrs := func(data []graphMLData) map[string]string {
+		m := make(map[string]string)
+		for _, d := range data {
+			name := names[d.Key]
+			if name == "" {
+				name = d.Key
+			}
+			m[name] = strings.TrimSpace(d.Value)
+		}
+		return m
+	}
+
+	a := newAssembler()
+	for i, n := range graph.Nodes {
+		if n.ID == "" {
+			return Topology{}, fmt.Errorf("node %d has no id", i)
+		}
+		m := attrs(n.Data)
+		node := a.node(n.ID, parseKind(m["kind"]))
+		for _, ip := range strings.Split(m["ip"], ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				node.IPs = append(node.IPs, ip)
+			}
+		}
+		for _, p := range n.Ports {
+			a.port(n.ID, p.Name)
+		}
+	}
+
+	for i, e := range graph.Edges {
+		for _, n := range []string{e.Source, e.Target} {
+			if !a.has(n) {
+				return Topology{}, fmt.Errorf("dangling edge %d, node %q is not declared", i, n)
+			}
+		}
+		m := attrs(e.Data)
+		link := Link{A: Endpoint{Node: e.Source, Port: e.SourcePort}, B: Endpoint{Node: e.Target, Port: e.TargetPort}}
+		if link.A.Port == "" {
+			link.A.Port = m["source_port"]
+		}
+		if link.B.Port == "" {
+			link.B.Port = m["target_port"]
+		}
+
+		var err error
+		if v := m["bandwidth"]; v != "" {
+			if link.Bandwidth, err = parseBandwidth(v); err != nil {
+				return Topology{}, fmt.Errorf("edge %d: %v", i, err)
+			}
+		}
+		if v := m["latency"]; v != "" {
+			if link.Latency, err = parseLatency(v); err != nil {
+				return Topology{}, fmt.Errorf("edge %d: %v", i, err)
+			}
+		}
+		a.link(link)
+	}
+	return a.topology(), nil
+}
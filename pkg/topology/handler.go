@@ -5,28 +5,44 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
-	"github.com/letitbeat/dp-analyzer/pkg/dot"
+	"github.com/gorilla/mux"
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
 )
 
 // Handler implements topology operations
 type Handler struct {
-	repo Repository
+	repo        Repository
+	packetsRepo packets.Repository
 }
 
-// NewHandler returns a new topology Handler
-func NewHandler(repo Repository) *Handler {
-	return &Handler{repo}
+// NewHandler returns a new topology Handler, the topology is inferred from
+// the observations of packetsRepo
+func NewHandler(repo Repository, packetsRepo packets.Repository) *Handler {
+	return &Handler{repo, packetsRepo}
 }
 
-// Get HTTP GET handler which returns the data-plane topology
+// Get HTTP GET handler which returns the data-plane topology, i.e. its
+// latest version or the version active at the time given by the optional
+// at parameter in RFC 3339 format
 func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
 
 	enableCors(&response)
 
-	t, err := h.getTopology()
+	at := time.Now()
+	if v := request.URL.Query().Get("at"); v != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			writeStatus(response, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	t, err := h.repo.FindAt(at)
 	if err != nil {
 		writeErr(response, err)
+		return
 	}
 
 	err = json.NewEncoder(response).Encode(t)
@@ -35,60 +51,177 @@ func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
 	}
 }
 
-// Set HTTP POST handler which stores the data-plane topology
+// Set HTTP POST handler which stores a new version of the data-plane
+// topology. Its format is given by the format query parameter or by the
+// request media type, see FormatOf, and defaults to the structured or the
+// legacy JSON format. Its DOT representation is derived from its nodes and
+// links.
 func (h *Handler) Set(response http.ResponseWriter, request *http.Request) {
 
-	var topology Topology
+	var format Format
+	var err error
+	if name := request.URL.Query().Get("format"); name != "" {
+		if format, err = ParseFormat(name); err != nil {
+			writeStatus(response, http.StatusBadRequest, err)
+			return
+		}
+	} else if format, err = FormatOf(request.Header.Get("Content-Type")); err != nil {
+		writeStatus(response, http.StatusUnsupportedMediaType, err)
+		return
+	}
 
 	body, err := ioutil.ReadAll(request.Body)
 	if err != nil {
 		writeErr(response, err)
+		return
 	}
 
-	err = json.Unmarshal(body, &topology)
+	topology, err := Import(format, body)
+	if err != nil {
+		writeStatus(response, http.StatusBadRequest, err)
+		return
+	}
+
+	stored, err := NewVersion(h.repo, topology)
 	if err != nil {
 		writeErr(response, err)
 		return
 	}
 
-	dotStr, err := dot.Generate("topo.dot", topology.DOT)
+	response.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(response).Encode(stored.Info())
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Versions HTTP GET handler which returns the summaries of the topology
+// versions in creation order
+func (h *Handler) Versions(response http.ResponseWriter, request *http.Request) {
+
+	enableCors(&response)
+
+	topos, err := h.repo.FindAll()
 	if err != nil {
 		writeErr(response, err)
 		return
 	}
 
-	topology.DOTImg = dotStr
+	versions := []VersionInfo{}
+	for i := range topos {
+		versions = append(versions, topos[i].Info())
+	}
 
-	count, _ := h.repo.Count()
+	err = json.NewEncoder(response).Encode(versions)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
 
-	if count > 0 {
-		topo, err := h.repo.FindAll()
-		if err != nil {
-			writeErr(response, err)
-			return
-		}
-		topology.ID = topo[0].ID
-		h.repo.Update(topology)
+// Version HTTP GET handler which returns the topology version with the
+// given ID
+func (h *Handler) Version(response http.ResponseWriter, request *http.Request) {
+
+	enableCors(&response)
+
+	t, err := h.repo.FindByID(mux.Vars(request)["id"])
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(t)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Diff HTTP GET handler which returns the nodes and links added and
+// removed from the version given by the from parameter to the one given by
+// the to parameter, to defaults to the latest version
+func (h *Handler) Diff(response http.ResponseWriter, request *http.Request) {
+
+	enableCors(&response)
+
+	query := request.URL.Query()
+	if query.Get("from") == "" {
+		writeStatus(response, http.StatusBadRequest, fmt.Errorf("missing from version"))
+		return
+	}
+
+	from, err := h.repo.FindByID(query.Get("from"))
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	var to *Topology
+	if id := query.Get("to"); id != "" {
+		to, err = h.repo.FindByID(id)
 	} else {
-		err := h.repo.Store(topology)
-		if err != nil {
-			writeErr(response, err)
-			return
-		}
+		to, err = h.repo.FindAt(time.Now())
+	}
+	if err != nil {
+		writeErr(response, err)
+		return
 	}
 
-	err = json.NewEncoder(response).Encode(`{"success"}`)
+	err = json.NewEncoder(response).Encode(Compare(*from, *to))
 	if err != nil {
 		writeErr(response, err)
 	}
 }
 
-func (h Handler) getTopology() (*Topology, error) {
-	topos, err := h.repo.FindAll()
+// Infer HTTP GET handler which infers a candidate topology from the
+// observations captured between the optional from and to parameters in
+// RFC 3339 format, see Infer, and compares it with the topology version
+// active at the end of that range. With export=true only the candidate
+// topology is returned, ready to be reviewed and set.
+func (h *Handler) Infer(response http.ResponseWriter, request *http.Request) {
+
+	enableCors(&response)
+
+	var from, to time.Time
+	query := request.URL.Query()
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := query.Get(p.name); v != "" {
+			var err error
+			if *p.t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				writeStatus(response, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	pks, err := h.packetsRepo.FindInRange(from, to)
 	if err != nil {
-		return nil, err
+		writeErr(response, err)
+		return
+	}
+
+	at := to
+	if at.IsZero() {
+		at = time.Now()
+	}
+	declared, err := h.repo.FindAt(at)
+	if err != nil && err != ErrNotFound {
+		writeErr(response, err)
+		return
+	}
+
+	inf := Infer(pks, declared)
+	var v interface{} = inf
+	if query.Get("export") == "true" {
+		v = inf.Topology
+	}
+
+	err = json.NewEncoder(response).Encode(v)
+	if err != nil {
+		writeErr(response, err)
 	}
-	return &topos[0], nil
 }
 
 func enableCors(w *http.ResponseWriter) {
@@ -96,7 +229,15 @@ func enableCors(w *http.ResponseWriter) {
 }
 
 func writeErr(response http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == ErrNotFound {
+		status = http.StatusNotFound
+	}
+	writeStatus(response, status, err)
+}
+
+func writeStatus(response http.ResponseWriter, status int, err error) {
 	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
-	response.WriteHeader(http.StatusInternalServerError)
+	response.WriteHeader(status)
 	response.Write([]byte(msg))
 }
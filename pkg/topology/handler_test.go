@@ -0,0 +1,36 @@
+package topology
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	repo := NewMemoryRepository()
+	h := NewHandler(repo, nil)
+
+	for version := 1; version <= 2; version++ {
+		body := `{"hosts": ["h1", "h2"], "switches": ["s1"], "links": ["h1:s1-eth1", "h2:s1-eth2"]}`
+		request := httptest.NewRequest(http.MethodPost, "/topology", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		h.Set(recorder, request)
+		if recorder.Code != http.StatusCreated {
+			t.Fatalf("unexpected status %d, %s", recorder.Code, recorder.Body)
+		}
+
+		var info VersionInfo
+		if err := json.NewDecoder(recorder.Body).Decode(&info); err != nil {
+			t.Fatal(err)
+		}
+		if info.Version != version || info.Nodes != 3 || info.Links != 2 {
+			t.Errorf("expected the summary of version %d, got %+v", version, info)
+		}
+		if stored, err := repo.FindByID(info.ID); err != nil || stored.Version != version {
+			t.Errorf("expected version %d to be stored with ID %s, got %+v, %v", version, info.ID, stored, err)
+		}
+	}
+}
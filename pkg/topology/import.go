@@ -0,0 +1,228 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is a format topologies are imported from
+type Format string
+
+// Formats of the imported topologies
+const (
+	// FormatJSON is the structured or the legacy format, NetJSON network
+	// graphs are detected and imported as such
+	FormatJSON Format = "json"
+	// FormatMininet is the output of the Mininet net, links and dump
+	// commands
+	FormatMininet Format = "mininet"
+	// FormatNetJSON is a NetJSON NetworkGraph
+	FormatNetJSON Format = "netjson"
+	// FormatGraphML is a GraphML graph
+	FormatGraphML Format = "graphml"
+	// FormatDOT is a DOT graph, ports are given as node:port
+	FormatDOT Format = "dot"
+)
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatJSON, FormatMininet, FormatNetJSON, FormatGraphML, FormatDOT:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown topology format %q", name)
+}
+
+// FormatOf returns the format of a topology sent with the given media
+// type, JSON when it is empty
+func FormatOf(contentType string) (Format, error) {
+	if contentType == "" {
+		return FormatJSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+	switch mediaType {
+	case "application/json", "application/x-www-form-urlencoded":
+		// the latter is the default of clients like curl -d
+		return FormatJSON, nil
+	case "text/plain":
+		return FormatMininet, nil
+	case "application/graphml+xml", "application/xml", "text/xml":
+		return FormatGraphML, nil
+	case "text/vnd.graphviz":
+		return FormatDOT, nil
+	}
+	return "", fmt.Errorf("unsupported topology media type %s", mediaType)
+}
+
+// FormatOfFile returns the format of a topology file from its extension,
+// files without a known extension are Mininet dumps
+func FormatOfFile(name string) Format {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return FormatJSON
+	case ".graphml", ".xml":
+		return FormatGraphML
+	case ".dot", ".gv":
+		return FormatDOT
+	}
+	return FormatMininet
+}
+
+// Import converts a topology from the given format and validates it
+func Import(format Format, b []byte) (Topology, error) {
+	var t Topology
+	var err error
+	switch format {
+	case FormatJSON:
+		if isNetJSON(b) {
+			return Import(FormatNetJSON, b)
+		}
+		err = json.Unmarshal(b, &t)
+	case FormatMininet:
+		t, err = importMininet(b)
+	case FormatNetJSON:
+		t, err = importNetJSON(b)
+	case FormatGraphML:
+		t, err = importGraphML(b)
+	case FormatDOT:
+		t, err = importDOT(b)
+	default:
+		err = fmt.Errorf("unknown topology format %q", format)
+	}
+	if err != nil {
+		return Topology{}, fmt.Errorf("%s: %v", format, err)
+	}
+
+	if err := t.Validate(); err != nil {
+		return Topology{}, fmt.Errorf("%s: %v", format, err)
+	}
+	return t, nil
+}
+
+// assembler collects the nodes and links of an imported topology, the
+// ports of the links are added to their nodes
+type assembler struct {
+	nodes  map[string]*Node
+	order  []string
+	linked map[[2]Endpoint]bool
+	links  []Link
+}
+
+func newAssembler() *assembler {
+	return &assembler{nodes: make(map[string]*Node), linked: make(map[[2]Endpoint]bool)}
+}
+
+// node returns the node with the given name, adding it when missing. The
+// kind is only set when given, see topology for nodes without a kind.
+func (a *assembler) node(name string, kind NodeKind) *Node {
+	n, ok := a.nodes[name]
+	if !ok {
+		n = &Node{Name: name}
+		a.nodes[name] = n
+		a.order = append(a.order, name)
+	}
+	if kind != "" {
+		n.Kind = kind
+	}
+	return n
+}
+
+// has reports whether the node has been added
+func (a *assembler) has(name string) bool {
+	_, ok := a.nodes[name]
+	return ok
+}
+
+// port adds the port to the node when missing
+func (a *assembler) port(node, port string) {
+	n := a.node(node, "")
+	for _, p := range n.Ports {
+		if p.Name == port {
+			return
+		}
+	}
+	n.Ports = append(n.Ports, Port{Name: port})
+}
+
+// link adds the link and its ports, a link already added in either
+// direction is ignored
+func (a *assembler) link(l Link) {
+	if a.linked[l.key()] {
+		return
+	}
+	a.linked[l.key()] = true
+	for _, e := range []Endpoint{l.A, l.B} {
+		a.node(e.Node, "")
+		if e.Port != "" {
+			a.port(e.Node, e.Port)
+		}
+	}
+	a.links = append(a.links, l)
+}
+
+// topology returns the assembled topology, the kind of the nodes without
+// one is guessed from the Mininet naming: hosts start with h, routers
+// with r and switches with anything else
+func (a *assembler) topology() Topology {
+	var t Topology
+	for _, name := range a.order {
+		n := *a.nodes[name]
+		if n.Kind == "" {
+			n.Kind = guessKind(name)
+		}
+		t.Nodes = append(t.Nodes, n)
+	}
+	t.Links = a.links
+	return t
+}
+
+func guessKind(name string) NodeKind {
+	switch {
+	case strings.HasPrefix(name, "h"):
+		return Host
+	case strings.HasPrefix(name, "r"):
+		return Router
+	}
+	return Switch
+}
+
+// parseKind returns the kind with the given name, empty when unknown
+func parseKind(name string) NodeKind {
+	switch k := NodeKind(strings.ToLower(name)); k {
+	case Host, Switch, Router:
+		return k
+	}
+	return ""
+}
+
+// parseBandwidth parses a bandwidth in Mbit/s, e.g. 10 or 10Mbps
+func parseBandwidth(v string) (float64, error) {
+	v = strings.TrimSuffix(strings.TrimSpace(v), "Mbps")
+	bw, err := strconv.ParseFloat(v, 64)
+	if err != nil || bw < 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q", v)
+	}
+	return bw, nil
+}
+
+// parseLatency parses a latency given as a duration, e.g. 1.5ms, or as a
+// number of milliseconds like Mininet delays, it returns nanoseconds
+func parseLatency(v string) (int64, error) {
+	v = strings.TrimSpace(v)
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return int64(d), nil
+	}
+	ms, err := strconv.ParseFloat(v, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid latency %q", v)
+	}
+	return int64(ms * float64(time.Millisecond)), nil
+}
@@ -0,0 +1,184 @@
+package topology
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// summary describes the nodes and links of a topology in a compact form
+func summary(t Topology) string {
+	var parts []string
+	for _, n := range t.Nodes {
+		parts = append(parts, fmt.Sprintf("%s:%s%v", n.Name, n.Kind, n.IPs))
+	}
+	for _, l := range t.Links {
+		s := fmt.Sprintf("%s/%s-%s/%s", l.A.Node, l.A.Port, l.B.Node, l.B.Port)
+		if l.Bandwidth > 0 || l.Latency > 0 {
+			s += fmt.Sprintf("(%g,%d)", l.Bandwidth, l.Latency)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		want   string
+	}{
+		{
+			name:   "mininet net",
+			format: FormatMininet,
+			data: `mininet> net
+h1 h1-eth0:s1-eth1
+h2 h2-eth0:s2-eth2
+s1 lo:  s1-eth1:h1-eth0 s1-eth2:s2-eth1
+s2 lo:  s2-eth1:s1-eth2 s2-eth2:h2-eth0
+c0
+`,
+			want: "h1:host[] h2:host[] s1:switch[] s2:switch[] h1/h1-eth0-s1/s1-eth1 h2/h2-eth0-s2/s2-eth2 s1/s1-eth2-s2/s2-eth1",
+		},
+		{
+			name:   "mininet links and dump",
+			format: FormatMininet,
+			data: `<Host h1: h1-eth0:10.0.0.1 pid=4242>
+<OVSSwitch s1: lo:127.0.0.1,s1-eth1:None pid=4250>
+<Controller c0: 127.0.0.1:6653 pid=4230>
+h1-eth0<->s1-eth1 (OK OK)
+`,
+			want: "h1:host[10.0.0.1] s1:switch[] h1/h1-eth0-s1/s1-eth1",
+		},
+		{
+			name:   "mininet links only",
+			format: FormatMininet,
+			data:   "h1-eth0<->r1-eth1 (OK OK)\nr1-eth2<->s1-eth1 (OK OK)\n",
+			want:   "h1:host[] r1:router[] s1:switch[] h1/h1-eth0-r1/r1-eth1 r1/r1-eth2-s1/s1-eth1",
+		},
+		{
+			name:   "netjson",
+			format: FormatJSON,
+			data: `{"type": "NetworkGraph", "protocol": "static", "nodes": [
+				{"id": "h1", "local_addresses": ["10.0.0.1"]},
+				{"id": "sw", "properties": {"kind": "switch"}}],
+				"links": [{"source": "sw", "target": "h1", "cost": 1,
+				"properties": {"source_port": "sw-eth1", "bandwidth": 100, "latency": "2ms"}}]}`,
+			want: "h1:host[10.0.0.1] sw:switch[] sw/sw-eth1-h1/(100,2000000)",
+		},
+		{
+			name:   "graphml",
+			format: FormatGraphML,
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="d0" for="node" attr.name="kind" attr.type="string"/>
+  <key id="d1" for="node" attr.name="ip" attr.type="string"/>
+  <key id="d2" for="edge" attr.name="latency" attr.type="double"/>
+  <graph edgedefault="undirected">
+    <node id="h1"><data key="d1">10.0.0.1</data></node>
+    <node id="core"><data key="d0">router</data><port name="core-eth1"/></node>
+    <edge source="core" target="h1" sourceport="core-eth1"><data key="d2">1.5</data></edge>
+  </graph>
+</graphml>`,
+			want: "h1:host[10.0.0.1] core:router[] core/core-eth1-h1/(0,1500000)",
+		},
+		{
+			name:   "dot",
+			format: FormatDOT,
+			data:   `graph G { s1 [shape=box]; h1 [shape=ellipse]; s1:"s1-eth1" -- h1 [label="10Mbps 1.5ms"]; s1 -- s2 [tailport="s1-eth2", headport="s2-eth1"]; }`,
+			want:   "s1:switch[] h1:host[] s2:switch[] s1/s1-eth1-h1/(10,1500000) s1/s1-eth2-s2/s2-eth1",
+		},
+		{
+			name:   "legacy json",
+			format: FormatJSON,
+			data:   `{"hosts": ["h1"], "switches": ["s1"], "links": ["h1:s1-eth1"]}`,
+			want:   "h1:host[] s1:switch[] s1/s1-eth1-h1/",
+		},
+	}
+
+	for _, test := range tests {
+		topo, err := Import(test.format, []byte(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := summary(topo); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		err    string
+	}{
+		{
+			name:   "mininet dangling link",
+			format: FormatMininet,
+			data:   "h1 h1-eth0:s1-eth1\ns1 lo:  s1-eth1:h1-eth0 s1-eth2:s9-eth1\n",
+			err:    "mininet: line 2: dangling link s1-eth2-s9-eth1, s9 is not declared",
+		},
+		{
+			name:   "mininet interface of another node",
+			format: FormatMininet,
+			data:   "h1 s1-eth1:h1-eth0\n",
+			err:    "mininet: line 1: interface s1-eth1 does not belong to h1",
+		},
+		{
+			name:   "netjson dangling link",
+			format: FormatNetJSON,
+			data:   `{"type": "NetworkGraph", "nodes": [{"id": "h1"}], "links": [{"source": "h1", "target": "s1"}]}`,
+			err:    `netjson: dangling link 0, node "s1" is not declared`,
+		},
+		{
+			name:   "graphml dangling edge",
+			format: FormatGraphML,
+			data:   `<graphml><graph><node id="h1"/><edge source="h1" target="s1"/></graph></graphml>`,
+			err:    `graphml: dangling edge 0, node "s1" is not declared`,
+		},
+		{
+			name:   "dot invalid latency",
+			format: FormatDOT,
+			data:   `graph G { s1 -- h1 [label="fast"]; }`,
+			err:    `dot: edge 0: invalid latency "fast"`,
+		},
+		{
+			name:   "invalid topology",
+			format: FormatNetJSON,
+			data:   `{"type": "NetworkGraph", "nodes": [{"id": "h1", "local_addresses": ["10.0.0"]}]}`,
+			err:    "netjson: node h1 has an invalid IP 10.0.0",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Import(test.format, []byte(test.data))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: expected the error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]Format{
+		"":                                FormatJSON,
+		"application/json; charset=utf-8": FormatJSON,
+		"text/plain":                      FormatMininet,
+		"application/graphml+xml":         FormatGraphML,
+		"text/vnd.graphviz":               FormatDOT,
+	}
+	for contentType, want := range tests {
+		if f, err := FormatOf(contentType); err != nil || f != want {
+			t.Errorf("%q: expected %s, got %s, %v", contentType, want, f, err)
+		}
+	}
+	if _, err := FormatOf("image/png"); err == nil {
+		t.Error("expected an error for an unsupported media type")
+	}
+	if f := FormatOfFile("net.graphml"); f != FormatGraphML {
+		t.Errorf("expected graphml, got %s", f)
+	}
+}
@@ -0,0 +1,180 @@
+package topology
+
+import "sort"
+
+// maxPaths is the maximum number of equal-cost paths returned by
+// ShortestPaths
+const maxPaths = 16
+
+// Index holds the lookups of a topology, it is built once by Topology.Index
+// and does not follow later changes of the topology
+type Index struct {
+	nodes map[string]*Node
+	// peers holds the endpoint at the other end of the link of every port
+	peers map[string]Endpoint
+	// owners holds the node of every linked port
+	owners map[string]string
+	// links holds the links of every node
+	links map[string][]Link
+	// hosts maps the IP addresses to their host
+	hosts     map[string]string
+	neighbors map[string][]string
+}
+
+// Index returns the lookups of the topology
+func (t *Topology) Index() *Index {
+	x := &Index{
+		nodes:     make(map[string]*Node),
+		peers:     make(map[string]Endpoint),
+		owners:    make(map[string]string),
+		links:     make(map[string][]Link),
+		hosts:     make(map[string]string),
+		neighbors: make(map[string][]string),
+	}
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		x.nodes[n.Name] = n
+		if n.Kind == Host {
+			for _, ip := range n.IPs {
+				x.hosts[ip] = n.Name
+			}
+		}
+	}
+
+	seen := make(map[[2]string]bool)
+	for _, l := range t.Links {
+		if l.A.Port != "" {
+			x.peers[l.A.Port] = l.B
+			x.owners[l.A.Port] = l.A.Node
+		}
+		if l.B.Port != "" {
+			x.peers[l.B.Port] = l.A
+			x.owners[l.B.Port] = l.B.Node
+		}
+		x.links[l.A.Node] = append(x.links[l.A.Node], l)
+		x.links[l.B.Node] = append(x.links[l.B.Node], l)
+
+		for _, e := range [][2]string{{l.A.Node, l.B.Node}, {l.B.Node, l.A.Node}} {
+			if !seen[e] {
+				seen[e] = true
+				x.neighbors[e[0]] = append(x.neighbors[e[0]], e[1])
+			}
+		}
+	}
+	for _, ns := range x.neighbors {
+		sort.Strings(ns)
+	}
+	return x
+}
+
+// Node returns the node with the given name
+func (x *Index) Node(name string) (*Node, bool) {
+	n, ok := x.nodes[name]
+	return n, ok
+}
+
+// Peer returns the endpoint linked to the port
+func (x *Index) Peer(port string) (Endpoint, bool) {
+	e, ok := x.peers[port]
+	return e, ok
+}
+
+// Owner returns the node of the linked port
+func (x *Index) Owner(port string) (string, bool) {
+	n, ok := x.owners[port]
+	return n, ok
+}
+
+// HostByIP returns the host with the given IP address
+func (x *Index) HostByIP(ip string) (string, bool) {
+	h, ok := x.hosts[ip]
+	return h, ok
+}
+
+// Neighbors returns the nodes linked to the node sorted by name
+func (x *Index) Neighbors(node string) []string {
+	return x.neighbors[node]
+}
+
+// Ports returns the linked ports of the node sorted by name
+func (x *Index) Ports(node string) []string {
+	var ports []string
+	for _, l := range x.links[node] {
+		for _, e := range []Endpoint{l.A, l.B} {
+			if e.Node == node && e.Port != "" {
+				ports = append(ports, e.Port)
+			}
+		}
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// PortTo returns the port of the node linked to the neighbor, empty when
+// they are not linked or the port is not known
+func (x *Index) PortTo(node, neighbor string) string {
+	for _, l := range x.links[node] {
+		if l.A.Node == node && l.B.Node == neighbor && l.A.Port != "" {
+			return l.A.Port
+		}
+		if l.B.Node == node && l.A.Node == neighbor && l.B.Port != "" {
+			return l.B.Port
+		}
+	}
+	return ""
+}
+
+// Neighbors returns the nodes linked to every node of the topology
+func (t *Topology) Neighbors() map[string][]string {
+	return t.Index().neighbors
+}
+
+// ShortestPaths returns the equal-cost shortest paths from src to dst, up
+// to 16 of them, or none when dst is not reachable
+func (t *Topology) ShortestPaths(src, dst string) [][]string {
+	return t.Index().ShortestPaths(src, dst)
+}
+
+// ShortestPaths returns the equal-cost shortest paths from src to dst, up
+// to 16 of them, or none when dst is not reachable
+func (x *Index) ShortestPaths(src, dst string) [][]string {
+	// parents holds the predecessors of every node on its shortest paths
+	dist := map[string]int{src: 0}
+	parents := make(map[string][]string)
+	queue := []string{src}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range x.neighbors[n] {
+			d, ok := dist[m]
+			if !ok {
+				dist[m] = dist[n] + 1
+				queue = append(queue, m)
+			}
+			if !ok || d == dist[n]+1 {
+				parents[m] = append(parents[m], n)
+			}
+		}
+	}
+	if _, ok := dist[dst]; !ok {
+		return nil
+	}
+
+	var paths [][]string
+	var walk func(n string, suffix []string)
+	walk = func(n string, suffix []string) {
+		if len(paths) == maxPaths {
+			return
+		}
+		suffix = append([]string{n}, suffix...)
+		if n == src {
+			paths = append(paths, suffix)
+			return
+		}
+		for _, p := range parents[n] {
+			walk(p, suffix)
+		}
+	}
+	walk(dst, nil)
+	return paths
+}
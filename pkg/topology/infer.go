@@ -0,0 +1,225 @@
+package topology
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+// InferredLink is a link inferred from the observations, Votes counts the
+// votes of its ports supporting it and Share is their fraction among the
+// votes of its ports
+type InferredLink struct {
+	Link
+	Votes int     `json:"votes"`
+	Share float64 `json:"share"`
+}
+
+// Inference is a candidate topology inferred from the observations and
+// its differences with the declared topology, links are compared by the
+// nodes they connect. Payloads and Observations count the payload UIDs
+// and the observations used, the ones without payload UID or captured at
+// a port not named after its switch are left out.
+type Inference struct {
+	Payloads     int            `json:"payloads"`
+	Observations int            `json:"observations"`
+	Topology     Topology       `json:"topology"`
+	Links        []InferredLink `json:"links"`
+	// Undeclared are the inferred links the declared topology lacks
+	Undeclared []InferredLink `json:"undeclared"`
+	// Unobserved are the declared links not inferred, e.g. the links no
+	// packet went through
+	Unobserved []Link `json:"unobserved"`
+}
+
+// Infer infers a candidate topology from the observations. Observations
+// are captured at the ports of the switches, named after their switch, e.g.
+// s1-eth1. For every payload UID the observations are taken in capture
+// order and grouped into visits of a switch, the first observation of a
+// visit being at its ingress port and the following ones at its egress
+// ports. The ingress port of every visit votes for a link with the last
+// egress port of the previous visit not linked yet, or with the previous
+// switch when its egress was not captured, and the first one with the
+// source host. The egress ports leading to no visit vote for a link with
+// the destination host. Every port is linked as voted by the majority.
+//
+// Hosts are named after the declared host of their IP, or after their IP
+// for unicast addresses. The declared topology may be nil.
+func Infer(pks []packets.Packet, declared *Topology) Inference {
+	var index *Index
+	if declared != nil {
+		index = declared.Index()
+	}
+	hosts := make(map[string]string)
+	hostOf := func(ip string) string {
+		h, ok := "", false
+		if index != nil {
+			h, ok = index.HostByIP(ip)
+		}
+		if !ok {
+			if parsed := net.ParseIP(ip); parsed == nil || !parsed.IsGlobalUnicast() {
+				return ""
+			}
+			h = ip
+		}
+		hosts[h] = ip
+		return h
+	}
+
+	byPayload := make(map[string][]packets.Packet)
+	used := 0
+	for _, p := range pks {
+		if p.Payload == "" || portOwner(p.Device) == "" {
+			continue
+		}
+		byPayload[p.Payload] = append(byPayload[p.Payload], p)
+		used++
+	}
+
+	inf := Inference{Payloads: len(byPayload), Observations: used}
+	// votes counts the votes of every port per peer endpoint
+	votes := make(map[string]map[Endpoint]int)
+	total := make(map[string]int)
+	vote := func(port string, peer Endpoint) {
+		if votes[port] == nil {
+			votes[port] = make(map[Endpoint]int)
+		}
+		votes[port][peer]++
+		total[port]++
+	}
+
+	for _, obs := range byPayload {
+		sort.SliceStable(obs, func(i, j int) bool { return obs[i].CapturedAtNano < obs[j].CapturedAtNano })
+
+		// pending holds the egress ports not linked yet
+		var pending []string
+		prev := ""
+		for i, o := range obs {
+			sw := portOwner(o.Device)
+			if sw == prev {
+				pending = append(pending, o.Device)
+				continue
+			}
+
+			switch {
+			case i == 0:
+				if h := hostOf(o.SrcIP); h != "" {
+					vote(o.Device, Endpoint{Node: h})
+				}
+			case len(pending) > 0 && portOwner(pending[len(pending)-1]) == prev:
+				vote(o.Device, Endpoint{Node: prev, Port: pending[len(pending)-1]})
+				pending = pending[:len(pending)-1]
+			default:
+				vote(o.Device, Endpoint{Node: prev})
+			}
+			prev = sw
+		}
+
+		if h := hostOf(obs[0].DstIP); h != "" {
+			for _, port := range pending {
+				vote(port, Endpoint{Node: h})
+			}
+		}
+	}
+
+	// peers holds the endpoint each port is linked to
+	var ports []string
+	for port := range votes {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	peers := make(map[string]Endpoint)
+	for _, port := range ports {
+		var best Endpoint
+		for e, v := range votes[port] {
+			if b := votes[port][best]; v > b || (v == b && (e.Node < best.Node || (e.Node == best.Node && e.Port < best.Port))) {
+				best = e
+			}
+		}
+		peers[port] = best
+	}
+
+	a := newAssembler()
+	linked := make(map[string]bool)
+	for _, port := range ports {
+		if linked[port] {
+			continue
+		}
+		sw, peer := portOwner(port), peers[port]
+		a.node(sw, Switch)
+		if ip, ok := hosts[peer.Node]; ok {
+			a.node(peer.Node, Host).IPs = []string{ip}
+		} else {
+			a.node(peer.Node, Switch)
+		}
+
+		link := InferredLink{Link: Link{A: Endpoint{Node: sw, Port: port}, B: peer}}
+		link.Votes = votes[port][peer]
+		all := total[port]
+		if peer.Port == "" {
+			// the port of the peer is the one voting for this port
+			for _, back := range ports {
+				if !linked[back] && back != port && portOwner(back) == peer.Node && peers[back].Node == sw {
+					link.B.Port = back
+					break
+				}
+			}
+		}
+		if back := link.B.Port; back != "" && linked[back] {
+			// the port of the peer is linked elsewhere
+			link.B.Port = ""
+		} else if back != "" {
+			linked[back] = true
+			link.Votes += votes[back][Endpoint{Node: sw, Port: port}] + votes[back][Endpoint{Node: sw}]
+			all += total[back]
+		}
+		link.Share = float64(link.Votes) / float64(all)
+		linked[port] = true
+		a.link(link.Link)
+		inf.Links = append(inf.Links, link)
+	}
+	inf.Topology = a.topology()
+	inf.Topology.DOT = inf.Topology.ToDOT()
+
+	inf.Undeclared, inf.Unobserved = []InferredLink{}, []Link{}
+	declaredPairs := make(map[[2]string]bool)
+	if declared != nil {
+		for _, l := range declared.Links {
+			declaredPairs[pair(l)] = true
+		}
+	}
+	inferredPairs := make(map[[2]string]bool)
+	for _, l := range inf.Links {
+		inferredPairs[pair(l.Link)] = true
+		if !declaredPairs[pair(l.Link)] {
+			inf.Undeclared = append(inf.Undeclared, l)
+		}
+	}
+	if declared != nil {
+		for _, l := range declared.Links {
+			if !inferredPairs[pair(l)] {
+				inf.Unobserved = append(inf.Unobserved, l)
+			}
+		}
+	}
+	return inf
+}
+
+// portOwner returns the node a port is named after, e.g. s1 for s1-eth1,
+// empty when the port is not named after its node
+func portOwner(port string) string {
+	if i := strings.LastIndex(port, "-"); i > 0 {
+		return port[:i]
+	}
+	return ""
+}
+
+// pair returns the nodes connected by the link in a canonical order
+func pair(l Link) [2]string {
+	if l.B.Node < l.A.Node {
+		return [2]string{l.B.Node, l.A.Node}
+	}
+	return [2]string{l.A.Node, l.B.Node}
+}
@@ -0,0 +1,69 @@
+package topology
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+func TestInfer(t *testing.T) {
+	base := time.Date(2019, 3, 16, 17, 0, 0, 0, time.UTC)
+	var pks []packets.Packet
+	observe := func(payload, src, dst string, devices ...string) {
+		for _, d := range devices {
+			at := base.Add(time.Duration(len(pks)) * time.Millisecond)
+			pks = append(pks, packets.Packet{Device: d, Payload: payload, SrcIP: src, DstIP: dst, CapturedAt: &at, CapturedAtNano: at.UnixNano()})
+		}
+	}
+	// h1 -> s1 -> s2 -> h2 and back, captured at the ingress and egress
+	// ports, s2-eth1 is once seen alone
+	observe("a", "10.0.0.1", "10.0.0.2", "s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2")
+	observe("b", "10.0.0.1", "10.0.0.2", "s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2")
+	observe("c", "10.0.0.2", "10.0.0.1", "s2-eth2", "s2-eth1", "s1-eth2", "s1-eth1")
+	observe("d", "10.0.0.3", "224.0.0.1", "s2-eth1")
+	// observations without payload UID are left out
+	observe("", "10.0.0.1", "10.0.0.2", "s1-eth1")
+
+	// the declared topology lacks s2 and links s1 to a stale s3
+	declared := Legacy{
+		Links:     []string{"h1:s1-eth1", "s3:s1-eth2", "s1:s3-eth1"},
+		Addresses: map[string]string{"h1": "10.0.0.1"},
+	}.Topology()
+
+	inf := Infer(pks, &declared)
+	if inf.Payloads != 4 || inf.Observations != 13 {
+		t.Errorf("expected 4 payloads and 13 observations, got %d and %d", inf.Payloads, inf.Observations)
+	}
+
+	links := fmt.Sprint(inf.Links)
+	expected := "[{{{s1 s1-eth1} {h1 } 0 0} 3 1} {{{s1 s1-eth2} {s2 s2-eth1} 0 0} 3 0.75} {{{s2 s2-eth2} {10.0.0.2 } 0 0} 3 1}]"
+	if links != expected {
+		t.Errorf("expected the links %s, got %s", expected, links)
+	}
+	if err := inf.Topology.Validate(); err != nil {
+		t.Errorf("expected a valid candidate, got %v", err)
+	}
+	if ip := inf.Topology.Nodes[len(inf.Topology.Nodes)-1]; ip.Name != "10.0.0.2" || ip.Kind != Host {
+		t.Errorf("expected the unknown source to be a host named after its IP, got %+v", ip)
+	}
+
+	if len(inf.Undeclared) != 2 || inf.Undeclared[0].B.Node != "s2" || inf.Undeclared[1].A.Node != "s2" {
+		t.Errorf("unexpected undeclared links %+v", inf.Undeclared)
+	}
+	if len(inf.Unobserved) != 1 || inf.Unobserved[0].B.Node != "s3" {
+		t.Errorf("unexpected unobserved links %+v", inf.Unobserved)
+	}
+
+	if inf := Infer(pks, nil); len(inf.Undeclared) != 3 || len(inf.Unobserved) != 0 || inf.Topology.Nodes[1].Name != "10.0.0.1" {
+		t.Errorf("expected every link to be undeclared without topology, got %+v", inf)
+	}
+
+	// without egress captures the ports of the previous switches are unknown
+	pks = nil
+	observe("e", "10.0.0.1", "10.0.0.2", "s1-eth1", "s2-eth1")
+	if links := fmt.Sprint(Infer(pks, nil).Links); links != "[{{{s1 s1-eth1} {10.0.0.1 } 0 0} 1 1} {{{s2 s2-eth1} {s1 } 0 0} 1 1}]" {
+		t.Errorf("unexpected links from the ingress ports %s", links)
+	}
+}
@@ -0,0 +1,177 @@
+package topology
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Legacy is the former topology format, links are given as node:interface
+// strings, e.g. h1:s1-eth1 links h1 to the interface eth1 of s1, and the
+// addresses map the hosts to their IP.
+type Legacy struct {
+	Hosts     []string          `json:"hosts" bson:"hosts"`
+	Switches  []string          `json:"switches" bson:"switches"`
+	Links     []string          `json:"links" bson:"links"`
+	Addresses map[string]string `json:"addresses,omitempty" bson:"addresses,omitempty"`
+}
+
+// Topology converts the legacy topology. The two directions of a link
+// between switches, e.g. s2:s1-eth2 and s1:s2-eth1, become a single link.
+// The nodes not listed as hosts or switches are switches when they own an
+// interface and hosts otherwise.
+func (l Legacy) Topology() Topology {
+	var t Topology
+
+	// half is a legacy link, the port of owner linked to node
+	type half struct {
+		node, owner, port string
+		used              bool
+	}
+	var halves []*half
+	for _, s := range l.Links {
+		parts := strings.SplitN(s, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		halves = append(halves, &half{node: parts[0], owner: strings.Split(parts[1], "-")[0], port: parts[1]})
+	}
+
+	for i, h := range halves {
+		if h.used {
+			continue
+		}
+		h.used = true
+		link := Link{A: Endpoint{Node: h.owner, Port: h.port}, B: Endpoint{Node: h.node}}
+		for _, o := range halves[i+1:] {
+			if !o.used && o.owner == h.node && o.node == h.owner {
+				o.used = true
+				link.B.Port = o.port
+				break
+			}
+		}
+		t.Links = append(t.Links, link)
+	}
+
+	nodes := make(map[string]*Node)
+	var order []string
+	add := func(name string, kind NodeKind) {
+		if _, ok := nodes[name]; ok {
+			return
+		}
+		nodes[name] = &Node{Name: name, Kind: kind}
+		order = append(order, name)
+	}
+	for _, h := range l.Hosts {
+		add(h, Host)
+	}
+	for _, s := range l.Switches {
+		add(s, Switch)
+	}
+	for _, h := range halves {
+		add(h.owner, Switch)
+	}
+	for _, h := range halves {
+		add(h.node, Host)
+	}
+
+	for _, link := range t.Links {
+		for _, e := range []Endpoint{link.A, link.B} {
+			if e.Port != "" {
+				nodes[e.Node].Ports = append(nodes[e.Node].Ports, Port{Name: e.Port})
+			}
+		}
+	}
+	for h, ip := range l.Addresses {
+		if n, ok := nodes[h]; ok {
+			n.IPs = append(n.IPs, ip)
+		}
+	}
+
+	for _, name := range order {
+		t.Nodes = append(t.Nodes, *nodes[name])
+	}
+	return t
+}
+
+// UnmarshalJSON decodes a topology given either in the structured or in
+// the legacy format
+func (t *Topology) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	links := fields["links"]
+	delete(fields, "links")
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	type structured Topology
+	if err := json.Unmarshal(rest, (*structured)(t)); err != nil {
+		return err
+	}
+	if len(links) == 0 || string(links) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(links, &t.Links); err == nil {
+		return nil
+	}
+
+	var legacy Legacy
+	if err := json.Unmarshal(rest, &legacy); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(links, &legacy.Links); err != nil {
+		return err
+	}
+	t.fromLegacy(legacy)
+	return nil
+}
+
+// UnmarshalBSON decodes a topology stored either in the structured or in
+// the legacy format
+func (t *Topology) UnmarshalBSON(b []byte) error {
+	var w struct {
+		ID         primitive.ObjectID `bson:"_id"`
+		Version    int                `bson:"version"`
+		CreatedAt  time.Time          `bson:"created_at"`
+		Nodes      []Node             `bson:"nodes"`
+		Links      bson.RawValue      `bson:"links"`
+		Routes     []Route            `bson:"routes"`
+		DOT        string             `bson:"dot"`
+		DOTImg     string             `bson:"dot_img"`
+		DOTImgType string             `bson:"dot_img_type"`
+		Hosts      []string           `bson:"hosts"`
+		Switches   []string           `bson:"switches"`
+		Addresses  map[string]string  `bson:"addresses"`
+	}
+	if err := bson.Unmarshal(b, &w); err != nil {
+		return err
+	}
+
+	*t = Topology{ID: w.ID, Version: w.Version, CreatedAt: w.CreatedAt, Nodes: w.Nodes, Routes: w.Routes, DOT: w.DOT, DOTImg: w.DOTImg, DOTImgType: w.DOTImgType}
+	if w.Links.Type == 0 {
+		return nil
+	}
+	if err := w.Links.Unmarshal(&t.Links); err == nil {
+		return nil
+	}
+	legacy := Legacy{Hosts: w.Hosts, Switches: w.Switches, Addresses: w.Addresses}
+	if err := w.Links.Unmarshal(&legacy.Links); err != nil {
+		return err
+	}
+	t.fromLegacy(legacy)
+	return nil
+}
+
+// fromLegacy replaces the nodes and links with the ones of the legacy
+// topology
+func (t *Topology) fromLegacy(l Legacy) {
+	c := l.Topology()
+	t.Nodes, t.Links = c.Nodes, c.Links
+}
@@ -0,0 +1,101 @@
+package topology
+
+import (
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryRepo struct {
+	lock  sync.RWMutex
+	topos []Topology
+}
+
+// NewMemoryRepository returns a new thread-safe in-memory Repository
+func NewMemoryRepository() Repository {
+	return &memoryRepo{}
+}
+
+func (r *memoryRepo) FindAll() ([]Topology, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var t []Topology
+	for _, c := range r.topos {
+		t = append(t, clone(c))
+	}
+	sortVersions(t)
+	return t, nil
+}
+
+func (r *memoryRepo) FindByID(id string) (*Topology, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, c := range r.topos {
+		if c.ID.Hex() == id {
+			t := clone(c)
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryRepo) FindAt(at time.Time) (*Topology, error) {
+	topos, err := r.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return ActiveAt(topos, at)
+}
+
+func (r *memoryRepo) Store(t Topology) (Topology, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	t.ID = primitive.NewObjectID()
+	t.Version = latestVersion(r.topos) + 1
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now().UTC()
+	}
+	r.topos = append(r.topos, clone(t))
+	return t, nil
+}
+
+func (r *memoryRepo) DeleteAll() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.topos = nil
+	return nil
+}
+
+func (r *memoryRepo) Count() (int64, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return int64(len(r.topos)), nil
+}
+
+// clone returns a copy of t which does not share its slices
+func clone(t Topology) Topology {
+	nodes := make([]Node, len(t.Nodes))
+	for i, n := range t.Nodes {
+		n.IPs = append([]string(nil), n.IPs...)
+		n.MACs = append([]string(nil), n.MACs...)
+		n.Ports = append([]Port(nil), n.Ports...)
+		nodes[i] = n
+	}
+	t.Nodes = nodes
+	t.Links = append([]Link(nil), t.Links...)
+	if t.Routes != nil {
+		routes := make([]Route, len(t.Routes))
+		for i, r := range t.Routes {
+			r.Via = append([]string(nil), r.Via...)
+			routes[i] = r
+		}
+		t.Routes = routes
+	}
+	return t
+}
@@ -0,0 +1,153 @@
+package topology
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dumpLine matches the lines of the Mininet dump command, e.g.
+// <Host h1: h1-eth0:10.0.0.1 pid=4242>
+var dumpLine = regexp.MustCompile(`^<(\w+) ([^:\s]+): ?(.*?) pid=\d+>$`)
+
+// importMininet imports the output of the Mininet net, links and dump
+// commands, in any combination. The net command lists the interfaces of
+// every node and their peers, switches also listing their loopback, e.g.
+//
+//	h1 h1-eth0:s1-eth1
+//	s1 lo:  s1-eth1:h1-eth0 s1-eth2:s2-eth1
+//
+// the links command lists every link, e.g. h1-eth0<->s1-eth1 (OK OK), and
+// the dump command gives the class and the addresses of every node.
+// Interfaces are named after their node, e.g. s1-eth1 belongs to s1. When
+// nodes are declared by the net or dump commands, links between undeclared
+// nodes are rejected.
+func importMininet(b []byte) (Topology, error) {
+	a := newAssembler()
+	declared := make(map[string]bool)
+
+	// pending are the links checked once every node has been declared
+	type pending struct {
+		line int
+		link Link
+	}
+	var links []pending
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mininet>") {
+			continue
+		}
+
+		if m := dumpLine.FindStringSubmatch(line); m != nil {
+			kind := dumpKind(m[1])
+			if kind == "" {
+				// controllers are not part of the data plane
+				continue
+			}
+			declared[m[2]] = true
+			n := a.node(m[2], kind)
+			for _, intf := range strings.Split(m[3], ",") {
+				parts := strings.SplitN(intf, ":", 2)
+				if parts[0] == "" || parts[0] == "lo" {
+					continue
+				}
+				a.port(m[2], parts[0])
+				if len(parts) == 2 && parts[1] != "None" && parts[1] != "" && kind == Host {
+					n.IPs = append(n.IPs, parts[1])
+				}
+			}
+			continue
+		}
+
+		if strings.Contains(line, "<->") {
+			fields := strings.Fields(line)
+			ends := strings.SplitN(fields[0], "<->", 2)
+			l, err := mininetLink(ends[0], ends[1])
+			if err != nil {
+				return Topology{}, fmt.Errorf("line %d: %v", i, err)
+			}
+			links = append(links, pending{i, l})
+			continue
+		}
+
+		fields := strings.Fields(line)
+		node := fields[0]
+		var intfs []string
+		kind := Host
+		for _, f := range fields[1:] {
+			if f == "lo:" {
+				kind = Switch
+				continue
+			}
+			intfs = append(intfs, f)
+		}
+		if len(intfs) == 0 && kind == Host {
+			// controllers are listed without interfaces
+			continue
+		}
+		declared[node] = true
+		if n := a.node(node, ""); n.Kind == "" {
+			n.Kind = kind
+		}
+		for _, intf := range intfs {
+			ends := strings.SplitN(intf, ":", 2)
+			if len(ends) != 2 || ends[0] == "" {
+				return Topology{}, fmt.Errorf("line %d: unexpected interface %q of %s", i, intf, node)
+			}
+			if ends[1] == "" {
+				a.port(node, ends[0])
+				continue
+			}
+			l, err := mininetLink(ends[0], ends[1])
+			if err != nil {
+				return Topology{}, fmt.Errorf("line %d: %v", i, err)
+			}
+			if l.A.Node != node {
+				return Topology{}, fmt.Errorf("line %d: interface %s does not belong to %s", i, ends[0], node)
+			}
+			links = append(links, pending{i, l})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Topology{}, err
+	}
+
+	for _, p := range links {
+		for _, e := range []Endpoint{p.link.A, p.link.B} {
+			if len(declared) > 0 && !declared[e.Node] {
+				return Topology{}, fmt.Errorf("line %d: dangling link %s-%s, %s is not declared", p.line, p.link.A.Port, p.link.B.Port, e.Node)
+			}
+		}
+		a.link(p.link)
+	}
+	return a.topology(), nil
+}
+
+// mininetLink returns the link between two interfaces
+func mininetLink(a, b string) (Link, error) {
+	l := Link{A: Endpoint{Port: a}, B: Endpoint{Port: b}}
+	for _, e := range []*Endpoint{&l.A, &l.B} {
+		if e.Node = portOwner(e.Port); e.Node == "" {
+			return Link{}, fmt.Errorf("interface %q is not named after its node", e.Port)
+		}
+	}
+	return l, nil
+}
+
+// dumpKind returns the kind of the nodes of a Mininet class, empty for
+// controllers
+func dumpKind(class string) NodeKind {
+	switch {
+	case strings.Contains(class, "Controller"):
+		return ""
+	case strings.Contains(class, "Router"):
+		return Router
+	case strings.Contains(class, "Switch"), strings.Contains(class, "Bridge"):
+		return Switch
+	}
+	return Host
+}
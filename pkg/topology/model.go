@@ -1,13 +1,219 @@
 package topology
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"fmt"
+	"net"
+	"time"
 
-// Topology represents a data-plane topology
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Topology represents a version of the data-plane topology, versions are
+// immutable and active from their creation until the next one is created
 type Topology struct {
-	ID       primitive.ObjectID `json:"id" bson:"_id"`
-	Hosts    []string           `json:"hosts" bson:"hosts"`
-	Switches []string           `json:"switches" bson:"switches"`
-	Links    []string           `json:"links" bson:"links"`
-	DOT      string             `json:"dot" bson:"dot"`
-	DOTImg   string             `json:"dot_img" bson:"dot_img"`
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// Version numbers the versions from 1 in creation order
+	Version   int       `json:"version" bson:"version"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	Nodes     []Node    `json:"nodes" bson:"nodes"`
+	Links     []Link    `json:"links" bson:"links"`
+	// Routes are the routing policies the expected paths follow, flows
+	// without a route follow the shortest paths
+	Routes []Route `json:"routes,omitempty" bson:"routes,omitempty"`
+	// DOT is derived from the nodes and links, see ToDOT
+	DOT    string `json:"dot" bson:"dot"`
+	DOTImg string `json:"dot_img" bson:"dot_img"`
+	// DOTImgType is the media type of DOTImg
+	DOTImgType string `json:"dot_img_type" bson:"dot_img_type"`
+}
+
+// NodeKind is the kind of a topology node
+type NodeKind string
+
+// Kinds of nodes
+const (
+	Host   NodeKind = "host"
+	Switch NodeKind = "switch"
+	Router NodeKind = "router"
+)
+
+// Node is a host, switch or router of the topology
+type Node struct {
+	Name  string   `json:"name" bson:"name"`
+	Kind  NodeKind `json:"kind" bson:"kind"`
+	IPs   []string `json:"ips,omitempty" bson:"ips,omitempty"`
+	MACs  []string `json:"macs,omitempty" bson:"macs,omitempty"`
+	Ports []Port   `json:"ports,omitempty" bson:"ports,omitempty"`
+}
+
+// Port is a network interface of a node, its name is the device the
+// observations are captured at, e.g. s1-eth1
+type Port struct {
+	Name string `json:"name" bson:"name"`
+	MAC  string `json:"mac,omitempty" bson:"mac,omitempty"`
+}
+
+// Endpoint is one end of a link, Port is empty when the interface of the
+// node is not known, e.g. for hosts of topologies imported from the legacy
+// format
+type Endpoint struct {
+	Node string `json:"node" bson:"node"`
+	Port string `json:"port,omitempty" bson:"port,omitempty"`
+}
+
+// Link connects two nodes
+type Link struct {
+	A Endpoint `json:"a" bson:"a"`
+	B Endpoint `json:"b" bson:"b"`
+	// Bandwidth is the capacity of the link in Mbit/s
+	Bandwidth float64 `json:"bandwidth,omitempty" bson:"bandwidth,omitempty"`
+	// Latency is the propagation delay of the link in nanoseconds
+	Latency int64 `json:"latency,omitempty" bson:"latency,omitempty"`
+}
+
+// Route is a routing policy, the flows from Src to Dst to the given
+// destination port go through the Via nodes in order. Empty fields match
+// any flow.
+type Route struct {
+	Src  string   `json:"src,omitempty" bson:"src,omitempty"`
+	Dst  string   `json:"dst,omitempty" bson:"dst,omitempty"`
+	Port string   `json:"port,omitempty" bson:"port,omitempty"`
+	Via  []string `json:"via" bson:"via"`
+}
+
+// Node returns the node with the given name
+func (t *Topology) Node(name string) (*Node, bool) {
+	for i := range t.Nodes {
+		if t.Nodes[i].Name == name {
+			return &t.Nodes[i], true
+		}
+	}
+	return nil, false
+}
+
+// Hosts returns the names of the hosts
+func (t *Topology) Hosts() []string {
+	return t.names(func(n *Node) bool { return n.Kind == Host })
+}
+
+// Switches returns the names of the switches and routers
+func (t *Topology) Switches() []string {
+	return t.names(func(n *Node) bool { return n.Kind != Host })
+}
+
+func (t *Topology) names(keep func(n *Node) bool) []string {
+	var names []string
+	for i := range t.Nodes {
+		if keep(&t.Nodes[i]) {
+			names = append(names, t.Nodes[i].Name)
+		}
+	}
+	return names
+}
+
+// HostByIP returns the host with the given IP address
+func (t *Topology) HostByIP(ip string) (string, bool) {
+	for _, n := range t.Nodes {
+		if n.Kind != Host {
+			continue
+		}
+		for _, a := range n.IPs {
+			if a == ip {
+				return n.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// IsHost reports whether the node is one of the topology hosts
+func (t *Topology) IsHost(name string) bool {
+	n, ok := t.Node(name)
+	return ok && n.Kind == Host
+}
+
+// IsSwitch reports whether the node forwards packets, i.e. is one of the
+// topology switches or routers
+func (t *Topology) IsSwitch(name string) bool {
+	n, ok := t.Node(name)
+	return ok && (n.Kind == Switch || n.Kind == Router)
+}
+
+// Validate checks the nodes are unique and well formed and the links and
+// routes only refer to them
+func (t *Topology) Validate() error {
+	nodes := make(map[string]*Node)
+	ports := make(map[string]string)
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		if n.Name == "" {
+			return fmt.Errorf("node %d has no name", i)
+		}
+		if nodes[n.Name] != nil {
+			return fmt.Errorf("duplicated node %s", n.Name)
+		}
+		nodes[n.Name] = n
+
+		if n.Kind != Host && n.Kind != Switch && n.Kind != Router {
+			return fmt.Errorf("node %s has an invalid kind %q", n.Name, n.Kind)
+		}
+		for _, ip := range n.IPs {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("node %s has an invalid IP %s", n.Name, ip)
+			}
+		}
+		for _, mac := range n.MACs {
+			if _, err := net.ParseMAC(mac); err != nil {
+				return fmt.Errorf("node %s has an invalid MAC %s", n.Name, mac)
+			}
+		}
+		for _, p := range n.Ports {
+			if p.Name == "" {
+				return fmt.Errorf("node %s has a port without name", n.Name)
+			}
+			if owner, ok := ports[p.Name]; ok {
+				return fmt.Errorf("port %s of %s already belongs to %s", p.Name, n.Name, owner)
+			}
+			ports[p.Name] = n.Name
+			if p.MAC != "" {
+				if _, err := net.ParseMAC(p.MAC); err != nil {
+					return fmt.Errorf("port %s has an invalid MAC %s", p.Name, p.MAC)
+				}
+			}
+		}
+	}
+
+	linked := make(map[string]bool)
+	for i, l := range t.Links {
+		if l.A.Node == l.B.Node {
+			return fmt.Errorf("link %d connects %s to itself", i, l.A.Node)
+		}
+		for _, e := range []Endpoint{l.A, l.B} {
+			if nodes[e.Node] == nil {
+				return fmt.Errorf("link %d refers to the unknown node %q", i, e.Node)
+			}
+			if e.Port == "" {
+				continue
+			}
+			if ports[e.Port] != e.Node {
+				return fmt.Errorf("link %d refers to the unknown port %s of %s", i, e.Port, e.Node)
+			}
+			if linked[e.Port] {
+				return fmt.Errorf("port %s is linked more than once", e.Port)
+			}
+			linked[e.Port] = true
+		}
+		if l.Bandwidth < 0 || l.Latency < 0 {
+			return fmt.Errorf("link %d has a negative bandwidth or latency", i)
+		}
+	}
+
+	for i, r := range t.Routes {
+		for _, n := range append([]string{r.Src, r.Dst}, r.Via...) {
+			if n != "" && nodes[n] == nil {
+				return fmt.Errorf("route %d refers to the unknown node %q", i, n)
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,89 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// networkGraph is a NetJSON NetworkGraph, the kind of the nodes and the
+// ports, bandwidth and latency of the links are taken from their
+// properties
+type networkGraph struct {
+	Type  string `json:"type"`
+	Nodes []struct {
+		ID             string                 `json:"id"`
+		LocalAddresses []string               `json:"local_addresses"`
+		Properties     map[string]interface{} `json:"properties"`
+	} `json:"nodes"`
+	Links []struct {
+		Source     string                 `json:"source"`
+		Target     string                 `json:"target"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"links"`
+}
+
+// isNetJSON reports whether the JSON document is a NetJSON NetworkGraph
+func isNetJSON(b []byte) bool {
+	var g struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(b, &g) == nil && g.Type == "NetworkGraph"
+}
+
+// importNetJSON imports a NetJSON NetworkGraph. Nodes may have a kind
+// property, links source_port, target_port, bandwidth in Mbit/s and
+// latency properties.
+func importNetJSON(b []byte) (Topology, error) {
+	var g networkGraph
+	if err := json.Unmarshal(b, &g); err != nil {
+		return Topology{}, err
+	}
+	if g.Type != "NetworkGraph" {
+		return Topology{}, fmt.Errorf("unexpected type %q, expected a NetworkGraph", g.Type)
+	}
+
+	a := newAssembler()
+	for i, n := range g.Nodes {
+		if n.ID == "" {
+			return Topology{}, fmt.Errorf("node %d has no id", i)
+		}
+		node := a.node(n.ID, parseKind(property(n.Properties, "kind")))
+		node.IPs = append(node.IPs, n.LocalAddresses...)
+	}
+
+	for i, l := range g.Links {
+		for _, n := range []string{l.Source, l.Target} {
+			if !a.has(n) {
+				return Topology{}, fmt.Errorf("dangling link %d, node %q is not declared", i, n)
+			}
+		}
+		link := Link{
+			A: Endpoint{Node: l.Source, Port: property(l.Properties, "source_port")},
+			B: Endpoint{Node: l.Target, Port: property(l.Properties, "target_port")},
+		}
+		var err error
+		if v := property(l.Properties, "bandwidth"); v != "" {
+			if link.Bandwidth, err = parseBandwidth(v); err != nil {
+				return Topology{}, fmt.Errorf("link %d: %v", i, err)
+			}
+		}
+		if v := property(l.Properties, "latency"); v != "" {
+			if link.Latency, err = parseLatency(v); err != nil {
+				return Topology{}, fmt.Errorf("link %d: %v", i, err)
+			}
+		}
+		a.link(link)
+	}
+	return a.topology(), nil
+}
+
+// property returns the property as a string, empty when missing
+func property(props map[string]interface{}, name string) string {
+	switch v := props[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
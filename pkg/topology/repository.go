@@ -2,10 +2,13 @@ package topology
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -13,35 +16,66 @@ import (
 // Repository defines the methods to be implemented by
 // the storage layer.
 type Repository interface {
-	// FindAll returns all the topology objects from storage
+	// FindAll returns all the topology versions from storage sorted in
+	// creation order
 	FindAll() ([]Topology, error)
-	// Store stores a new topology object
-	Store(t Topology) error
-	// Update updates a topology
-	Update(t Topology) error
+	// FindByID returns the topology version with the given ID or
+	// ErrNotFound
+	FindByID(id string) (*Topology, error)
+	// FindAt returns the topology version active at the given time, the
+	// first version for times predating every version, or ErrNotFound when
+	// no topology has been set
+	FindAt(at time.Time) (*Topology, error)
+	// Store stores a new topology version numbered after the latest one
+	// and returns it along with its new ID and version number. A version
+	// without creation time is created now, once numbered, so that the
+	// versions are created in the order of their numbers.
+	Store(t Topology) (Topology, error)
 	// DeleteAll deletes all the stored objects
 	DeleteAll() error
-	// Count counts the topology objects stored
+	// Count counts the topology versions stored
 	Count() (int64, error)
 }
 
+// ErrNotFound is returned when the requested topology version does not
+// exist
+var ErrNotFound = errors.New("topology not found")
+
 type repo struct {
-	client *mongo.Client
+	db *mongo.Database
+}
+
+// NewRepository returns a new mongo Repository storing into the given database
+func NewRepository(db *mongo.Database) Repository {
+	r := &repo{db}
+	r.ensureIndexes()
+	return r
 }
 
-// NewRepository returns a new mongo Repository
-func NewRepository(c *mongo.Client) Repository {
+// ensureIndexes creates the unique index of the version numbers, the
+// versions stored before versioning are numbered 0 and left out
+func (r *repo) ensureIndexes() {
+	collection := r.db.Collection("topology")
 
-	return &repo{c}
+	model := mongo.IndexModel{
+		Keys: bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "version", Value: bson.D{{Key: "$gt", Value: 0}}}}),
+	}
+	if _, err := collection.Indexes().CreateOne(context.Background(), model); err != nil {
+		log.Printf("error creating topology indexes, %v", err)
+	}
 }
 
 func (r *repo) FindAll() ([]Topology, error) {
 	var t []Topology
 
-	collection := r.client.Database("analyzer").Collection("topology")
+	collection := r.db.Collection("topology")
 
 	ctx := context.Background()
-	cursor, err := collection.Find(ctx, bson.D{})
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "version", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
 	if err != nil {
 		return t, err
 	}
@@ -59,49 +93,108 @@ func (r *repo) FindAll() ([]Topology, error) {
 	return t, nil
 }
 
-func (r *repo) Store(t Topology) error {
+func (r *repo) FindByID(id string) (*Topology, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	collection := r.db.Collection("topology")
 
-	collection := r.client.Database("analyzer").Collection("topology")
+	var t Topology
+	err = collection.FindOne(context.Background(), bson.M{"_id": oid}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
 
-	t.ID = primitive.NewObjectID()
-	_, err := collection.InsertOne(context.Background(), t)
+func (r *repo) FindAt(at time.Time) (*Topology, error) {
+	collection := r.db.Collection("topology")
+	ctx := context.Background()
 
+	var t Topology
+	latest := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "version", Value: -1}})
+	err := collection.FindOne(ctx, bson.M{"created_at": bson.M{"$lte": at}}, latest).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		// at predates every version, the first one is used
+		first := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "version", Value: 1}})
+		err = collection.FindOne(ctx, bson.D{}, first).Decode(&t)
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		log.Printf("error storing topology, %v", err)
-		return err
+		return nil, err
 	}
-	return nil
+	return &t, nil
 }
 
-func (r *repo) Update(t Topology) error {
-	collection := r.client.Database("analyzer").Collection("topology")
-
-	filter := bson.M{"_id": t.ID}
-	update := bson.D{{"$set",
-		bson.D{
-			{"hosts", t.Hosts},
-			{"switches", t.Switches},
-			{"links", t.Links},
-			{"dot", t.DOT},
-			{"dot_img", t.DOTImg},
-		},
-	}}
-	_, err := collection.UpdateOne(context.Background(), filter, update)
+// storeAttempts bounds the attempts to number a new version, a version
+// numbered the same by another writer is rejected by the unique index
+const storeAttempts = 5
+
+func (r *repo) Store(t Topology) (Topology, error) {
+
+	collection := r.db.Collection("topology")
+	ctx := context.Background()
+
+	latest := options.FindOne().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetProjection(bson.D{{Key: "version", Value: 1}})
+
+	now := t.CreatedAt.IsZero()
+	var err error
+	for i := 0; i < storeAttempts; i++ {
+		var last Topology
+		err = collection.FindOne(ctx, bson.D{}, latest).Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return t, err
+		}
+
+		// the creation time is taken again on every attempt, a version
+		// losing its number to a concurrent one is created after it
+		t.ID = primitive.NewObjectID()
+		t.Version = last.Version + 1
+		if now {
+			t.CreatedAt = time.Now().UTC()
+		}
+		if _, err = collection.InsertOne(ctx, t); !isDuplicateKey(err) {
+			break
+		}
+	}
 
 	if err != nil {
-		log.Printf("error updating topology, %v", err)
-		return err
+		log.Printf("error storing topology, %v", err)
+		return t, err
+	}
+	return t, nil
+}
+
+// isDuplicateKey reports whether err is the violation of a unique index
+func isDuplicateKey(err error) bool {
+	we, ok := err.(mongo.WriteException)
+	if !ok {
+		return false
+	}
+	for _, e := range we.WriteErrors {
+		if e.Code == 11000 {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
 func (r *repo) DeleteAll() error {
-	collection := r.client.Database("analyzer").Collection("topology")
+	collection := r.db.Collection("topology")
 	return collection.Drop(nil)
 }
 
 func (r *repo) Count() (int64, error) {
-	collection := r.client.Database("analyzer").Collection("topology")
+	collection := r.db.Collection("topology")
 	count, err := collection.EstimatedDocumentCount(context.Background())
 
 	if err != nil {
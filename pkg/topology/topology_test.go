@@ -0,0 +1,174 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var legacy = Legacy{
+	Hosts:     []string{"h1", "h2"},
+	Switches:  []string{"s1", "s2"},
+	Links:     []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"},
+	Addresses: map[string]string{"h1": "10.0.0.1", "h2": "10.0.0.2"},
+}
+
+func TestLegacy(t *testing.T) {
+	topo := legacy.Topology()
+
+	links := fmt.Sprint(topo.Links)
+	expected := "[{{s1 s1-eth1} {h1 } 0 0} {{s1 s1-eth2} {s2 s2-eth1} 0 0} {{s2 s2-eth2} {h2 } 0 0}]"
+	if links != expected {
+		t.Errorf("expected the links %s, got %s", expected, links)
+	}
+	if strings.Join(topo.Hosts(), ",") != "h1,h2" || strings.Join(topo.Switches(), ",") != "s1,s2" {
+		t.Errorf("unexpected nodes %+v", topo.Nodes)
+	}
+	if h, ok := topo.HostByIP("10.0.0.2"); !ok || h != "h2" {
+		t.Errorf("expected h2 to own 10.0.0.2, got %s", h)
+	}
+	if err := topo.Validate(); err != nil {
+		t.Errorf("expected a valid topology, got %v", err)
+	}
+
+	// nodes not listed are inferred from the links
+	inferred := Legacy{Links: legacy.Links}.Topology()
+	if strings.Join(inferred.Hosts(), ",") != "h1,h2" || strings.Join(inferred.Switches(), ",") != "s1,s2" {
+		t.Errorf("unexpected inferred nodes %+v", inferred.Nodes)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var old Topology
+	if err := json.Unmarshal([]byte(`{"hosts":["h1","h2"],"switches":["s1","s2"],
+		"links":["h1:s1-eth1","s2:s1-eth2","s1:s2-eth1","h2:s2-eth2"],
+		"addresses":{"h1":"10.0.0.1","h2":"10.0.0.2"}}`), &old); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(old.Nodes, old.Links) != fmt.Sprint(legacy.Topology().Nodes, legacy.Topology().Links) {
+		t.Errorf("legacy topology not converted: %+v", old)
+	}
+
+	var topo Topology
+	if err := json.Unmarshal([]byte(`{"nodes":[{"name":"h1","kind":"host"},{"name":"r1","kind":"router","ports":[{"name":"r1-eth1"}]}],
+		"links":[{"a":{"node":"r1","port":"r1-eth1"},"b":{"node":"h1"},"bandwidth":100,"latency":2000000}]}`), &topo); err != nil {
+		t.Fatal(err)
+	}
+	if len(topo.Links) != 1 || topo.Links[0].Bandwidth != 100 || !topo.IsSwitch("r1") || !topo.IsHost("h1") {
+		t.Errorf("structured topology not decoded: %+v", topo)
+	}
+
+	b, err := bson.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Topology
+	if err := bson.Unmarshal(b, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Links) != 3 || len(stored.Hosts()) != 2 {
+		t.Errorf("legacy document not converted: %+v", stored)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []Topology{
+		{Nodes: []Node{{Name: "h1"}}},
+		{Nodes: []Node{{Name: "h1", Kind: Host}, {Name: "h1", Kind: Host}}},
+		{Nodes: []Node{{Name: "h1", Kind: Host, IPs: []string{"10.0.0"}}}},
+		{Nodes: []Node{{Name: "h1", Kind: Host}}, Links: []Link{{A: Endpoint{Node: "h1"}, B: Endpoint{Node: "s1"}}}},
+		{
+			Nodes: []Node{{Name: "h1", Kind: Host}, {Name: "s1", Kind: Switch}},
+			Links: []Link{{A: Endpoint{Node: "s1", Port: "s1-eth1"}, B: Endpoint{Node: "h1"}}},
+		},
+		{Nodes: []Node{{Name: "h1", Kind: Host}}, Routes: []Route{{Via: []string{"s9"}}}},
+	}
+	for i, topo := range invalid {
+		if err := topo.Validate(); err == nil {
+			t.Errorf("expected topology %d to be invalid", i)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	topo := legacy.Topology()
+	x := topo.Index()
+
+	if e, ok := x.Peer("s1-eth2"); !ok || e.Node != "s2" || e.Port != "s2-eth1" {
+		t.Errorf("expected s1-eth2 to be linked to s2-eth1, got %+v", e)
+	}
+	if e, ok := x.Peer("s1-eth1"); !ok || e.Node != "h1" {
+		t.Errorf("expected s1-eth1 to be linked to h1, got %+v", e)
+	}
+	if n := strings.Join(x.Neighbors("s1"), ","); n != "h1,s2" {
+		t.Errorf("expected the neighbors h1,s2, got %s", n)
+	}
+	if p := strings.Join(x.Ports("s1"), ","); p != "s1-eth1,s1-eth2" {
+		t.Errorf("expected the ports of s1, got %s", p)
+	}
+	if p := x.PortTo("s2", "s1"); p != "s2-eth1" {
+		t.Errorf("expected s2-eth1, got %s", p)
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	topo := legacy.Topology()
+	topo.Links[1].Bandwidth = 10
+	topo.Links[1].Latency = 1500000
+
+	dot := topo.ToDOT()
+	for _, s := range []string{"h1 [ shape=ellipse ]", "s1 [ shape=box ]", `s1--s2[ label="10Mbps 1.5ms" ]`} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("expected %s in %s", s, dot)
+		}
+	}
+}
+
+func TestVersions(t *testing.T) {
+	base := time.Date(2019, 3, 16, 17, 0, 0, 0, time.UTC)
+	v1 := legacy.Topology()
+	v1.Version, v1.CreatedAt = 1, base
+	v2 := Legacy{Links: []string{"h1:s1-eth1", "s3:s1-eth2", "s1:s3-eth1", "h2:s3-eth2"}}.Topology()
+	v2.Version, v2.CreatedAt = 2, base.Add(time.Hour)
+
+	topos := []Topology{v2, v1}
+	sortVersions(topos)
+	for _, c := range []struct {
+		at      time.Time
+		version int
+	}{
+		{base.Add(-time.Hour), 1},
+		{base, 1},
+		{base.Add(time.Hour - 1), 1},
+		{base.Add(time.Hour), 2},
+	} {
+		if v, err := ActiveAt(topos, c.at); err != nil || v.Version != c.version {
+			t.Errorf("expected version %d at %v, got %+v, %v", c.version, c.at, v, err)
+		}
+	}
+	if _, err := ActiveAt(nil, base); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound without versions, got %v", err)
+	}
+
+	d := Compare(v1, v2)
+	if len(d.AddedNodes) != 1 || d.AddedNodes[0].Name != "s3" || len(d.RemovedNodes) != 1 || d.RemovedNodes[0].Name != "s2" {
+		t.Errorf("unexpected node differences %+v, %+v", d.AddedNodes, d.RemovedNodes)
+	}
+	if len(d.AddedLinks) != 2 || len(d.RemovedLinks) != 2 || d.RemovedLinks[0].B.Node != "s2" {
+		t.Errorf("unexpected link differences %+v, %+v", d.AddedLinks, d.RemovedLinks)
+	}
+
+	// links are compared regardless of their direction
+	reversed := v1
+	reversed.Links = []Link{}
+	for _, l := range v1.Links {
+		reversed.Links = append(reversed.Links, Link{A: l.B, B: l.A})
+	}
+	if d := Compare(v1, reversed); len(d.AddedLinks) != 0 || len(d.RemovedLinks) != 0 {
+		t.Errorf("expected no differences, got %+v", d)
+	}
+}
@@ -0,0 +1,146 @@
+package topology
+
+import (
+	"sort"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/dot"
+)
+
+// NewVersion stores the topology as a new version, numbered and created
+// now by the repository, its DOT representation is derived from its nodes
+// and links
+func NewVersion(repo Repository, t Topology) (Topology, error) {
+	t.DOT = t.ToDOT()
+	img, mime, err := dot.Generate(t.DOT)
+	if err != nil {
+		return t, err
+	}
+	t.DOTImg = img
+	t.DOTImgType = mime
+	t.CreatedAt = time.Time{}
+
+	return repo.Store(t)
+}
+
+// VersionInfo summarizes a topology version
+type VersionInfo struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Nodes     int       `json:"nodes"`
+	Links     int       `json:"links"`
+}
+
+// Info returns the summary of the version
+func (t *Topology) Info() VersionInfo {
+	return VersionInfo{
+		ID:        t.ID.Hex(),
+		Version:   t.Version,
+		CreatedAt: t.CreatedAt,
+		Nodes:     len(t.Nodes),
+		Links:     len(t.Links),
+	}
+}
+
+// latestVersion returns the highest version number of topos, 0 when empty
+func latestVersion(topos []Topology) int {
+	latest := 0
+	for _, t := range topos {
+		if t.Version > latest {
+			latest = t.Version
+		}
+	}
+	return latest
+}
+
+// sortVersions sorts the versions in creation order, versions stored
+// before versioning have no creation time and come first
+func sortVersions(topos []Topology) {
+	sort.SliceStable(topos, func(i, j int) bool {
+		if !topos[i].CreatedAt.Equal(topos[j].CreatedAt) {
+			return topos[i].CreatedAt.Before(topos[j].CreatedAt)
+		}
+		return topos[i].Version < topos[j].Version
+	})
+}
+
+// ActiveAt returns the version active at the given time among the versions
+// sorted in creation order, i.e. the last one created at or before it. The
+// first version is returned for times predating every version.
+func ActiveAt(topos []Topology, at time.Time) (*Topology, error) {
+	if len(topos) == 0 {
+		return nil, ErrNotFound
+	}
+	i := sort.Search(len(topos), func(i int) bool { return topos[i].CreatedAt.After(at) })
+	if i == 0 {
+		return &topos[0], nil
+	}
+	return &topos[i-1], nil
+}
+
+// Diff holds the nodes and links added and removed between two versions,
+// links are identified by their endpoints regardless of their direction
+type Diff struct {
+	From         VersionInfo `json:"from"`
+	To           VersionInfo `json:"to"`
+	AddedNodes   []Node      `json:"added_nodes"`
+	RemovedNodes []Node      `json:"removed_nodes"`
+	AddedLinks   []Link      `json:"added_links"`
+	RemovedLinks []Link      `json:"removed_links"`
+}
+
+// Compare returns the differences from the version from to the version to
+func Compare(from, to Topology) Diff {
+	d := Diff{
+		From:         from.Info(),
+		To:           to.Info(),
+		AddedNodes:   []Node{},
+		RemovedNodes: []Node{},
+		AddedLinks:   []Link{},
+		RemovedLinks: []Link{},
+	}
+
+	before := make(map[string]bool)
+	for _, n := range from.Nodes {
+		before[n.Name] = true
+	}
+	after := make(map[string]bool)
+	for _, n := range to.Nodes {
+		after[n.Name] = true
+		if !before[n.Name] {
+			d.AddedNodes = append(d.AddedNodes, n)
+		}
+	}
+	for _, n := range from.Nodes {
+		if !after[n.Name] {
+			d.RemovedNodes = append(d.RemovedNodes, n)
+		}
+	}
+
+	linked := make(map[[2]Endpoint]bool)
+	for _, l := range from.Links {
+		linked[l.key()] = true
+	}
+	remain := make(map[[2]Endpoint]bool)
+	for _, l := range to.Links {
+		remain[l.key()] = true
+		if !linked[l.key()] {
+			d.AddedLinks = append(d.AddedLinks, l)
+		}
+	}
+	for _, l := range from.Links {
+		if !remain[l.key()] {
+			d.RemovedLinks = append(d.RemovedLinks, l)
+		}
+	}
+	return d
+}
+
+// key returns the endpoints of the link in a canonical order
+func (l Link) key() [2]Endpoint {
+	if l.B.Node < l.A.Node || (l.B.Node == l.A.Node && l.B.Port < l.A.Port) {
+		return [2]Endpoint{l.B, l.A}
+	}
+	return [2]Endpoint{l.A, l.B}
+}
@@ -0,0 +1,164 @@
+package tree
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+// AnomalyType is the kind of an Anomaly
+type AnomalyType string
+
+// Anomalies found in flow trees
+const (
+	// LoopAnomaly is a device showing up more than once on a root to leaf
+	// path
+	LoopAnomaly AnomalyType = "loop"
+	// DropAnomaly is a leaf switch the packet entered but never left
+	DropAnomaly AnomalyType = "drop"
+	// BlackHoleAnomaly is a leaf switch the packet was sent to but never
+	// observed entering
+	BlackHoleAnomaly AnomalyType = "black_hole"
+	// MisdeliveryAnomaly is a leaf host other than the one of the
+	// destination IP
+	MisdeliveryAnomaly AnomalyType = "misdelivery"
+	// DisconnectedAnomaly is an observation that could not be attached to
+	// the tree
+	DisconnectedAnomaly AnomalyType = "disconnected"
+)
+
+// Hop is a node of a flow tree along with the time it was observed at
+type Hop struct {
+	Node  string `json:"node" bson:"node"`
+	Label string `json:"label" bson:"label"`
+	// Interfaces are the devices the packet was observed at on this node
+	Interfaces []string `json:"interfaces,omitempty" bson:"interfaces,omitempty"`
+	// At is the time of ingress, or of egress when the ingress was not
+	// observed, in Unix nanoseconds
+	At int64 `json:"at" bson:"at"`
+}
+
+// Anomaly is an abnormal behaviour found in a flow tree
+type Anomaly struct {
+	Type        AnomalyType `json:"type" bson:"type"`
+	Description string      `json:"description" bson:"description"`
+	// Switch is the switch the anomaly is attributed to
+	Switch string `json:"switch,omitempty" bson:"switch,omitempty"`
+	// Hops is the node sequence involved, for loops it starts and ends at
+	// the repeated device, for leaf anomalies it goes from the root to the
+	// leaf
+	Hops []Hop `json:"hops" bson:"hops"`
+}
+
+// newHop returns the hop of a node
+func newHop(n *Node) Hop {
+	h := Hop{Node: n.Name, Label: n.Label, Interfaces: n.Interfaces}
+	if !n.TimeOfIngress.IsZero() {
+		h.At = n.TimeOfIngress.UnixNano()
+	} else if !n.TimeOfEgress.IsZero() {
+		h.At = n.TimeOfEgress.UnixNano()
+	}
+	return h
+}
+
+// checkLeaves classifies the leaves of the tree against the topology, a
+// leaf switch is either a drop or a black hole and a leaf host other than
+// the one of the destination IP a misdelivery. Hosts are only checked when
+// the destination IP is a unicast address of the topology.
+func (b *builder) checkLeaves() []Anomaly {
+	topo := b.g.topo
+	dst, known := topo.HostByIP(b.ft.DstIP)
+	if ip := net.ParseIP(b.ft.DstIP); ip == nil || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		known = false
+	}
+
+	var anomalies []Anomaly
+	for _, path := range b.tree.DFS(b.tree.Root) {
+		leaf := path[0]
+		if leaf == b.tree.Root {
+			continue
+		}
+
+		var hops []Hop
+		for i := len(path) - 1; i >= 0; i-- {
+			hops = append(hops, newHop(path[i]))
+		}
+
+		switch {
+		case topo.IsSwitch(leaf.Label) && !leaf.TimeOfIngress.IsZero():
+			anomalies = append(anomalies, Anomaly{
+				Type:        DropAnomaly,
+				Description: fmt.Sprintf("packet dropped at %s", leaf.Label),
+				Switch:      leaf.Label,
+				Hops:        hops,
+			})
+		case topo.IsSwitch(leaf.Label):
+			anomalies = append(anomalies, Anomaly{
+				Type:        BlackHoleAnomaly,
+				Description: fmt.Sprintf("packet sent by %s never reached %s", leaf.Parent.Label, leaf.Label),
+				Switch:      leaf.Label,
+				Hops:        hops,
+			})
+		case known && topo.IsHost(leaf.Label) && leaf.Label != dst:
+			anomalies = append(anomalies, Anomaly{
+				Type:        MisdeliveryAnomaly,
+				Description: fmt.Sprintf("packet for %s (%s) delivered to %s", dst, b.ft.DstIP, leaf.Label),
+				Switch:      leaf.Parent.Label,
+				Hops:        hops,
+			})
+		}
+	}
+	return anomalies
+}
+
+// disconnected records an observation that could not be attached to the tree
+func (b *builder) disconnected(p packets.Packet, device string) {
+	at := time.Time{}
+	if p.CapturedAt != nil {
+		at = *p.CapturedAt
+	}
+	b.ft.Anomalies = append(b.ft.Anomalies, Anomaly{
+		Type:        DisconnectedAnomaly,
+		Description: fmt.Sprintf("observation at %s not connected to the tree", p.Device),
+		Switch:      device,
+		Hops:        []Hop{{Node: device, Label: device, Interfaces: []string{p.Device}, At: at.UnixNano()}},
+	})
+}
+
+// AnomalySummary holds the number of anomalies found in a set of flow
+// trees, in total and per switch
+type AnomalySummary struct {
+	// Trees is the number of trees checked
+	Trees int `json:"trees"`
+	// Anomalous is the number of trees with at least one anomaly
+	Anomalous int                            `json:"anomalous"`
+	Totals    map[AnomalyType]int            `json:"totals"`
+	Switches  map[string]map[AnomalyType]int `json:"switches"`
+}
+
+// Summarize counts the anomalies of the given trees
+func Summarize(trees []FlowTree) AnomalySummary {
+	s := AnomalySummary{
+		Trees:    len(trees),
+		Totals:   make(map[AnomalyType]int),
+		Switches: make(map[string]map[AnomalyType]int),
+	}
+	for _, ft := range trees {
+		if len(ft.Anomalies) > 0 {
+			s.Anomalous++
+		}
+		for _, a := range ft.Anomalies {
+			s.Totals[a.Type]++
+			if a.Switch == "" {
+				continue
+			}
+			if s.Switches[a.Switch] == nil {
+				s.Switches[a.Switch] = make(map[AnomalyType]int)
+			}
+			s.Switches[a.Switch][a.Type]++
+		}
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func TestLeafAnomalies(t *testing.T) {
+	g := NewGenerator(topology.Legacy{
+		Hosts:     []string{"h1", "h2", "h3"},
+		Switches:  []string{"s1", "s2"},
+		Links:     []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2", "h3:s1-eth3"},
+		Addresses: map[string]string{"h1": "10.0.0.1", "h2": "10.0.0.2", "h3": "10.0.0.3"},
+	}.Topology(), nil, nil, nil)
+
+	tests := []struct {
+		name    string
+		dstIP   string
+		devices []string
+		want    AnomalyType
+		sw      string
+	}{
+		{"delivered", "10.0.0.2", []string{"s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2"}, "", ""},
+		{"drop", "10.0.0.2", []string{"s1-eth1", "s1-eth2", "s2-eth1"}, DropAnomaly, "s2"},
+		{"black hole", "10.0.0.2", []string{"s1-eth1", "s1-eth2"}, BlackHoleAnomaly, "s2"},
+		{"misdelivery", "10.0.0.2", []string{"s1-eth1", "s1-eth3"}, MisdeliveryAnomaly, "s1"},
+		{"broadcast", "255.255.255.255", []string{"s1-eth1", "s1-eth3"}, "", ""},
+		{"unknown destination", "10.0.0.9", []string{"s1-eth1", "s1-eth3"}, "", ""},
+	}
+
+	for _, test := range tests {
+		anomalies := generate(t, g, observations("a", test.dstIP, test.devices...)).Anomalies
+
+		if test.want == "" {
+			if len(anomalies) != 0 {
+				t.Errorf("%s: expected no anomaly, got %+v", test.name, anomalies)
+			}
+			continue
+		}
+		if len(anomalies) != 1 || anomalies[0].Type != test.want || anomalies[0].Switch != test.sw {
+			t.Errorf("%s: expected a %s at %s, got %+v", test.name, test.want, test.sw, anomalies)
+			continue
+		}
+		if hops := anomalies[0].Hops; hops[0].Node != "h1" || len(hops) != len(test.devices)/2+2 {
+			t.Errorf("%s: expected the hops from the root to the leaf, got %+v", test.name, hops)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	trees := []FlowTree{
+		{ID: "a", Anomalies: []Anomaly{{Type: DropAnomaly, Switch: "s2"}, {Type: LoopAnomaly, Switch: "s1"}}},
+		{ID: "b", Anomalies: []Anomaly{{Type: DropAnomaly, Switch: "s2"}}},
+		{ID: "c"},
+	}
+
+	s := Summarize(trees)
+	if s.Trees != 3 || s.Anomalous != 2 {
+		t.Errorf("expected 2 anomalous trees out of 3, got %d out of %d", s.Anomalous, s.Trees)
+	}
+	if s.Totals[DropAnomaly] != 2 || s.Totals[LoopAnomaly] != 1 {
+		t.Errorf("unexpected totals %v", s.Totals)
+	}
+	if s.Switches["s2"][DropAnomaly] != 2 || s.Switches["s1"][LoopAnomaly] != 1 || len(s.Switches) != 2 {
+		t.Errorf("unexpected switches %v", s.Switches)
+	}
+}
@@ -0,0 +1,140 @@
+package tree
+
+import (
+	"github.com/letitbeat/dp-analyzer/pkg/db/bolt"
+	bbolt "go.etcd.io/bbolt"
+)
+
+const (
+	treesBucket  = "trees"
+	groupsBucket = "tree_groups"
+)
+
+type boltRepo struct {
+	db *bbolt.DB
+}
+
+// NewBoltRepository returns a new Repository backed by an embedded BoltDB
+func NewBoltRepository(db *bbolt.DB) Repository {
+	return &boltRepo{db}
+}
+
+func (r *boltRepo) Store(ft FlowTree) error {
+	return bolt.Put(r.db, treesBucket, ft.ID, ft)
+}
+
+func (r *boltRepo) StoreGroup(key string, trees []FlowTree) error {
+	return bolt.Put(r.db, groupsBucket, key, group{key, trees})
+}
+
+func (r *boltRepo) FindByID(id string) (*FlowTree, error) {
+	var ft FlowTree
+	found, err := bolt.Get(r.db, treesBucket, id, &ft)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &ft, nil
+}
+
+func (r *boltRepo) FindAll() ([]FlowTree, error) {
+	trees, err := r.find(func(FlowTree) bool { return true })
+	sortNewest(trees)
+	return trees, err
+}
+
+func (r *boltRepo) FindPage(q Query) (Page, error) {
+	trees, err := r.find(q.match)
+	if err != nil {
+		return Page{}, err
+	}
+	sortNewest(trees)
+	return newPage(trees, q.Limit), nil
+}
+
+func (r *boltRepo) FindMatching(q Query) ([]FlowTree, error) {
+	q.Cursor = nil
+	trees, err := r.find(q.match)
+	sortNewest(trees)
+	return summaries(trees), err
+}
+
+func (r *boltRepo) FindByGroup(ft FlowTree) ([]FlowTree, error) {
+	key := ft.Group()
+	trees, err := r.find(func(t FlowTree) bool { return t.Group() == key })
+	sortOldest(trees)
+	return trees, err
+}
+
+func (r *boltRepo) FindGroups() ([]FlowTree, error) {
+	var trees []FlowTree
+
+	err := bolt.ForEach(r.db, groupsBucket, func(_ string, decode func(interface{}) error) error {
+		var g group
+		if err := decode(&g); err != nil {
+			return err
+		}
+		trees = append(trees, g.Trees...)
+		return nil
+	})
+	sortNewest(trees)
+	return trees, err
+}
+
+func (r *boltRepo) find(match func(FlowTree) bool) ([]FlowTree, error) {
+	var trees []FlowTree
+
+	err := bolt.ForEach(r.db, treesBucket, func(_ string, decode func(interface{}) error) error {
+		var ft FlowTree
+		if err := decode(&ft); err != nil {
+			return err
+		}
+		if match(ft) {
+			trees = append(trees, ft)
+		}
+		return nil
+	})
+	return trees, err
+}
+
+func (r *boltRepo) DeleteBySession(session string) (int64, error) {
+	if session == "" {
+		return 0, nil
+	}
+	trees, err := r.find(func(ft FlowTree) bool { return ft.Session == session })
+	if err != nil {
+		return 0, err
+	}
+	var groups []string
+	err = bolt.ForEach(r.db, groupsBucket, func(key string, decode func(interface{}) error) error {
+		var g group
+		if err := decode(&g); err != nil {
+			return err
+		}
+		if len(g.Trees) > 0 && g.Trees[0].Session == session {
+			groups = append(groups, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ft := range trees {
+		if err := bolt.Delete(r.db, treesBucket, ft.ID); err != nil {
+			return 0, err
+		}
+	}
+	for _, key := range groups {
+		if err := bolt.Delete(r.db, groupsBucket, key); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(trees)), nil
+}
+
+func (r *boltRepo) Count() (int64, error) {
+	return bolt.Count(r.db, treesBucket)
+}
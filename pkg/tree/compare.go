@@ -0,0 +1,393 @@
+package tree
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+)
+
+// Window selects the flow trees of a side of a comparison, the trees of a
+// session, the trees captured between From and To, or both
+type Window struct {
+	Session string     `json:"session,omitempty"`
+	From    *time.Time `json:"from,omitempty"`
+	To      *time.Time `json:"to,omitempty"`
+}
+
+// ParseWindow builds the Window of a side of a comparison from the URL
+// query parameters named after it, e.g. baseline for the session and
+// baseline_from and baseline_to for the time window. Times are either
+// RFC3339 or Unix nanoseconds.
+func ParseWindow(v url.Values, side string) (Window, error) {
+	w := Window{Session: v.Get(side)}
+	for _, p := range []struct {
+		name string
+		t    **time.Time
+	}{{side + "_from", &w.From}, {side + "_to", &w.To}} {
+		t, err := parseTime(v.Get(p.name))
+		if err != nil {
+			return w, fmt.Errorf("invalid %s, %v", p.name, err)
+		}
+		if !t.IsZero() {
+			*p.t = &t
+		}
+	}
+	if w.Session == "" && w.From == nil && w.To == nil {
+		return w, fmt.Errorf("missing %s session or time window", side)
+	}
+	return w, nil
+}
+
+// query returns the Query matching the trees of the window
+func (w Window) query() Query {
+	q := Query{Session: w.Session}
+	if w.From != nil {
+		q.From = *w.From
+	}
+	if w.To != nil {
+		q.To = *w.To
+	}
+	return q
+}
+
+// FlowKey identifies the flows matched across runs. The source port is
+// left out, as it is by Group, since it is usually ephemeral and differs
+// from one run to the other.
+type FlowKey struct {
+	Type    string `json:"type"`
+	SrcIP   string `json:"src_ip"`
+	DstIP   string `json:"dst_ip"`
+	DstPort string `json:"dst_port"`
+}
+
+func newFlowKey(ft FlowTree) FlowKey {
+	return FlowKey{ft.Type, ft.SrcIP, ft.DstIP, ft.DstPort}
+}
+
+func (k FlowKey) less(o FlowKey) bool {
+	if k.Type != o.Type {
+		return k.Type < o.Type
+	}
+	if k.SrcIP != o.SrcIP {
+		return k.SrcIP < o.SrcIP
+	}
+	if k.DstIP != o.DstIP {
+		return k.DstIP < o.DstIP
+	}
+	return k.DstPort < o.DstPort
+}
+
+// FlowStatus is the outcome of the comparison of a flow
+type FlowStatus string
+
+// Flow statuses, flows found in both runs are either changed or unchanged
+const (
+	FlowAdded     FlowStatus = "added"
+	FlowRemoved   FlowStatus = "removed"
+	FlowChanged   FlowStatus = "changed"
+	FlowUnchanged FlowStatus = "unchanged"
+)
+
+// AnomalyChange is a kind of anomaly, by type and switch, found in the
+// flow trees of only one of the runs
+type AnomalyChange struct {
+	Type   AnomalyType `json:"type"`
+	Switch string      `json:"switch,omitempty"`
+	// Description is the description of one of the anomalies
+	Description string `json:"description"`
+	// Count is the number of anomalies of the kind in that run
+	Count int `json:"count"`
+}
+
+// VerdictFlip is a property whose verdict differs between the runs
+type VerdictFlip struct {
+	PropertyID string      `json:"property_id"`
+	Title      string      `json:"title"`
+	Baseline   smt.Verdict `json:"baseline"`
+	Candidate  smt.Verdict `json:"candidate"`
+}
+
+// FlowDiff holds the differences of a flow between the baseline and the
+// candidate runs
+type FlowDiff struct {
+	FlowKey
+	Status FlowStatus `json:"status"`
+	// BaselineTrees and CandidateTrees are the number of trees of the flow
+	// in every run
+	BaselineTrees  int `json:"baseline_trees"`
+	CandidateTrees int `json:"candidate_trees"`
+	// AddedEdges and RemovedEdges are the hops of the union of the trees of
+	// the flow found only in the candidate or only in the baseline run
+	AddedEdges        []Edge          `json:"added_edges,omitempty"`
+	RemovedEdges      []Edge          `json:"removed_edges,omitempty"`
+	NewAnomalies      []AnomalyChange `json:"new_anomalies,omitempty"`
+	ResolvedAnomalies []AnomalyChange `json:"resolved_anomalies,omitempty"`
+	FlippedVerdicts   []VerdictFlip   `json:"flipped_verdicts,omitempty"`
+}
+
+// ComparisonSummary holds the number of flows compared and of differences
+// found
+type ComparisonSummary struct {
+	Flows   int `json:"flows"`
+	Matched int `json:"matched"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	// Changed is the number of matched flows whose structure changed
+	Changed         int `json:"changed"`
+	NewAnomalies    int `json:"new_anomalies"`
+	FlippedVerdicts int `json:"flipped_verdicts"`
+}
+
+// Comparison holds the flows whose behaviour differs between a baseline
+// and a candidate run, e.g. before and after a controller change
+type Comparison struct {
+	Baseline  Window            `json:"baseline"`
+	Candidate Window            `json:"candidate"`
+	Summary   ComparisonSummary `json:"summary"`
+	// Flows holds the flows added, removed or changed, unchanged flows are
+	// only counted
+	Flows []FlowDiff `json:"flows"`
+}
+
+// flow holds the trees of a flow in a run
+type flow struct {
+	trees     int
+	edges     map[Edge]bool
+	anomalies map[anomalyKind]*AnomalyChange
+	verdicts  map[string]smt.Result
+}
+
+type anomalyKind struct {
+	Type   AnomalyType
+	Switch string
+}
+
+func (f *flow) add(ft FlowTree) {
+	f.trees++
+	for _, path := range ft.Edges {
+		for _, e := range path {
+			f.edges[e] = true
+		}
+	}
+	for _, a := range ft.Anomalies {
+		k := anomalyKind{a.Type, a.Switch}
+		if f.anomalies[k] == nil {
+			f.anomalies[k] = &AnomalyChange{Type: a.Type, Switch: a.Switch, Description: a.Description}
+		}
+		f.anomalies[k].Count++
+	}
+	for _, r := range ft.Results {
+		id := r.PropertyID.Hex()
+		if v, ok := f.verdicts[id]; !ok || verdictRank[r.Verdict] > verdictRank[v.Verdict] {
+			f.verdicts[id] = r
+		}
+	}
+}
+
+// verdictRank orders the verdicts, the verdict of a property for a flow is
+// the highest ranked verdict of its trees
+var verdictRank = map[smt.Verdict]int{
+	smt.Sat:     0,
+	smt.Unknown: 1,
+	smt.Timeout: 2,
+	smt.Error:   3,
+	smt.Unsat:   4,
+}
+
+// flows groups the trees of a run by flow
+func flows(trees []FlowTree) map[FlowKey]*flow {
+	flows := make(map[FlowKey]*flow)
+	for _, ft := range trees {
+		k := newFlowKey(ft)
+		if flows[k] == nil {
+			flows[k] = &flow{
+				edges:     make(map[Edge]bool),
+				anomalies: make(map[anomalyKind]*AnomalyChange),
+				verdicts:  make(map[string]smt.Result),
+			}
+		}
+		flows[k].add(ft)
+	}
+	return flows
+}
+
+// Compare matches the flows of the trees of the baseline and the candidate
+// windows, see Repository.FindMatching, and returns the flows added,
+// removed, whose structure changed, with new anomalies or whose property
+// verdicts flipped
+func Compare(baseline, candidate Window, baselineTrees, candidateTrees []FlowTree) Comparison {
+	c := Comparison{Baseline: baseline, Candidate: candidate, Flows: []FlowDiff{}}
+
+	before := flows(baselineTrees)
+	after := flows(candidateTrees)
+
+	keys := make([]FlowKey, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if before[k] == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	c.Summary.Flows = len(keys)
+	for _, k := range keys {
+		b, a := before[k], after[k]
+		d := FlowDiff{FlowKey: k, Status: FlowUnchanged}
+		switch {
+		case b == nil:
+			d.Status, d.CandidateTrees = FlowAdded, a.trees
+			d.NewAnomalies = anomalyChanges(a.anomalies, nil)
+			c.Summary.Added++
+		case a == nil:
+			d.Status, d.BaselineTrees = FlowRemoved, b.trees
+			c.Summary.Removed++
+		default:
+			d.BaselineTrees, d.CandidateTrees = b.trees, a.trees
+			d.AddedEdges = edgeChanges(a.edges, b.edges)
+			d.RemovedEdges = edgeChanges(b.edges, a.edges)
+			d.NewAnomalies = anomalyChanges(a.anomalies, b.anomalies)
+			d.ResolvedAnomalies = anomalyChanges(b.anomalies, a.anomalies)
+			d.FlippedVerdicts = verdictFlips(b.verdicts, a.verdicts)
+			c.Summary.Matched++
+			if len(d.AddedEdges) > 0 || len(d.RemovedEdges) > 0 {
+				c.Summary.Changed++
+			}
+			if len(d.AddedEdges) > 0 || len(d.RemovedEdges) > 0 || len(d.NewAnomalies) > 0 ||
+				len(d.ResolvedAnomalies) > 0 || len(d.FlippedVerdicts) > 0 {
+				d.Status = FlowChanged
+			}
+		}
+		c.Summary.NewAnomalies += len(d.NewAnomalies)
+		c.Summary.FlippedVerdicts += len(d.FlippedVerdicts)
+		if d.Status != FlowUnchanged {
+			c.Flows = append(c.Flows, d)
+		}
+	}
+	return c
+}
+
+// edgeChanges returns the edges of from not in other, sorted
+func edgeChanges(from, other map[Edge]bool) []Edge {
+	var edges []Edge
+	for e := range from {
+		if !other[e] {
+			edges = append(edges, e)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].Src < edges[j].Src || (edges[i].Src == edges[j].Src && edges[i].Dst < edges[j].Dst)
+	})
+	return edges
+}
+
+// anomalyChanges returns the kinds of anomalies of from not in other,
+// sorted by type and switch
+func anomalyChanges(from, other map[anomalyKind]*AnomalyChange) []AnomalyChange {
+	var changes []AnomalyChange
+	for k, a := range from {
+		if other[k] == nil {
+			changes = append(changes, *a)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Type < changes[j].Type ||
+			(changes[i].Type == changes[j].Type && changes[i].Switch < changes[j].Switch)
+	})
+	return changes
+}
+
+// verdictFlips returns the properties verified in both runs whose verdicts
+// differ, sorted by title
+func verdictFlips(before, after map[string]smt.Result) []VerdictFlip {
+	var flips []VerdictFlip
+	for id, b := range before {
+		a, ok := after[id]
+		if !ok || a.Verdict == b.Verdict {
+			continue
+		}
+		flips = append(flips, VerdictFlip{PropertyID: id, Title: b.Title, Baseline: b.Verdict, Candidate: a.Verdict})
+	}
+	sort.Slice(flips, func(i, j int) bool {
+		return flips[i].Title < flips[j].Title || (flips[i].Title == flips[j].Title && flips[i].PropertyID < flips[j].PropertyID)
+	})
+	return flips
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"window": func(w Window) string {
+		s := ""
+		if w.Session != "" {
+			s = "session " + w.Session + " "
+		}
+		if w.From != nil {
+			s += "from " + w.From.Format(time.RFC3339) + " "
+		}
+		if w.To != nil {
+			s += "to " + w.To.Format(time.RFC3339)
+		}
+		return s
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Flow trees comparison</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.added { color: #2a7a2a; }
+.removed { color: #b02a2a; }
+</style>
+</head>
+<body>
+<h1>Flow trees comparison</h1>
+<p>Baseline: {{window .Baseline}}<br>Candidate: {{window .Candidate}}</p>
+<table>
+<tr><th>Flows</th><th>Matched</th><th>Added</th><th>Removed</th><th>Changed structure</th><th>New anomalies</th><th>Flipped verdicts</th></tr>
+<tr><td>{{.Summary.Flows}}</td><td>{{.Summary.Matched}}</td><td>{{.Summary.Added}}</td><td>{{.Summary.Removed}}</td><td>{{.Summary.Changed}}</td><td>{{.Summary.NewAnomalies}}</td><td>{{.Summary.FlippedVerdicts}}</td></tr>
+</table>
+{{range .Flows}}
+<h2>{{.Type}} {{.SrcIP}} &rarr; {{.DstIP}}{{if .DstPort}}:{{.DstPort}}{{end}} ({{.Status}})</h2>
+<p>Trees: {{.BaselineTrees}} in the baseline, {{.CandidateTrees}} in the candidate</p>
+{{if or .AddedEdges .RemovedEdges}}
+<h3>Structure</h3>
+<ul>
+{{range .AddedEdges}}<li class="added">+ {{.Src}} &rarr; {{.Dst}}</li>
+{{end}}{{range .RemovedEdges}}<li class="removed">- {{.Src}} &rarr; {{.Dst}}</li>
+{{end}}</ul>
+{{end}}
+{{if or .NewAnomalies .ResolvedAnomalies}}
+<h3>Anomalies</h3>
+<table>
+<tr><th></th><th>Type</th><th>Switch</th><th>Count</th><th>Description</th></tr>
+{{range .NewAnomalies}}<tr class="removed"><td>new</td><td>{{.Type}}</td><td>{{.Switch}}</td><td>{{.Count}}</td><td>{{.Description}}</td></tr>
+{{end}}{{range .ResolvedAnomalies}}<tr class="added"><td>resolved</td><td>{{.Type}}</td><td>{{.Switch}}</td><td>{{.Count}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .FlippedVerdicts}}
+<h3>Verdicts</h3>
+<table>
+<tr><th>Property</th><th>Baseline</th><th>Candidate</th></tr>
+{{range .FlippedVerdicts}}<tr><td>{{.Title}}</td><td>{{.Baseline}}</td><td>{{.Candidate}}</td></tr>
+{{end}}</table>
+{{end}}
+{{else}}
+<p>No differences found.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the comparison as an HTML report
+func (c Comparison) WriteHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, c)
+}
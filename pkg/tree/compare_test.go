@@ -0,0 +1,83 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+)
+
+func TestCompare(t *testing.T) {
+	prop := primitive.NewObjectID()
+	result := func(v smt.Verdict) []smt.Result {
+		return []smt.Result{{PropertyID: prop, Title: "reachability", Verdict: v}}
+	}
+	path := []Edge{{"h1", "s1"}, {"s1", "s2"}, {"s2", "h2"}}
+	detour := []Edge{{"h1", "s1"}, {"s1", "s3"}, {"s3", "s2"}, {"s2", "h2"}}
+	drop := []Anomaly{{Type: DropAnomaly, Switch: "s3", Description: "packet dropped at s3"}}
+
+	trees := []FlowTree{
+		// the ping takes a detour through s3 after the change, where some
+		// packets are dropped
+		{ID: "a1", Session: "before", Type: "ICMP", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Edges: [][]Edge{path}, Results: result(smt.Sat)},
+		{ID: "a2", Session: "before", Type: "ICMP", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Edges: [][]Edge{path}, Results: result(smt.Sat)},
+		{ID: "b1", Session: "after", Type: "ICMP", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Edges: [][]Edge{detour}, Results: result(smt.Sat)},
+		{ID: "b2", Session: "after", Type: "ICMP", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Edges: [][]Edge{detour[:2]}, Anomalies: drop, Results: result(smt.Unsat)},
+		// the source port differs, the flow is the same
+		{ID: "a3", Session: "before", Type: "TCP", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: "40000", DstPort: "80", Edges: [][]Edge{path}},
+		{ID: "b3", Session: "after", Type: "TCP", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: "40001", DstPort: "80", Edges: [][]Edge{path}},
+		{ID: "a4", Session: "before", Type: "UDP", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", DstPort: "53", Edges: [][]Edge{path}},
+		{ID: "b4", Session: "after", Type: "ARP", SrcIP: "10.0.0.2", DstIP: "10.0.0.1", Edges: [][]Edge{path}},
+	}
+
+	baseline, candidate := Window{Session: "before"}, Window{Session: "after"}
+	c := Compare(baseline, candidate, baseline.query().filter(trees), candidate.query().filter(trees))
+	if got, want := fmt.Sprintf("%+v", c.Summary), "{Flows:4 Matched:2 Added:1 Removed:1 Changed:1 NewAnomalies:1 FlippedVerdicts:1}"; got != want {
+		t.Errorf("expected the summary %s, got %s", want, got)
+	}
+
+	var statuses []string
+	for _, d := range c.Flows {
+		statuses = append(statuses, fmt.Sprintf("%s %s", d.Type, d.Status))
+	}
+	if got, want := strings.Join(statuses, ", "), "ARP added, ICMP changed, UDP removed"; got != want {
+		t.Errorf("expected the flows %s, got %s", want, got)
+	}
+
+	d := c.Flows[1]
+	if got, want := fmt.Sprint(d.AddedEdges, d.RemovedEdges), "[{s1 s3} {s3 s2}] [{s1 s2}]"; got != want {
+		t.Errorf("expected the edges %s, got %s", want, got)
+	}
+	if len(d.NewAnomalies) != 1 || d.NewAnomalies[0].Switch != "s3" || d.NewAnomalies[0].Count != 1 {
+		t.Errorf("expected a new drop at s3, got %+v", d.NewAnomalies)
+	}
+	if len(d.FlippedVerdicts) != 1 || d.FlippedVerdicts[0].Baseline != smt.Sat || d.FlippedVerdicts[0].Candidate != smt.Unsat {
+		t.Errorf("expected reachability to flip from sat to unsat, got %+v", d.FlippedVerdicts)
+	}
+
+	var report bytes.Buffer
+	if err := c.WriteHTML(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "s1 &rarr; s3") || !strings.Contains(report.String(), "packet dropped at s3") {
+		t.Errorf("expected the report to show the changes, got %s", report.String())
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow(url.Values{"baseline_from": {"2019-03-16T17:00:00Z"}, "baseline_to": {"1552756800000000000"}}, "baseline")
+	if err != nil || w.Session != "" || w.From == nil || w.To == nil || !w.From.Before(*w.To) {
+		t.Errorf("expected a time window, got %+v, %v", w, err)
+	}
+	if _, err := ParseWindow(url.Values{"baseline": {"a"}}, "candidate"); err == nil {
+		t.Error("expected an error for a missing window")
+	}
+	if _, err := ParseWindow(url.Values{"candidate_from": {"soon"}}, "candidate"); err == nil {
+		t.Error("expected an error for an invalid time")
+	}
+}
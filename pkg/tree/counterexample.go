@@ -0,0 +1,147 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+)
+
+// counterexample maps the model or the unsat core returned by the solver
+// back to the paths and edges encoded by templates/smt.tmpl.
+//
+// For unsat results the core holds the names, pe<path>_<index>, of the
+// path assertions involved. For sat results the model constants are
+// matched as follows: Edge constants against the edges of every path, Int
+// constants whose name contains "path" as path indices and Int constants
+// whose name contains "edge" or "hop" as edge indices within those paths.
+func counterexample(o smt.Outcome, edges map[int][]Edge) *smt.Counterexample {
+	c := &smt.Counterexample{}
+	paths := make(map[int]bool)
+	refs := make(map[[2]int]bool)
+
+	addEdge := func(p, i int) {
+		if _, ok := edgeAt(edges, p, i); ok {
+			paths[p] = true
+			refs[[2]int{p, i}] = true
+		}
+	}
+
+	switch o.Verdict {
+	case smt.Unsat:
+		for _, name := range o.Core {
+			var p, i int
+			if _, err := fmt.Sscanf(name, "pe%d_%d", &p, &i); err == nil {
+				addEdge(p, i)
+			}
+		}
+	case smt.Sat:
+		var indices []int
+		for _, a := range smt.ParseModel(o.Model) {
+			name := strings.ToLower(a.Name)
+			switch a.Sort {
+			case "Edge":
+				src, dst, ok := smt.PairValue(a.Value)
+				if !ok {
+					continue
+				}
+				for p, path := range edges {
+					for i, e := range path {
+						if e.Src == src && e.Dst == dst {
+							addEdge(p, i+1)
+						}
+					}
+				}
+			case "Int":
+				v, err := strconv.Atoi(a.Value)
+				if err != nil {
+					continue
+				}
+				if strings.Contains(name, "path") {
+					if _, ok := edges[v]; ok {
+						paths[v] = true
+					}
+				} else if strings.Contains(name, "edge") || strings.Contains(name, "hop") {
+					indices = append(indices, v)
+				}
+			}
+		}
+		for p := range paths {
+			for _, i := range indices {
+				addEdge(p, i)
+			}
+		}
+	default:
+		return nil
+	}
+
+	for p := range paths {
+		c.Paths = append(c.Paths, p)
+	}
+	sort.Ints(c.Paths)
+
+	for r := range refs {
+		e, _ := edgeAt(edges, r[0], r[1])
+		c.Edges = append(c.Edges, smt.EdgeRef{Path: r[0], Index: r[1], Src: e.Src, Dst: e.Dst})
+	}
+	sort.Slice(c.Edges, func(i, j int) bool {
+		if c.Edges[i].Path != c.Edges[j].Path {
+			return c.Edges[i].Path < c.Edges[j].Path
+		}
+		return c.Edges[i].Index < c.Edges[j].Index
+	})
+
+	if c.Empty() {
+		return nil
+	}
+	return c
+}
+
+// edgeAt returns the i-th (1-based) edge of path p
+func edgeAt(edges map[int][]Edge, p, i int) (Edge, bool) {
+	path, ok := edges[p]
+	if !ok || i < 1 || i > len(path) {
+		return Edge{}, false
+	}
+	return path[i-1], true
+}
+
+// HighlightEdges returns the given DOT graph with the edges matching the
+// given ones, by node label, drawn in the given color.
+func HighlightEdges(dotStr string, edges []Edge, color string) (string, error) {
+	if len(edges) == 0 {
+		return dotStr, nil
+	}
+
+	g, err := gographviz.Read([]byte(dotStr))
+	if err != nil {
+		return dotStr, err
+	}
+
+	labels := make(map[string]string)
+	for _, n := range g.Nodes.Nodes {
+		labels[n.Name] = strings.Trim(n.Attrs["label"], `"`)
+		if labels[n.Name] == "" {
+			labels[n.Name] = n.Name
+		}
+	}
+
+	highlight := make(map[Edge]bool)
+	for _, e := range edges {
+		highlight[Edge{Src: e.Src, Dst: e.Dst}] = true
+	}
+
+	for _, e := range g.Edges.Edges {
+		if highlight[Edge{Src: labels[e.Src], Dst: labels[e.Dst]}] {
+			if e.Attrs == nil {
+				e.Attrs = make(gographviz.Attrs)
+			}
+			e.Attrs.Add("color", color)
+			e.Attrs.Add("penwidth", "2")
+		}
+	}
+	return g.String(), nil
+}
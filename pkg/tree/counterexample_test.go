@@ -0,0 +1,81 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+)
+
+var counterexampleEdges = map[int][]Edge{
+	1: {{Src: "h1", Dst: "s1"}, {Src: "s1", Dst: "s2"}, {Src: "s2", Dst: "h2"}},
+	2: {{Src: "h1", Dst: "s1"}, {Src: "s1", Dst: "s3"}},
+}
+
+func TestCounterexampleFromCore(t *testing.T) {
+	o := smt.Outcome{Verdict: smt.Unsat, Core: []string{"pe2_2", "pe1_9", "other"}}
+
+	c := counterexample(o, counterexampleEdges)
+	if c == nil || len(c.Paths) != 1 || c.Paths[0] != 2 {
+		t.Fatalf("expected path 2, got %+v", c)
+	}
+	if len(c.Edges) != 1 || c.Edges[0] != (smt.EdgeRef{Path: 2, Index: 2, Src: "s1", Dst: "s3"}) {
+		t.Errorf("expected edge s1->s3 of path 2, got %+v", c.Edges)
+	}
+}
+
+func TestCounterexampleFromModel(t *testing.T) {
+	model := `(
+  (define-fun bad () Edge
+    (mk-pair "s2" "h2"))
+  (define-fun path_idx () Int 2)
+  (define-fun edge_idx () Int 1)
+  (define-fun f ((x!0 Int)) Int 0)
+)`
+	o := smt.Outcome{Verdict: smt.Sat, Model: model}
+
+	c := counterexample(o, counterexampleEdges)
+	if c == nil {
+		t.Fatal("expected a counterexample")
+	}
+	if len(c.Paths) != 2 || c.Paths[0] != 1 || c.Paths[1] != 2 {
+		t.Errorf("expected paths 1 and 2, got %v", c.Paths)
+	}
+	expected := []smt.EdgeRef{
+		{Path: 1, Index: 1, Src: "h1", Dst: "s1"},
+		{Path: 1, Index: 3, Src: "s2", Dst: "h2"},
+		{Path: 2, Index: 1, Src: "h1", Dst: "s1"},
+	}
+	if len(c.Edges) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, c.Edges)
+	}
+	for i := range expected {
+		if c.Edges[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], c.Edges[i])
+		}
+	}
+}
+
+func TestHighlightEdges(t *testing.T) {
+	root := NewNode("h1", "h1")
+	nt := NewTree(root)
+	s1 := NewNode("s1", "s1")
+	s1p := NewNode("s1_0", "s1")
+	root.AddChild(s1)
+	nt.AddNode(s1)
+	s1.AddChild(s1p)
+	nt.AddNode(s1p)
+
+	dotStr, err := HighlightEdges(nt.ToDOT("", "TCP 80"), []Edge{{Src: "s1", Dst: "s1"}}, "red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range strings.Split(dotStr, "\n") {
+		if strings.Contains(l, "s1->s1_0") && !strings.Contains(l, "color=red") {
+			t.Errorf("expected the s1 loop to be highlighted, got %s", l)
+		}
+		if strings.Contains(l, "h1->s1") && strings.Contains(l, "color") {
+			t.Errorf("expected h1->s1 not to be highlighted, got %s", l)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// Encoding is the parsed SMT encoding template of the paths of a flow tree
+// and the topology, the properties are appended to the formula it renders
+type Encoding struct {
+	tmpl *template.Template
+}
+
+// LoadEncoding parses the SMT encoding template smt.tmpl of dir
+func LoadEncoding(dir string) (*Encoding, error) {
+	funcMap := template.FuncMap{
+		// The name "inc" is what the function will be called in the template text.
+		"inc": func(i int) int {
+			return i + 1
+		},
+	}
+	tmpl, err := template.New("smt.tmpl").Funcs(funcMap).ParseFiles(filepath.Join(dir, "smt.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing smt template, %v", err)
+	}
+	return &Encoding{tmpl}, nil
+}
+
+type inputParams struct {
+	EdgesCount int
+	Edges      map[int][]Edge
+	Hosts      []string
+	Switches   []string
+	DataPlane  []Edge
+}
+
+// render renders the SMT encoding of the given parameters
+func (e *Encoding) render(params inputParams) (string, error) {
+	if e == nil {
+		return "", fmt.Errorf("no smt encoding template loaded")
+	}
+	var tplCompiled bytes.Buffer
+	if err := e.tmpl.Execute(&tplCompiled, params); err != nil {
+		return "", fmt.Errorf("error generating smt formula, %v", err)
+	}
+	return tplCompiled.String(), nil
+}
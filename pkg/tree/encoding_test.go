@@ -0,0 +1,48 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func TestEncoding(t *testing.T) {
+	if _, err := LoadEncoding(t.Name()); err == nil {
+		t.Error("expected an error loading a missing template")
+	}
+
+	enc, err := LoadEncoding("../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	solver := &smt.MockSolver{Outcome: smt.Outcome{Verdict: smt.Sat}}
+	props := []smt.Property{{ID: primitive.NewObjectID(), Title: "reaches h2", Text: "(check-sat)"}}
+	g := NewGenerator(topology.Legacy{
+		Links: []string{"h1:s1-eth1", "h2:s1-eth2"},
+	}.Topology(), props, solver, enc)
+
+	ft := generate(t, g, observations("a", "", "s1-eth1", "s1-eth2"))
+
+	// the template is parsed once and rendered for every verification
+	for i := 0; i < 2; i++ {
+		g.Verify(&ft)
+	}
+	formulas := solver.Formulas()
+	if len(formulas) != 2 || !strings.HasSuffix(formulas[0], "(check-sat)") || formulas[0] != formulas[1] {
+		t.Errorf("expected the same formula to be solved twice, got %q", formulas)
+	}
+	if !ft.IsSat || ft.Results[0].Verdict != smt.Sat {
+		t.Errorf("expected the property to be satisfied, got %+v", ft.Results)
+	}
+
+	// without template the properties cannot be verified
+	g = NewGenerator(g.topo, props, solver, nil)
+	g.Verify(&ft)
+	if ft.IsSat || ft.Results[0].Verdict != smt.Error {
+		t.Errorf("expected a verification error, got %+v", ft.Results)
+	}
+}
@@ -0,0 +1,267 @@
+package tree
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/letitbeat/dp-analyzer/pkg/dot"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+// Colors of the expected paths overlay
+const (
+	expectedColor = "green"
+	extraColor    = "red"
+	missingColor  = "blue"
+)
+
+// Expectation compares the observed paths of a flow tree with the paths
+// the topology expects from its source to its destination host
+type Expectation struct {
+	Src string `json:"src" bson:"src"`
+	Dst string `json:"dst" bson:"dst"`
+	// Paths are the expected paths, the shortest ones or the ones of the
+	// matching route
+	Paths [][]string `json:"paths" bson:"paths"`
+	// Diffs holds the differences of every observed path with its closest
+	// expected path
+	Diffs []PathDiff `json:"diffs" bson:"diffs"`
+	// Matches is true when every observed path is an expected one
+	Matches bool `json:"matches" bson:"matches"`
+	// DOT is the flow tree with the observed hops on an expected path in
+	// green, the extra ones in red and the missing ones dashed in blue
+	DOT string `json:"dot" bson:"dot"`
+	// DOTImg is rendered from DOT only when a single tree is requested, it
+	// is not stored, see render
+	DOTImg     string `json:"dot_img,omitempty" bson:"-"`
+	DOTImgType string `json:"dot_img_type,omitempty" bson:"-"`
+}
+
+// PathDiff is the difference between an observed path and the expected
+// path closest to it, paths are node labels from the root to the leaf
+type PathDiff struct {
+	Observed []string `json:"observed" bson:"observed"`
+	Expected []string `json:"expected" bson:"expected"`
+	// Missing are the hops of the expected path not observed
+	Missing []string `json:"missing,omitempty" bson:"missing,omitempty"`
+	// Extra are the observed hops not on the expected path
+	Extra []string `json:"extra,omitempty" bson:"extra,omitempty"`
+	// DivergesAt is the last hop shared with the expected path when the
+	// observed path branches off it
+	DivergesAt string `json:"diverges_at,omitempty" bson:"diverges_at,omitempty"`
+
+	nodes []*Node
+}
+
+// expectedPaths returns the paths expected from src to dst, the ones of
+// the first matching route or the shortest ones
+func expectedPaths(routes []topology.Route, x *topology.Index, src, dst, port string) [][]string {
+	for _, r := range routes {
+		if (r.Src != "" && r.Src != src) || (r.Dst != "" && r.Dst != dst) ||
+			(r.Port != "" && !matchPort(r.Port, port)) {
+			continue
+		}
+
+		paths := [][]string{{src}}
+		points := append(append([]string{src}, r.Via...), dst)
+		for i := 1; i < len(points); i++ {
+			segments := x.ShortestPaths(points[i-1], points[i])
+			var next [][]string
+			for _, p := range paths {
+				for _, s := range segments {
+					next = append(next, append(append([]string(nil), p...), s[1:]...))
+				}
+			}
+			paths = next
+		}
+		return paths
+	}
+	return x.ShortestPaths(src, dst)
+}
+
+// diffPath compares the observed path, given from the leaf to the root as
+// returned by Tree.DFS, with the closest of the expected paths, the one
+// sharing the longest prefix and then the fewest differences
+func diffPath(path []*Node, expected [][]string) PathDiff {
+	d := PathDiff{}
+	for i := len(path) - 1; i >= 0; i-- {
+		d.nodes = append(d.nodes, path[i])
+		d.Observed = append(d.Observed, path[i].Label)
+	}
+
+	best, bestPrefix := -1, -1
+	var bestMissing, bestExtra []string
+	for i, e := range expected {
+		prefix := 0
+		for prefix < len(e) && prefix < len(d.Observed) && e[prefix] == d.Observed[prefix] {
+			prefix++
+		}
+		missing, extra := difference(e, d.Observed), difference(d.Observed, e)
+		if prefix > bestPrefix ||
+			(prefix == bestPrefix && len(missing)+len(extra) < len(bestMissing)+len(bestExtra)) {
+			best, bestPrefix, bestMissing, bestExtra = i, prefix, missing, extra
+		}
+	}
+	if best < 0 {
+		return d
+	}
+
+	d.Expected = expected[best]
+	d.Missing, d.Extra = bestMissing, bestExtra
+	if bestPrefix > 0 && bestPrefix < len(d.Expected) && bestPrefix < len(d.Observed) {
+		d.DivergesAt = d.Observed[bestPrefix-1]
+	}
+	return d
+}
+
+// difference returns the hops of a not in b
+func difference(a, b []string) []string {
+	in := make(map[string]bool)
+	for _, h := range b {
+		in[h] = true
+	}
+	var d []string
+	for _, h := range a {
+		if !in[h] {
+			d = append(d, h)
+		}
+	}
+	return d
+}
+
+// expect compares the tree with the paths the topology expects, it
+// returns nil when the source or the destination host is unknown
+func (b *builder) expect() *Expectation {
+	topo := b.g.topo
+	dst, ok := topo.HostByIP(b.ft.DstIP)
+	if !ok {
+		return nil
+	}
+	src, ok := topo.HostByIP(b.ft.SrcIP)
+	if !ok {
+		if !topo.IsHost(b.tree.Root.Label) {
+			return nil
+		}
+		src = b.tree.Root.Label
+	}
+
+	e := &Expectation{Src: src, Dst: dst, Matches: true}
+	e.Paths = expectedPaths(topo.Routes, b.g.index, src, dst, b.ft.DstPort)
+	for _, path := range b.tree.DFS(b.tree.Root) {
+		d := diffPath(path, e.Paths)
+		if d.Expected == nil || len(d.Missing) > 0 || len(d.Extra) > 0 || len(d.Observed) != len(d.Expected) {
+			e.Matches = false
+		}
+		e.Diffs = append(e.Diffs, d)
+	}
+
+	label := fmt.Sprintf("%s %s expected %s", b.ft.Type, b.ft.DstPort, dst)
+	dotStr, err := overlayExpected(b.tree.ToDOT(b.id, label), e.Diffs)
+	if err != nil {
+		log.Printf("error drawing expected paths, %s", err.Error())
+	}
+	e.DOT = dotStr
+	return e
+}
+
+// render renders the DOT of the comparison into DOTImg
+func (e *Expectation) render() {
+	if e == nil || e.DOT == "" {
+		return
+	}
+	var err error
+	if e.DOTImg, e.DOTImgType, err = dot.Generate(e.DOT); err != nil {
+		log.Printf("error generating expected paths, %s", err.Error())
+	}
+}
+
+// overlayExpected colors the edges of the DOT graph of a tree on their
+// expected path in green and the other ones in red, the hops of the
+// expected paths not observed are added dashed in blue
+func overlayExpected(dotStr string, diffs []PathDiff) (string, error) {
+	g, err := gographviz.Read([]byte(dotStr))
+	if err != nil {
+		return dotStr, err
+	}
+
+	colors := make(map[Edge]string)
+	var added []Edge
+	// labels holds the labels of the nodes added for missing hops
+	labels := make(map[string]string)
+	for _, d := range diffs {
+		expected := make(map[Edge]bool)
+		for i := 1; i < len(d.Expected); i++ {
+			expected[Edge{Src: d.Expected[i-1], Dst: d.Expected[i]}] = true
+		}
+
+		observed := make(map[Edge]bool)
+		names := make(map[string]string)
+		for i, n := range d.nodes {
+			names[n.Label] = n.Name
+			if i == 0 {
+				continue
+			}
+			p := d.nodes[i-1]
+			observed[Edge{Src: p.Label, Dst: n.Label}] = true
+			e := Edge{Src: p.Name, Dst: n.Name}
+			if expected[Edge{Src: p.Label, Dst: n.Label}] {
+				colors[e] = expectedColor
+			} else if colors[e] == "" {
+				colors[e] = extraColor
+			}
+		}
+
+		for i := 1; i < len(d.Expected); i++ {
+			src, dst := d.Expected[i-1], d.Expected[i]
+			if observed[Edge{Src: src, Dst: dst}] {
+				continue
+			}
+			added = append(added, Edge{Src: nodeName(names, labels, src), Dst: nodeName(names, labels, dst)})
+		}
+	}
+
+	for _, e := range g.Edges.Edges {
+		if c, ok := colors[Edge{Src: e.Src, Dst: e.Dst}]; ok {
+			if e.Attrs == nil {
+				e.Attrs = make(gographviz.Attrs)
+			}
+			e.Attrs.Add("color", c)
+		}
+	}
+
+	for _, m := range added {
+		for _, n := range []string{m.Src, m.Dst} {
+			if g.IsNode(n) {
+				continue
+			}
+			attrs := map[string]string{
+				"label": dotID(labels[n]),
+				"color": missingColor,
+				"style": "dashed",
+			}
+			if err := g.AddNode(g.Name, n, attrs); err != nil {
+				return dotStr, err
+			}
+		}
+		if existing := g.Edges.SrcToDsts[m.Src][m.Dst]; len(existing) > 0 {
+			continue
+		}
+		attrs := map[string]string{"color": missingColor, "style": "dashed"}
+		if err := g.AddEdge(m.Src, m.Dst, true, attrs); err != nil {
+			return dotStr, err
+		}
+	}
+	return g.String(), nil
+}
+
+// nodeName returns the name of the observed node with the given label or
+// the name of the node added for the missing hop
+func nodeName(names, labels map[string]string, label string) string {
+	if n, ok := names[label]; ok {
+		return n
+	}
+	n := dotID("expected_" + label)
+	labels[n] = label
+	return n
+}
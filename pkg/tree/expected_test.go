@@ -0,0 +1,114 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func TestExpectedPaths(t *testing.T) {
+	topo := topology.Legacy{
+		Hosts:    []string{"h1", "h2", "h3"},
+		Switches: []string{"s1", "s2", "s3", "s4"},
+		Links: []string{
+			"h1:s1-eth1", "s2:s1-eth2", "s3:s1-eth3",
+			"s1:s2-eth1", "s4:s2-eth2", "h3:s2-eth3",
+			"s1:s3-eth1", "s4:s3-eth2",
+			"s2:s4-eth1", "s3:s4-eth2", "h2:s4-eth3",
+		},
+		Addresses: map[string]string{"h1": "10.0.0.1", "h2": "10.0.0.2", "h3": "10.0.0.3"},
+	}.Topology()
+
+	tests := []struct {
+		name    string
+		routes  []topology.Route
+		devices []string
+		matches bool
+		diff    PathDiff
+		overlay string
+	}{
+		{
+			name:    "ecmp",
+			devices: []string{"s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2", "s4-eth1", "s4-eth3"},
+			matches: true,
+			diff:    PathDiff{Expected: []string{"h1", "s1", "s2", "s4", "h2"}},
+			overlay: "s2->s4[ color=green",
+		},
+		{
+			name:    "policy",
+			routes:  []topology.Route{{Dst: "h2", Port: "80", Via: []string{"s3"}}},
+			devices: []string{"s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2", "s4-eth1", "s4-eth3"},
+			diff: PathDiff{
+				Expected:   []string{"h1", "s1", "s3", "s4", "h2"},
+				Missing:    []string{"s3"},
+				Extra:      []string{"s2"},
+				DivergesAt: "s1",
+			},
+			overlay: "s1->s2[ color=red",
+		},
+		{
+			name:    "misdelivery",
+			devices: []string{"s1-eth1", "s1-eth2", "s2-eth1", "s2-eth3"},
+			diff: PathDiff{
+				Expected:   []string{"h1", "s1", "s2", "s4", "h2"},
+				Missing:    []string{"s4", "h2"},
+				Extra:      []string{"h3"},
+				DivergesAt: "s2",
+			},
+			overlay: "s2->expected_s4[ color=blue",
+		},
+	}
+
+	for _, test := range tests {
+		topo.Routes = test.routes
+		g := NewGenerator(topo, nil, nil, nil)
+
+		pks := observations("a", "10.0.0.2", test.devices...)
+		for i := range pks {
+			pks[i].DstPort = "80"
+		}
+		e := generate(t, g, pks).Expected
+		if e == nil || e.Src != "h1" || e.Dst != "h2" || len(e.Diffs) != 1 {
+			t.Fatalf("%s: expected a single path from h1 to h2, got %+v", test.name, e)
+		}
+		if e.Matches != test.matches {
+			t.Errorf("%s: expected matches to be %v", test.name, test.matches)
+		}
+
+		d := e.Diffs[0]
+		if strings.Join(d.Expected, ",") != strings.Join(test.diff.Expected, ",") ||
+			strings.Join(d.Missing, ",") != strings.Join(test.diff.Missing, ",") ||
+			strings.Join(d.Extra, ",") != strings.Join(test.diff.Extra, ",") ||
+			d.DivergesAt != test.diff.DivergesAt {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.diff, d)
+		}
+		if !strings.Contains(e.DOT, test.overlay) {
+			t.Errorf("%s: expected %s in the overlay, got %s", test.name, test.overlay, e.DOT)
+		}
+		// the overlay is rendered on demand only
+		if e.DOTImg != "" {
+			t.Errorf("%s: expected the overlay not to be rendered", test.name)
+		}
+		if e.render(); e.DOTImg == "" || e.DOTImgType == "" {
+			t.Errorf("%s: expected the overlay to be rendered, got %+v", test.name, e)
+		}
+	}
+}
+
+func TestShortestPaths(t *testing.T) {
+	topo := topology.Legacy{
+		Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s3:s1-eth3", "s4:s2-eth1", "s4:s3-eth1", "h2:s4-eth1"},
+	}.Topology()
+
+	paths := topo.ShortestPaths("h1", "h2")
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 equal-cost paths, got %v", paths)
+	}
+	if strings.Join(paths[0], ",") != "h1,s1,s2,s4,h2" || strings.Join(paths[1], ",") != "h1,s1,s3,s4,h2" {
+		t.Errorf("unexpected paths %v", paths)
+	}
+	if paths := topo.ShortestPaths("h1", "h9"); paths != nil {
+		t.Errorf("expected no path to an unknown host, got %v", paths)
+	}
+}
@@ -0,0 +1,40 @@
+package tree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+)
+
+// captureTime is the capture time of the first observation of the test
+// fixtures
+var captureTime = time.Date(2019, 3, 16, 17, 43, 26, 0, time.UTC)
+
+// observations returns the observations of a packet sent by 10.0.0.1 to
+// dstIP at the given devices, captured one millisecond apart
+func observations(payload, dstIP string, devices ...string) []packets.Packet {
+	pks := make([]packets.Packet, len(devices))
+	for i, device := range devices {
+		pks[i] = packets.Packet{Device: device, Payload: payload, SrcIP: "10.0.0.1", DstIP: dstIP}
+		captured(&pks[i], captureTime.Add(time.Duration(i)*time.Millisecond))
+	}
+	return pks
+}
+
+// captured sets the capture time of the observation
+func captured(p *packets.Packet, at time.Time) {
+	p.CapturedAt = &at
+	p.CapturedAtNano = at.UnixNano()
+}
+
+// generate returns the flow tree g builds from the observations of a
+// single packet
+func generate(t *testing.T, g *Generator, pks []packets.Packet) FlowTree {
+	t.Helper()
+	trees, err := g.Generate(map[string][]packets.Packet{pks[0].Payload: pks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trees[0]
+}
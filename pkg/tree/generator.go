@@ -1,12 +1,9 @@
 package tree
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"html/template"
 	"log"
-	"os"
-	"os/exec"
 	"sort"
 	"strings"
 	"time"
@@ -19,18 +16,59 @@ import (
 
 // FlowTree represents a data-path which a particular packet follows.
 type FlowTree struct {
-	ID         string   `json:"id"`
-	Type       string   `json:"type"`
-	SrcIP      string   `json:"src_ip"`
-	DstIP      string   `json:"dst_ip"`
-	SrcPort    string   `json:"src_port"`
-	DstPort    string   `json:"dst_port"`
-	Nodes      string   `json:"nodes"`
-	NodesImg   string   `json:"nodes_img"`
-	CapturedAt int64    `json:"captured_at"`
-	Level      int      `json:"level"`
-	Edges      [][]Edge `json:"-"`
-	IsSat      bool     `json:"is_sat"`
+	ID       string `json:"id" bson:"_id"`
+	Type     string `json:"type" bson:"type"`
+	SrcIP    string `json:"src_ip" bson:"src_ip"`
+	DstIP    string `json:"dst_ip" bson:"dst_ip"`
+	SrcPort  string `json:"src_port" bson:"src_port"`
+	DstPort  string `json:"dst_port" bson:"dst_port"`
+	Nodes    string `json:"nodes" bson:"nodes"`
+	NodesImg string `json:"nodes_img" bson:"nodes_img"`
+	// NodesImgType is the media type of NodesImg
+	NodesImgType string   `json:"nodes_img_type" bson:"nodes_img_type"`
+	CapturedAt   int64    `json:"captured_at" bson:"captured_at"`
+	Level        int      `json:"level" bson:"level"`
+	Edges        [][]Edge `json:"-" bson:"edges"`
+	// IsSat is true when every property has been verified as sat
+	IsSat   bool         `json:"is_sat" bson:"is_sat"`
+	Results []smt.Result `json:"results" bson:"results"`
+	// Merged is the structure of the merged flow trees, only set on trees
+	// resulting from a merge
+	Merged *MergedGraph `json:"merged,omitempty" bson:"merged,omitempty"`
+	// Anomalies holds the abnormal behaviours, e.g. loops, found while
+	// building the tree
+	Anomalies []Anomaly `json:"anomalies,omitempty" bson:"anomalies,omitempty"`
+	// Latencies holds the latency measured on every edge of the tree
+	Latencies []Latency `json:"latencies,omitempty" bson:"latencies,omitempty"`
+	// Paths holds the end to end delay of every root to leaf path
+	Paths []PathDelay `json:"paths,omitempty" bson:"paths,omitempty"`
+	// Expected compares the tree with the paths expected by the topology,
+	// only set when its source and destination hosts are known
+	Expected *Expectation `json:"expected,omitempty" bson:"expected,omitempty"`
+	// Topology is the ID of the topology version active when the tree was
+	// captured, the tree is built against it
+	Topology string `json:"topology,omitempty" bson:"topology,omitempty"`
+	// Session is the ID of the experiment session of the observations,
+	// trees are only merged with the trees of the same session
+	Session string `json:"session,omitempty" bson:"session,omitempty"`
+}
+
+// Group returns the key of the trees merged together, trees of the same
+// session, type and destination port captured within the same second
+func (ft *FlowTree) Group() string {
+	capturedAt := time.Unix(0, ft.CapturedAt)
+	return fmt.Sprintf("%s%s%s%s", ft.Session, ft.Type, ft.DstPort, capturedAt.Format(time.RFC3339))
+}
+
+// setResults sets the verification results of the tree
+func (ft *FlowTree) setResults(results []smt.Result) {
+	ft.Results = results
+	ft.IsSat = len(results) > 0
+	for _, r := range results {
+		if r.Verdict != smt.Sat {
+			ft.IsSat = false
+		}
+	}
 }
 
 // NewFlowTree creates a new FlowTree with packets metadata
@@ -43,18 +81,24 @@ func NewFlowTree(ID string, p packets.Packet) *FlowTree {
 		SrcPort:    p.SrcPort,
 		DstPort:    p.DstPort,
 		CapturedAt: p.CapturedAt.UnixNano(),
+		Session:    p.Session,
 	}
 }
 
 // Generator holds the topology to be used by the generation process
 type Generator struct {
-	topo  topology.Topology
-	props []smt.Property
+	topo   topology.Topology
+	index  *topology.Index
+	props  []smt.Property
+	solver smt.Solver
+	enc    *Encoding
 }
 
-// NewGenerator creates a new Generator object
-func NewGenerator(topo topology.Topology, props []smt.Property) *Generator {
-	return &Generator{topo, props}
+// NewGenerator creates a new Generator object, the properties are verified
+// by solver against the paths encoded by enc, both may be nil when there
+// are no properties
+func NewGenerator(topo topology.Topology, props []smt.Property, solver smt.Solver, enc *Encoding) *Generator {
+	return &Generator{topo, topo.Index(), props, solver, enc}
 }
 
 // Generate iterates over all packets receive to construct a FlowTree or set of them
@@ -72,137 +116,185 @@ func (g *Generator) Generate(packets map[string][]packets.Packet) ([]FlowTree, e
 		})
 		log.Printf("After DB timestamp: %d, %d", packets[k][0].CapturedAt.Unix(), packets[k][0].CapturedAt.UnixNano())
 
-		firstMsg := packets[k][0]
-		root := NewNode(g.getConnectedNode(firstMsg.Device), g.getConnectedNode(firstMsg.Device))
+		b := g.newBuilder(k, packets[k][0])
+		for _, p := range packets[k] {
+			b.add(p)
+		}
+		trees = append(trees, b.flowTree())
 
-		t := NewTree(root)
+		log.Printf("time elapsed to generate: %s", time.Now().Sub(start))
+	}
+
+	return trees, nil
+}
 
-		log.Printf("Type:%s SrcIP:%v DstIP:%v SrcPort:%v DstPort:%v",
-			firstMsg.GetType(), firstMsg.SrcIP, firstMsg.DstIP, firstMsg.SrcPort, firstMsg.DstPort)
+// builder builds the FlowTree of a payload UID one packet at a time,
+// packets must be added in capture order.
+type builder struct {
+	g     *Generator
+	id    string
+	tree  *Tree
+	ft    *FlowTree
+	prime int
+	// loops holds the nodes closing a loop
+	loops map[*Node]bool
+}
 
-		ft := NewFlowTree(k, firstMsg)
+// newBuilder returns a builder for the FlowTree of the given payload UID
+// rooted at the node connected to the device of its first packet
+func (g *Generator) newBuilder(id string, first packets.Packet) *builder {
+	root := NewNode(g.getConnectedNode(first.Device), g.getConnectedNode(first.Device))
 
-		prime := 0
+	log.Printf("Type:%s SrcIP:%v DstIP:%v SrcPort:%v DstPort:%v",
+		first.GetType(), first.SrcIP, first.DstIP, first.SrcPort, first.DstPort)
 
-		for _, p := range packets[k] {
+	return &builder{g: g, id: id, tree: NewTree(root), ft: NewFlowTree(id, first), loops: make(map[*Node]bool)}
+}
 
-			*p.CapturedAt = time.Unix(0, p.CapturedAtNano) // TODO: Move to another place!
-
-			level := t.LeafsLevel
-
-		step4:
-
-			log.Printf("Device %+v, level: %d", p.Device, level)
-
-			n := t.FindNodeByLevel(strings.Split(p.Device, "-")[0], level)
-			log.Printf("FindNodeByLevel node:%s, level: %d, found: %+v", strings.Split(p.Device, "-")[0], level, n)
-
-			if n != nil {
-				connected := g.getConnectedNode(p.Device)
-				log.Printf("Connected Node: %s", connected)
-
-				if n.Parent != nil &&
-					n.Parent.Name == connected &&
-					n.TimeOfIngress.IsZero() &&
-					n.Parent.TimeOfEgress.Before(*p.CapturedAt) {
-
-					n.TimeOfIngress = p.CapturedAt
-				} else if n.Parent != nil &&
-					!n.TimeOfIngress.IsZero() &&
-					n.TimeOfIngress.Before(*p.CapturedAt) {
-
-					var name string
-					if d := t.FindNode(connected); d == nil {
-						name = connected
-					} else {
-						name = fmt.Sprintf("%s_%d", connected, prime)
-						prime++
-					}
-					log.Printf("Creating a node name: %s, label: %s, to attach to: %s", name, connected, n.Name)
-					nn := NewNode(name, connected)
-					nn.TimeOfEgress = p.CapturedAt
-					n.AddChild(nn)
-					t.AddNode(nn)
-				} else {
-					//the root level is not the current level
-					if level > 1 {
-						level--
-						goto step4
-					}
-					log.Print("error: disconnected data-path")
-				}
+// add places a packet in the tree and returns the node it created, nil
+// when the packet only updated an existing node or could not be placed
+func (b *builder) add(p packets.Packet) *Node {
+	g, t := b.g, b.tree
 
-			} else if n := t.FindNodeByLevel(g.getConnectedNode(p.Device), level); n != nil {
+	if p.CapturedAtNano != 0 {
+		*p.CapturedAt = time.Unix(0, p.CapturedAtNano) // TODO: Move to another place!
+	}
 
-				s := strings.Split(p.Device, "-")[0]
+	level := t.LeafsLevel
 
-				log.Printf("Creating a node: %s, from device: %s to attach to: %s", s, p.Device, n.Name)
+step4:
 
-				var name string
-				if d := t.FindNode(s); d == nil {
-					name = s
-				} else {
-					name = fmt.Sprintf("%s_%d", s, prime)
-					prime++
-				}
+	log.Printf("Device %+v, level: %d", p.Device, level)
+
+	n := t.FindNodeByLevel(strings.Split(p.Device, "-")[0], level)
+	log.Printf("FindNodeByLevel node:%s, level: %d, found: %+v", strings.Split(p.Device, "-")[0], level, n)
+
+	if n != nil {
+		connected := g.getConnectedNode(p.Device)
+		log.Printf("Connected Node: %s", connected)
+
+		if n.Parent != nil &&
+			n.Parent.Name == connected &&
+			n.TimeOfIngress.IsZero() &&
+			n.Parent.TimeOfEgress.Before(*p.CapturedAt) {
 
-				c := NewNode(name, s)
-				c.TimeOfIngress = p.CapturedAt
-				n.AddChild(c)
-				t.AddNode(c)
+			n.TimeOfIngress = p.CapturedAt
+			n.Interfaces = append(n.Interfaces, p.Device)
+		} else if n.Parent != nil &&
+			!n.TimeOfIngress.IsZero() &&
+			n.TimeOfIngress.Before(*p.CapturedAt) {
+
+			var name string
+			if d := t.FindNode(connected); d == nil {
+				name = connected
 			} else {
-				//the root level is not the current level
-				if level > 1 {
-					level--
-					goto step4
-				}
-				log.Print("error: disconnected data-path")
+				name = fmt.Sprintf("%s_%d", connected, b.prime)
+				b.prime++
 			}
+			log.Printf("Creating a node name: %s, label: %s, to attach to: %s", name, connected, n.Name)
+			nn := NewNode(name, connected)
+			nn.TimeOfEgress = p.CapturedAt
+			n.Interfaces = append(n.Interfaces, p.Device)
+			n.AddChild(nn)
+			t.AddNode(nn)
+			b.checkLoop(nn)
+			return nn
+		} else {
+			//the root level is not the current level
+			if level > 1 {
+				level--
+				goto step4
+			}
+			log.Print("error: disconnected data-path")
+			b.disconnected(p, strings.Split(p.Device, "-")[0])
 		}
 
-		label := fmt.Sprintf("%s %s", ft.Type, ft.DstPort)
-		dotStr := string(t.ToDOT(k, label))
+	} else if n := t.FindNodeByLevel(g.getConnectedNode(p.Device), level); n != nil {
 
-		fname := fmt.Sprintf("%s.dot", k[:len(k)-10])
+		s := strings.Split(p.Device, "-")[0]
 
-		dotGraph, err := dot.Generate(fname, dotStr)
-		if err != nil {
-			log.Printf("error generating flow trees, %s", err.Error())
+		log.Printf("Creating a node: %s, from device: %s to attach to: %s", s, p.Device, n.Name)
+
+		var name string
+		if d := t.FindNode(s); d == nil {
+			name = s
+		} else {
+			name = fmt.Sprintf("%s_%d", s, b.prime)
+			b.prime++
 		}
 
-		ft.Nodes = dotStr
-		ft.NodesImg = dotGraph
-		ft.Level = t.LeafsLevel
-		ft.Edges = t.Edges()
+		c := NewNode(name, s)
+		c.TimeOfIngress = p.CapturedAt
+		c.Interfaces = []string{p.Device}
+		n.AddChild(c)
+		t.AddNode(c)
+		b.checkLoop(c)
+		return c
+	} else {
+		//the root level is not the current level
+		if level > 1 {
+			level--
+			goto step4
+		}
+		log.Print("error: disconnected data-path")
+		b.disconnected(p, strings.Split(p.Device, "-")[0])
+	}
+	return nil
+}
 
-		trees = append(trees, *ft)
+// flowTree returns the FlowTree of the packets added so far along with
+// its DOT representation and image
+func (b *builder) flowTree() FlowTree {
+	ft := *b.ft
 
-		log.Printf("time elapsed to generate: %s", time.Now().Sub(start))
+	if !b.g.topo.ID.IsZero() {
+		ft.Topology = b.g.topo.ID.Hex()
 	}
+	ft.Anomalies = append(append([]Anomaly(nil), b.ft.Anomalies...), b.checkLeaves()...)
+	ft.Latencies, ft.Paths = b.tree.latencies()
+	ft.Expected = b.expect()
 
-	return trees, nil
+	label := fmt.Sprintf("%s %s", ft.Type, ft.DstPort)
+	dotStr := string(b.tree.ToDOT(b.id, label))
+
+	if highlighted, err := highlightLoops(dotStr, ft.Anomalies, false); err != nil {
+		log.Printf("error highlighting loops, %s", err.Error())
+	} else {
+		dotStr = highlighted
+	}
+	if labeled, err := labelLatencies(dotStr, ft.Latencies); err != nil {
+		log.Printf("error labeling latencies, %s", err.Error())
+	} else {
+		dotStr = labeled
+	}
+
+	dotGraph, mime, err := dot.Generate(dotStr)
+	if err != nil {
+		log.Printf("error generating flow trees, %s", err.Error())
+	}
+
+	ft.Nodes = dotStr
+	ft.NodesImg = dotGraph
+	ft.NodesImgType = mime
+	ft.Level = b.tree.LeafsLevel
+	ft.Edges = b.tree.Edges()
+	return ft
 }
 
 // Merge merges a grouped set/slice of FlowTree and returns
-// a new slice of them merged.
+// a new slice of them merged. The members already verified keep their
+// results, only the merged view of each group is verified again.
 func (g *Generator) Merge(grouped map[string][]FlowTree) ([]FlowTree, error) {
 
 	var trees []FlowTree
 	for k := range grouped {
 		var toMerge []FlowTree
-		var filesToMerge []string
 		var merged FlowTree
 		i := 1
 		edges := make(map[int][]Edge)
 		for _, ft := range grouped[k] {
 
 			if ft.Level > 2 {
-				fname := fmt.Sprintf("%s.dot", ft.ID[:len(ft.ID)-10])
-				err := dot.Write(fname, ft.Nodes)
-				if err != nil {
-					log.Printf("error writing file %s, %s", fname, err)
-				}
-				filesToMerge = append(filesToMerge, fname)
 				toMerge = append(toMerge, ft)
 				merged = ft
 				for _, e := range ft.Edges {
@@ -214,29 +306,40 @@ func (g *Generator) Merge(grouped map[string][]FlowTree) ([]FlowTree, error) {
 					edges[i] = e
 					i++
 				}
-				ft.IsSat = g.smt(edges)
+				if len(ft.Results) == 0 {
+					g.verifyTree(&ft, edges)
+				}
 				trees = append(trees, ft)
 			}
 		}
 
-		if len(filesToMerge) > 0 {
+		if len(toMerge) > 0 {
 
-			fname := fmt.Sprintf("%s.dot", merged.ID[:len(merged.ID)-10])
-
-			mergedStr, err := dot.Merge(filesToMerge)
-			if err != nil {
-				log.Printf("error merging files, %s", err.Error())
+			m := NewMergedGraph(fmt.Sprintf("%s %s", merged.Type, merged.DstPort))
+			var anomalies []Anomaly
+			for _, ft := range toMerge {
+				m.AddPaths(ft.ID, ft.Edges)
+				anomalies = append(anomalies, ft.Anomalies...)
+			}
+			mergedStr := m.ToDOT()
+			if highlighted, err := highlightLoops(mergedStr, anomalies, true); err != nil {
+				log.Printf("error highlighting loops, %s", err.Error())
+			} else {
+				mergedStr = highlighted
 			}
 
-			dotGraph, err := dot.Generate(fname, mergedStr)
+			dotGraph, mime, err := dot.Generate(mergedStr)
 			if err != nil {
-				log.Printf("error generating dot from merged files, %s", err.Error())
+				log.Printf("error generating dot from merged graphs, %s", err.Error())
 			}
 
 			merged.Nodes = mergedStr
 			merged.NodesImg = dotGraph
+			merged.NodesImgType = mime
+			merged.Merged = m
+			merged.Anomalies = anomalies
 
-			merged.IsSat = g.smt(edges)
+			g.verifyTree(&merged, edges)
 			trees = append(trees, merged)
 		}
 	}
@@ -248,93 +351,98 @@ func (g *Generator) Merge(grouped map[string][]FlowTree) ([]FlowTree, error) {
 	return trees, nil
 }
 
-type inputParams struct {
-	EdgesCount int
-	Edges      map[int][]Edge
-	Hosts      []string
-	Switches   []string
-	DataPlane  []Edge
+// Verify checks the stored SMT properties against a single FlowTree
+func (g *Generator) Verify(ft *FlowTree) {
+	edges := make(map[int][]Edge)
+	for i, e := range ft.Edges {
+		edges[i+1] = e
+	}
+	g.verifyTree(ft, edges)
 }
 
-func (g *Generator) smt(edges map[int][]Edge) bool {
-
-	funcMap := template.FuncMap{
-		// The name "inc" is what the function will be called in the template text.
-		"inc": func(i int) int {
-			return i + 1
-		},
-	}
-	tmpl := template.Must(template.New("smt.tmpl").Funcs(funcMap).ParseFiles("/app/templates/smt.tmpl"))
+// verifyTree verifies the given paths of a tree and highlights the edges
+// of the counterexamples found in its DOT representation
+func (g *Generator) verifyTree(ft *FlowTree, edges map[int][]Edge) {
+	ft.setResults(g.verify(edges))
 
-	var hosts []string
-	for _, h := range g.topo.Hosts {
-		hosts = append(hosts, h)
+	var highlighted []Edge
+	for _, r := range ft.Results {
+		if r.Counterexample == nil {
+			continue
+		}
+		for _, e := range r.Counterexample.Edges {
+			highlighted = append(highlighted, Edge{Src: e.Src, Dst: e.Dst})
+		}
 	}
-	var switches []string
-	for _, s := range g.topo.Switches {
-		switches = append(switches, s)
+	if len(highlighted) == 0 {
+		return
 	}
 
-	dataPlane := EdgesFromString(g.topo.DOT)
-
-	params := inputParams{len(edges), edges, hosts, switches, dataPlane}
-
-	var tplCompiled bytes.Buffer
-	err := tmpl.Execute(&tplCompiled, params)
+	dotStr, err := HighlightEdges(ft.Nodes, highlighted, "red")
 	if err != nil {
-		log.Printf("error generating smt formula %s", err.Error())
+		log.Printf("error highlighting counterexamples, %s", err.Error())
+		return
 	}
+	ft.Nodes = dotStr
 
-	fname := fmt.Sprintf("/app/scripts/%d.z3", time.Now().UnixNano())
-	f, err := os.Create(fname)
-	os.Chmod(fname, 0755)
+	dotGraph, mime, err := dot.Generate(dotStr)
 	if err != nil {
-		log.Printf("error creating file %s", err)
+		log.Printf("error generating flow trees, %s", err.Error())
+		return
 	}
-	defer f.Close()
+	ft.NodesImg = dotGraph
+	ft.NodesImgType = mime
+}
 
-	content := fmt.Sprintf("%s%s", tplCompiled.String(), g.props[0].Text) //TODO: needs to be extended to more than 1
-	_, err = f.WriteString(content)
-	if err != nil {
-		log.Printf("error writing string to file %s", err)
-	}
+// verify checks every property against the given paths, each property is
+// appended to the SMT encoding of the paths and solved independently
+func (g *Generator) verify(edges map[int][]Edge) []smt.Result {
 
-	f.Sync()
-	log.Printf("%s", content)
-	r := solve(fname)
-	log.Printf("%s", r)
-	if r == "sat" {
-		return true
+	results := []smt.Result{}
+	if len(g.props) == 0 {
+		return results
 	}
 
-	return false
+	formula, err := g.formula(edges)
+
+	for _, p := range g.props {
+		r := smt.Result{PropertyID: p.ID, Title: p.Title}
+		if err != nil {
+			r.Verdict = smt.Error
+			r.Error = err.Error()
+			results = append(results, r)
+			continue
+		}
+
+		o, err := g.solver.Solve(context.Background(), fmt.Sprintf("%s%s", formula, p.Text))
+		r.Verdict = o.Verdict
+		r.SolverTime = o.Duration
+		r.Model = o.Model
+		r.Counterexample = counterexample(o, edges)
+		if err != nil {
+			r.Error = err.Error()
+		}
+		log.Printf("property %s (%s): %s", p.Title, p.ID.Hex(), r.Verdict)
+		results = append(results, r)
+	}
+	return results
 }
 
-func solve(file string) string {
-	args := []string{"/app/scripts/solver.py"}
-	args = append(args, file)
+// formula renders the SMT encoding of the given paths and the topology
+func (g *Generator) formula(edges map[int][]Edge) (string, error) {
 
-	cmd := exec.Command("/usr/bin/python", args...)
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		log.Printf("error executing cmd: %s, %s", err, stderr.String())
-		return ""
+	var dataPlane []Edge
+	for _, l := range g.topo.Links {
+		dataPlane = append(dataPlane, Edge{l.A.Node, l.B.Node})
 	}
-	return strings.TrimSpace(out.String())
+
+	return g.enc.render(inputParams{len(edges), edges, g.topo.Hosts(), g.topo.Switches(), dataPlane})
 }
 
 func (g *Generator) getConnectedNode(d string) string {
 
-	for _, l := range g.topo.Links {
-		h := strings.Split(l, ":")[0]
-		iface := strings.Split(l, ":")[1]
-		if d == iface {
-			return h
-		}
+	if e, ok := g.index.Peer(d); ok {
+		return e.Node
 	}
 	log.Printf("Not found for %s ", d)
 	return "N/A"
@@ -2,12 +2,18 @@ package tree
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/letitbeat/dp-analyzer/pkg/clock"
 	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/session"
 	"github.com/letitbeat/dp-analyzer/pkg/smt"
 	"github.com/letitbeat/dp-analyzer/pkg/topology"
 )
@@ -17,61 +23,413 @@ type Handler struct {
 	packetsRepo packets.Repository
 	topoRepo    topology.Repository
 	smtRepo     smt.Repository
+	treeRepo    Repository
+	solver      smt.Solver
+	enc         *Encoding
+	skew        *clock.Skew
+	sessions    session.Repository
 }
 
-// NewHandler returns a new FlowTree Handler
-func NewHandler(repo packets.Repository, topoRepo topology.Repository, smtRepo smt.Repository) *Handler {
-	return &Handler{repo, topoRepo, smtRepo}
+// NewHandler returns a new FlowTree Handler verifying the trees with solver
+// against their paths encoded by enc, the capture time of the observations
+// is corrected by skew before building their trees and the trees of the
+// archived sessions are left out of the listings
+func NewHandler(repo packets.Repository, topoRepo topology.Repository, smtRepo smt.Repository, treeRepo Repository, solver smt.Solver, enc *Encoding, skew *clock.Skew, sessions session.Repository) *Handler {
+	return &Handler{repo, topoRepo, smtRepo, treeRepo, solver, enc, skew, sessions}
 }
 
 // GetAll handles HTTP GET requests and returns a JSON representation of
-// the generated FlowTrees
+// the stored FlowTrees, merged by group, only the ones of the session
+// given by the optional session parameter
 func (h *Handler) GetAll(response http.ResponseWriter, request *http.Request) {
 
-	pks, err := h.packetsRepo.FindAll()
+	q, ok := h.parseQuery(response, request)
+	if !ok {
+		return
+	}
+
+	groups, err := h.treeRepo.FindGroups()
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	trees := []FlowTree{}
+	for _, ft := range groups {
+		if q.visible(ft) {
+			trees = append(trees, ft)
+		}
+	}
+
+	err = json.NewEncoder(response).Encode(trees)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Get handles HTTP GET requests and returns a JSON representation of the
+// FlowTree of a single payload UID. Trees not finished yet are built from
+// the observations stored so far.
+func (h *Handler) Get(response http.ResponseWriter, request *http.Request) {
+
+	id := mux.Vars(request)["id"]
+
+	ft, err := h.treeRepo.FindByID(id)
+	if err == nil {
+		ft.Expected.render()
+		err = json.NewEncoder(response).Encode(ft)
+		if err != nil {
+			writeErr(response, err)
+		}
+		return
+	}
+	if err != ErrNotFound {
+		writeErr(response, err)
+		return
+	}
+
+	pks, err := h.packetsRepo.FindByPayload(id)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	if len(pks) == 0 {
+		writeNotFound(response, fmt.Errorf("flow tree %s not found", id))
+		return
+	}
+	pks = h.skew.CorrectAll(pks)
+
+	g, err := newGenerator(h.topoRepo, h.smtRepo, h.solver, h.enc, firstCapture(pks))
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	trees, err := g.Generate(map[string][]packets.Packet{id: pks})
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	built := trees[0]
+	g.Verify(&built)
+	built.Expected.render()
+
+	err = json.NewEncoder(response).Encode(built)
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Page is a page of flow trees, NextCursor is empty on the last page
+type Page struct {
+	Trees      []FlowTree `json:"trees"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// Find handles HTTP GET requests and returns a page of the stored
+// FlowTrees matching the query parameters, see ParseQuery.
+func (h *Handler) Find(response http.ResponseWriter, request *http.Request) {
+
+	q, ok := h.parseQuery(response, request)
+	if !ok {
+		return
+	}
+
+	page, err := h.treeRepo.FindPage(q)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(page)
 	if err != nil {
 		writeErr(response, err)
 	}
+}
+
+// Anomalies handles HTTP GET requests and returns the number of anomalies
+// of the stored FlowTrees matching the query parameters, see ParseQuery,
+// in total and per switch. The cursor and limit are ignored.
+func (h *Handler) Anomalies(response http.ResponseWriter, request *http.Request) {
+
+	q, ok := h.parseQuery(response, request)
+	if !ok {
+		return
+	}
+
+	trees, err := h.treeRepo.FindMatching(q)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(Summarize(trees))
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Latency handles HTTP GET requests and returns the latency percentiles
+// per link and per switch of the stored FlowTrees matching the query
+// parameters, see ParseQuery, e.g. captured between from and to. The
+// cursor and limit are ignored.
+func (h *Handler) Latency(response http.ResponseWriter, request *http.Request) {
+
+	q, ok := h.parseQuery(response, request)
+	if !ok {
+		return
+	}
+
+	trees, err := h.treeRepo.FindMatching(q)
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+
+	err = json.NewEncoder(response).Encode(SummarizeLatencies(trees))
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// Compare handles HTTP GET requests comparing the stored FlowTrees of a
+// baseline and a candidate run, each given by a session or a time window,
+// see ParseWindow and Compare. The comparison is returned as JSON, or as
+// an HTML report with format=html.
+func (h *Handler) Compare(response http.ResponseWriter, request *http.Request) {
+
+	query := request.URL.Query()
+	baseline, err := ParseWindow(query, "baseline")
+	if err != nil {
+		writeBadRequest(response, err)
+		return
+	}
+	candidate, err := ParseWindow(query, "candidate")
+	if err != nil {
+		writeBadRequest(response, err)
+		return
+	}
+
+	baselineTrees, err := h.treeRepo.FindMatching(baseline.query())
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	candidateTrees, err := h.treeRepo.FindMatching(candidate.query())
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	c := Compare(baseline, candidate, baselineTrees, candidateTrees)
+
+	if query.Get("format") == "html" {
+		response.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = c.WriteHTML(response)
+	} else {
+		err = json.NewEncoder(response).Encode(c)
+	}
+	if err != nil {
+		writeErr(response, err)
+	}
+}
+
+// RebuildResult holds the number of trees and groups rebuilt
+type RebuildResult struct {
+	Trees  int `json:"trees"`
+	Groups int `json:"groups"`
+}
+
+// Rebuild handles HTTP POST requests rebuilding, verifying and storing the
+// FlowTrees of every stored observation, or of the observations of the
+// session given by the optional session parameter, e.g. after observations
+// have been imported while the server was not running.
+func (h *Handler) Rebuild(response http.ResponseWriter, request *http.Request) {
+
+	var pks []packets.Packet
+	var err error
+	if id := request.URL.Query().Get("session"); id != "" {
+		pks, err = h.packetsRepo.FindBySession(id)
+	} else {
+		pks, err = h.packetsRepo.FindAll()
+	}
+	if err != nil {
+		writeErr(response, err)
+		return
+	}
+	pks = h.skew.CorrectAll(pks)
 
 	packetsMap := make(map[string][]packets.Packet)
 	for _, p := range pks {
+		if p.Payload == "" {
+			continue
+		}
 		packetsMap[p.Payload] = append(packetsMap[p.Payload], p)
 	}
 
-	topology, err := h.topoRepo.FindAll()
+	generators, err := h.generators(packetsMap)
 	if err != nil {
 		writeErr(response, err)
+		return
 	}
 
-	props, err := h.smtRepo.FindAll()
+	result := RebuildResult{}
+	for g, pm := range generators {
+		trees, err := g.Generate(pm)
+		if err != nil {
+			writeErr(response, err)
+			return
+		}
+		for i := range trees {
+			g.Verify(&trees[i])
+		}
+
+		groups, err := persist(h.treeRepo, g, trees...)
+		if err != nil {
+			writeErr(response, err)
+			return
+		}
+		result.Trees += len(trees)
+		result.Groups += groups
+	}
+
+	err = json.NewEncoder(response).Encode(result)
 	if err != nil {
 		writeErr(response, err)
 	}
+}
 
-	g := NewGenerator(topology[0], props)
+// parseQuery parses the query parameters of the request, see ParseQuery,
+// hiding the trees of the archived sessions. It writes the error response
+// and returns false when they cannot be parsed.
+func (h *Handler) parseQuery(response http.ResponseWriter, request *http.Request) (Query, bool) {
+	q, err := ParseQuery(request.URL.Query())
+	if err != nil {
+		writeBadRequest(response, err)
+		return q, false
+	}
+	if h.sessions == nil {
+		return q, true
+	}
 
-	trees, err := g.Generate(packetsMap)
+	sessions, err := h.sessions.FindAll()
 	if err != nil {
 		writeErr(response, err)
+		return q, false
+	}
+	for _, s := range sessions {
+		if s.Status == session.Archived {
+			q.Hide(s.ID.Hex())
+		}
 	}
+	return q, true
+}
 
-	grouped := make(map[string][]FlowTree)
+// persist stores finished trees and refreshes the merged views of their
+// groups, it returns the number of groups refreshed
+func persist(repo Repository, g *Generator, trees ...FlowTree) (int, error) {
+	groups := make(map[string]FlowTree)
+	for _, ft := range trees {
+		if err := repo.Store(ft); err != nil {
+			return 0, err
+		}
+		groups[ft.Group()] = ft
+	}
 
-	for _, t := range trees {
-		capturedAt := time.Unix(0, t.CapturedAt)
-		key := fmt.Sprintf("%s%s%s", t.Type, t.DstPort, capturedAt.Format(time.RFC3339))
-		grouped[key] = append(grouped[key], t)
+	for key, ft := range groups {
+		members, err := repo.FindByGroup(ft)
+		if err != nil {
+			return 0, err
+		}
+		merged, err := g.Merge(map[string][]FlowTree{key: members})
+		if err != nil {
+			return 0, err
+		}
+		if err := repo.StoreGroup(key, merged); err != nil {
+			return 0, err
+		}
 	}
+	return len(groups), nil
+}
 
-	final, err := g.Merge(grouped)
+// generators returns a Generator for every topology version active at the
+// capture time of the first observation of a payload UID, along with the
+// observations of the payload UIDs to build with it
+func (h *Handler) generators(packetsMap map[string][]packets.Packet) (map[*Generator]map[string][]packets.Packet, error) {
+	topos, err := h.topoRepo.FindAll()
 	if err != nil {
-		writeErr(response, err)
+		return nil, err
+	}
+	if len(topos) == 0 {
+		return nil, errNoTopology
 	}
 
-	err = json.NewEncoder(response).Encode(final)
+	props, err := h.smtRepo.FindAll()
 	if err != nil {
-		writeErr(response, err)
+		return nil, err
+	}
+
+	versions := make(map[primitive.ObjectID]*Generator)
+	generators := make(map[*Generator]map[string][]packets.Packet)
+	for id, pks := range packetsMap {
+		topo, err := topology.ActiveAt(topos, firstCapture(pks))
+		if err != nil {
+			return nil, err
+		}
+		g, ok := versions[topo.ID]
+		if !ok {
+			g = NewGenerator(*topo, props, h.solver, h.enc)
+			versions[topo.ID] = g
+			generators[g] = make(map[string][]packets.Packet)
+		}
+		generators[g][id] = pks
+	}
+	return generators, nil
+}
+
+var errNoTopology = errors.New("no topology has been set")
+
+// newGenerator returns a Generator using the stored properties and the
+// topology version active at the given time
+func newGenerator(topoRepo topology.Repository, smtRepo smt.Repository, solver smt.Solver, enc *Encoding, at time.Time) (*Generator, error) {
+	topo, err := topoRepo.FindAt(at)
+	if err == topology.ErrNotFound {
+		return nil, errNoTopology
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := smtRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGenerator(*topo, props, solver, enc), nil
+}
+
+// firstCapture returns the capture time of the earliest observation
+func firstCapture(pks []packets.Packet) time.Time {
+	first := pks[0].CapturedAtNano
+	for _, p := range pks {
+		if p.CapturedAtNano < first {
+			first = p.CapturedAtNano
+		}
 	}
+	return time.Unix(0, first)
+}
+
+func writeBadRequest(response http.ResponseWriter, err error) {
+	writeStatus(response, http.StatusBadRequest, err)
+}
+
+func writeNotFound(response http.ResponseWriter, err error) {
+	writeStatus(response, http.StatusNotFound, err)
+}
+
+func writeStatus(response http.ResponseWriter, status int, err error) {
+	msg := fmt.Sprintf(`{"message" : "%s"}`, err.Error())
+	response.WriteHeader(status)
+	response.Write([]byte(msg))
 }
 
 func writeErr(response http.ResponseWriter, err error) {
@@ -0,0 +1,143 @@
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func TestRebuildVersions(t *testing.T) {
+	base := time.Date(2019, 3, 16, 17, 0, 0, 0, time.UTC)
+
+	// s2 is replaced by s3 an hour after the first version
+	topoRepo := topology.NewMemoryRepository()
+	v1 := topology.Legacy{Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"}}.Topology()
+	v1.CreatedAt = base
+	v2 := topology.Legacy{Links: []string{"h1:s1-eth1", "s3:s1-eth2", "s1:s3-eth1", "h2:s3-eth2"}}.Topology()
+	v2.CreatedAt = base.Add(time.Hour)
+	topoRepo.Store(v2)
+	topoRepo.Store(v1)
+	versions, _ := topoRepo.FindAll()
+
+	packetsRepo := packets.NewMemoryRepository()
+	for id, at := range map[string]time.Time{"before": base.Add(time.Minute), "after": base.Add(2 * time.Hour)} {
+		for i, device := range []string{"s1-eth1", "s1-eth2"} {
+			at := at.Add(time.Duration(i) * time.Millisecond)
+			packetsRepo.Store(packets.Packet{Device: device, Payload: id, DstPort: "80", CapturedAt: &at, CapturedAtNano: at.UnixNano()})
+		}
+	}
+
+	treeRepo := NewMemoryRepository()
+	h := NewHandler(packetsRepo, topoRepo, smt.NewMemoryRepository(), treeRepo, &smt.MockSolver{}, nil, nil, nil)
+	recorder := httptest.NewRecorder()
+	h.Rebuild(recorder, httptest.NewRequest(http.MethodPost, "/trees/rebuild", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d, %s", recorder.Code, recorder.Body)
+	}
+
+	for id, c := range map[string]struct {
+		version topology.Topology
+		leaf    string
+	}{
+		"before": {versions[0], "s2"},
+		"after":  {versions[1], "s3"},
+	} {
+		ft, err := treeRepo.FindByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ft.Topology != c.version.ID.Hex() {
+			t.Errorf("%s: expected the topology version %s, got %s", id, c.version.ID.Hex(), ft.Topology)
+		}
+		if leaf := ft.Edges[0][len(ft.Edges[0])-1].Dst; leaf != c.leaf {
+			t.Errorf("%s: unexpected leaf %s", id, leaf)
+		}
+	}
+}
+
+func TestPersistVerifiesMergedViewOnce(t *testing.T) {
+	enc, err := LoadEncoding("../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	solver := &smt.MockSolver{Outcome: smt.Outcome{Verdict: smt.Sat}}
+	props := []smt.Property{{ID: primitive.NewObjectID(), Title: "reaches h2", Text: "(check-sat)"}}
+	g := NewGenerator(topology.Legacy{
+		Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"},
+	}.Topology(), props, solver, enc)
+
+	start := time.Now()
+	treeRepo := NewMemoryRepository()
+	for i, devices := range [][]string{{"s1-eth1"}, {"s1-eth1", "s1-eth2", "s2-eth1"}, {"s1-eth1", "s1-eth2", "s2-eth1"}} {
+		var pks []packets.Packet
+		for j, device := range devices {
+			p := streamPacket(device, start.Add(time.Duration(10*i+j)*time.Millisecond))
+			p.Payload = fmt.Sprintf("payload-%d", i)
+			pks = append(pks, p)
+		}
+		trees, err := g.Generate(map[string][]packets.Packet{pks[0].Payload: pks})
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Verify(&trees[0])
+
+		// the members stored before are not verified again
+		before := len(solver.Formulas())
+		if _, err := persist(treeRepo, g, trees[0]); err != nil {
+			t.Fatal(err)
+		}
+		if solved := len(solver.Formulas()) - before; i > 0 && solved != 1 {
+			t.Errorf("tree %d: expected the merged view alone to be verified, got %d verifications", i, solved)
+		}
+	}
+
+	// the group holds the short tree and the merged view of the others
+	groups, err := treeRepo.FindGroups()
+	if err != nil || len(groups) != 2 {
+		t.Fatalf("expected 2 trees in the group, got %d, %v", len(groups), err)
+	}
+	for _, ft := range groups {
+		if len(ft.Results) != 1 || ft.Results[0].Verdict != smt.Sat {
+			t.Errorf("%s: expected the property to be satisfied, got %+v", ft.ID, ft.Results)
+		}
+		if (ft.Merged != nil) != (ft.Level > 2) {
+			t.Errorf("%s: expected the trees of 3 levels to be merged", ft.ID)
+		}
+	}
+}
+
+func TestCompareHandler(t *testing.T) {
+	treeRepo := NewMemoryRepository()
+	path := []Edge{{"h1", "s1"}, {"s1", "s2"}}
+	for _, ft := range []FlowTree{
+		{ID: "a", Session: "before", Type: "ICMP", Edges: [][]Edge{path}},
+		{ID: "b", Session: "after", Type: "ICMP", Edges: [][]Edge{path[:1]}},
+		{ID: "c", Session: "other", Type: "UDP", Edges: [][]Edge{path}},
+	} {
+		treeRepo.Store(ft)
+	}
+
+	h := NewHandler(packets.NewMemoryRepository(), topology.NewMemoryRepository(), smt.NewMemoryRepository(), treeRepo, nil, nil, nil, nil)
+	recorder := httptest.NewRecorder()
+	h.Compare(recorder, httptest.NewRequest(http.MethodGet, "/trees/compare?baseline=before&candidate=after", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d, %s", recorder.Code, recorder.Body)
+	}
+
+	var c Comparison
+	if err := json.NewDecoder(recorder.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Summary.Flows != 1 || c.Summary.Changed != 1 {
+		t.Errorf("expected the ICMP flow of the sessions alone to change, got %+v", c.Summary)
+	}
+}
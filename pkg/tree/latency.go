@@ -0,0 +1,205 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// Latency is the measured latency of a flow tree edge in nanoseconds.
+// Transit is the time spent in Src, from its ingress to its egress towards
+// Dst, and Link the time from the egress of Src to the ingress of Dst.
+// Either is nil when one of its timestamps was not observed.
+type Latency struct {
+	// Src and Dst are the names of the nodes of the edge
+	Src      string `json:"src" bson:"src"`
+	Dst      string `json:"dst" bson:"dst"`
+	SrcLabel string `json:"src_label" bson:"src_label"`
+	DstLabel string `json:"dst_label" bson:"dst_label"`
+	Transit  *int64 `json:"transit,omitempty" bson:"transit,omitempty"`
+	Link     *int64 `json:"link,omitempty" bson:"link,omitempty"`
+}
+
+// Total returns the sum of the measured latencies of the edge
+func (l Latency) Total() int64 {
+	var total int64
+	if l.Transit != nil {
+		total += *l.Transit
+	}
+	if l.Link != nil {
+		total += *l.Link
+	}
+	return total
+}
+
+// PathDelay is the end to end delay of a root to leaf path, the time in
+// nanoseconds between its first and its last observation
+type PathDelay struct {
+	// Nodes are the names of the nodes from the root to the leaf
+	Nodes []string `json:"nodes" bson:"nodes"`
+	Delay int64    `json:"delay" bson:"delay"`
+}
+
+// latencies returns the latencies of every edge of the tree and the delay
+// of every path observed at least twice
+func (t *Tree) latencies() ([]Latency, []PathDelay) {
+	var latencies []Latency
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, c := range n.Children {
+			l := Latency{Src: n.Name, Dst: c.Name, SrcLabel: n.Label, DstLabel: c.Label}
+			l.Transit = between(n.TimeOfIngress, c.TimeOfEgress)
+			l.Link = between(c.TimeOfEgress, c.TimeOfIngress)
+			latencies = append(latencies, l)
+			walk(c)
+		}
+	}
+	walk(t.Root)
+
+	var paths []PathDelay
+	for _, path := range t.DFS(t.Root) {
+		var first, last time.Time
+		names := make([]string, len(path))
+		for i, n := range path {
+			names[len(path)-1-i] = n.Name
+			for _, at := range []*time.Time{n.TimeOfIngress, n.TimeOfEgress} {
+				if at == nil || at.IsZero() {
+					continue
+				}
+				if first.IsZero() || at.Before(first) {
+					first = *at
+				}
+				if last.IsZero() || at.After(last) {
+					last = *at
+				}
+			}
+		}
+		if first.Equal(last) {
+			continue
+		}
+		paths = append(paths, PathDelay{Nodes: names, Delay: last.Sub(first).Nanoseconds()})
+	}
+	return latencies, paths
+}
+
+// between returns the nanoseconds from a to b, nil when either was not
+// observed
+func between(a, b *time.Time) *int64 {
+	if a == nil || b == nil || a.IsZero() || b.IsZero() {
+		return nil
+	}
+	d := b.Sub(*a).Nanoseconds()
+	return &d
+}
+
+// labelLatencies labels the edges of the DOT graph with their measured
+// latency in milliseconds
+func labelLatencies(dotStr string, latencies []Latency) (string, error) {
+	labels := make(map[Edge]string)
+	for _, l := range latencies {
+		if l.Transit != nil || l.Link != nil {
+			labels[Edge{Src: l.Src, Dst: l.Dst}] = fmt.Sprintf(`"%.3fms"`, float64(l.Total())/float64(time.Millisecond))
+		}
+	}
+	if len(labels) == 0 {
+		return dotStr, nil
+	}
+
+	g, err := gographviz.Read([]byte(dotStr))
+	if err != nil {
+		return dotStr, err
+	}
+	for _, e := range g.Edges.Edges {
+		if label, ok := labels[Edge{Src: e.Src, Dst: e.Dst}]; ok {
+			if e.Attrs == nil {
+				e.Attrs = make(gographviz.Attrs)
+			}
+			e.Attrs.Add("label", label)
+		}
+	}
+	return g.String(), nil
+}
+
+// LatencyStats holds the percentiles, in nanoseconds, of the latencies
+// measured on a link or in a switch
+type LatencyStats struct {
+	Src    string `json:"src,omitempty"`
+	Dst    string `json:"dst,omitempty"`
+	Switch string `json:"switch,omitempty"`
+	Count  int    `json:"count"`
+	Min    int64  `json:"min"`
+	P50    int64  `json:"p50"`
+	P90    int64  `json:"p90"`
+	P99    int64  `json:"p99"`
+	Max    int64  `json:"max"`
+}
+
+// LatencySummary holds the latency percentiles of a set of flow trees per
+// link and per switch, links and switches are identified by label
+type LatencySummary struct {
+	Trees    int            `json:"trees"`
+	Links    []LatencyStats `json:"links"`
+	Switches []LatencyStats `json:"switches"`
+}
+
+// SummarizeLatencies computes the latency percentiles of the given trees
+func SummarizeLatencies(trees []FlowTree) LatencySummary {
+	links := make(map[Edge][]int64)
+	switches := make(map[string][]int64)
+	for _, ft := range trees {
+		for _, l := range ft.Latencies {
+			if l.Link != nil {
+				e := Edge{Src: l.SrcLabel, Dst: l.DstLabel}
+				links[e] = append(links[e], *l.Link)
+			}
+			if l.Transit != nil {
+				switches[l.SrcLabel] = append(switches[l.SrcLabel], *l.Transit)
+			}
+		}
+	}
+
+	s := LatencySummary{Trees: len(trees), Links: []LatencyStats{}, Switches: []LatencyStats{}}
+	for e, values := range links {
+		stats := newLatencyStats(values)
+		stats.Src, stats.Dst = e.Src, e.Dst
+		s.Links = append(s.Links, stats)
+	}
+	for sw, values := range switches {
+		stats := newLatencyStats(values)
+		stats.Switch = sw
+		s.Switches = append(s.Switches, stats)
+	}
+	sort.Slice(s.Links, func(i, j int) bool {
+		if s.Links[i].Src != s.Links[j].Src {
+			return s.Links[i].Src < s.Links[j].Src
+		}
+		return s.Links[i].Dst < s.Links[j].Dst
+	})
+	sort.Slice(s.Switches, func(i, j int) bool {
+		return s.Switches[i].Switch < s.Switches[j].Switch
+	})
+	return s
+}
+
+func newLatencyStats(values []int64) LatencyStats {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return LatencyStats{
+		Count: len(values),
+		Min:   values[0],
+		P50:   percentile(values, 50),
+		P90:   percentile(values, 90),
+		P99:   percentile(values, 99),
+		Max:   values[len(values)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted values
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,66 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func TestLatencies(t *testing.T) {
+	g := NewGenerator(topology.Legacy{
+		Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"},
+	}.Topology(), nil, nil, nil)
+
+	pks := observations("a", "", "s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2")
+	for i, offset := range []time.Duration{0, time.Millisecond, 3 * time.Millisecond, 7 * time.Millisecond} {
+		captured(&pks[i], captureTime.Add(offset))
+	}
+	ft := generate(t, g, pks)
+
+	if len(ft.Latencies) != 3 {
+		t.Fatalf("expected the latencies of 3 edges, got %+v", ft.Latencies)
+	}
+	root, s1, s2 := ft.Latencies[0], ft.Latencies[1], ft.Latencies[2]
+	if root.Transit != nil || root.Link != nil {
+		t.Errorf("expected no latency from the host, got %+v", root)
+	}
+	if s1.Transit == nil || *s1.Transit != int64(time.Millisecond) || s1.Link == nil || *s1.Link != int64(2*time.Millisecond) {
+		t.Errorf("expected 1ms in s1 and 2ms to s2, got %+v", s1)
+	}
+	if s2.Transit == nil || *s2.Transit != int64(4*time.Millisecond) || s2.Link != nil {
+		t.Errorf("expected 4ms in s2 and no link latency to h2, got %+v", s2)
+	}
+
+	if len(ft.Paths) != 1 || ft.Paths[0].Delay != int64(7*time.Millisecond) ||
+		strings.Join(ft.Paths[0].Nodes, ",") != "h1,s1,s2,h2" {
+		t.Errorf("expected a 7ms path from h1 to h2, got %+v", ft.Paths)
+	}
+
+	if !strings.Contains(ft.Nodes, `s1->s2[ label="3.000ms"`) {
+		t.Errorf("expected the edges to be labeled, got %s", ft.Nodes)
+	}
+}
+
+func TestSummarizeLatencies(t *testing.T) {
+	var trees []FlowTree
+	for i := 1; i <= 10; i++ {
+		link, transit := int64(i), int64(10*i)
+		trees = append(trees, FlowTree{Latencies: []Latency{
+			{SrcLabel: "s1", DstLabel: "s2", Transit: &transit, Link: &link},
+		}})
+	}
+
+	s := SummarizeLatencies(trees)
+	if s.Trees != 10 || len(s.Links) != 1 || len(s.Switches) != 1 {
+		t.Fatalf("expected a link and a switch, got %+v", s)
+	}
+	l := s.Links[0]
+	if l.Src != "s1" || l.Dst != "s2" || l.Count != 10 || l.Min != 1 || l.P50 != 5 || l.P90 != 9 || l.P99 != 10 || l.Max != 10 {
+		t.Errorf("unexpected link percentiles %+v", l)
+	}
+	if sw := s.Switches[0]; sw.Switch != "s1" || sw.P50 != 50 {
+		t.Errorf("unexpected switch percentiles %+v", sw)
+	}
+}
@@ -0,0 +1,108 @@
+package tree
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// loopColor is the color loops are drawn with in the DOT output
+const loopColor = "orange"
+
+// checkLoop records a loop anomaly when the device of n already shows up
+// on the path from the root to n. Only the first cycle of a path is
+// recorded, a packet looping for a while would otherwise report every
+// turn.
+func (b *builder) checkLoop(n *Node) {
+	var path []*Node
+	for a := n.Parent; a != nil; a = a.Parent {
+		if b.loops[a] {
+			return
+		}
+		path = append(path, a)
+	}
+
+	for i, a := range path {
+		if a.Label != n.Label {
+			continue
+		}
+		var hops []Hop
+		for j := i; j >= 0; j-- {
+			hops = append(hops, newHop(path[j]))
+		}
+		hops = append(hops, newHop(n))
+
+		labels := make([]string, len(hops))
+		for j, h := range hops {
+			labels[j] = h.Label
+		}
+		b.loops[n] = true
+		b.ft.Anomalies = append(b.ft.Anomalies, Anomaly{
+			Type:        LoopAnomaly,
+			Description: fmt.Sprintf("forwarding loop %s", strings.Join(labels, " -> ")),
+			Switch:      n.Label,
+			Hops:        hops,
+		})
+		return
+	}
+}
+
+// highlightLoops draws the loops found in the tree in the DOT graph, nodes
+// are matched by name or, for merged graphs, by label
+func highlightLoops(dotStr string, anomalies []Anomaly, byLabel bool) (string, error) {
+	var loops [][]string
+	for _, a := range anomalies {
+		if a.Type != LoopAnomaly {
+			continue
+		}
+		var names []string
+		for _, h := range a.Hops {
+			if byLabel {
+				names = append(names, dotID(h.Label))
+			} else {
+				names = append(names, h.Node)
+			}
+		}
+		loops = append(loops, names)
+	}
+	if len(loops) == 0 {
+		return dotStr, nil
+	}
+
+	g, err := gographviz.Read([]byte(dotStr))
+	if err != nil {
+		return dotStr, err
+	}
+
+	nodes := make(map[string]bool)
+	edges := make(map[Edge]bool)
+	for _, names := range loops {
+		for i, n := range names {
+			nodes[n] = true
+			if i > 0 {
+				edges[Edge{Src: names[i-1], Dst: n}] = true
+			}
+		}
+	}
+
+	for _, n := range g.Nodes.Nodes {
+		if nodes[n.Name] {
+			if n.Attrs == nil {
+				n.Attrs = make(gographviz.Attrs)
+			}
+			n.Attrs.Add("color", loopColor)
+		}
+	}
+	for _, e := range g.Edges.Edges {
+		if edges[Edge{Src: e.Src, Dst: e.Dst}] {
+			if e.Attrs == nil {
+				e.Attrs = make(gographviz.Attrs)
+			}
+			e.Attrs.Add("color", loopColor)
+			e.Attrs.Add("penwidth", "2")
+			e.Attrs.Add("style", "dashed")
+		}
+	}
+	return g.String(), nil
+}
@@ -0,0 +1,46 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func TestLoopDetection(t *testing.T) {
+	g := NewGenerator(topology.Legacy{
+		Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "s1:s2-eth2", "s2:s1-eth3"},
+	}.Topology(), nil, nil, nil)
+
+	ft := generate(t, g, observations("a", "", "s1-eth1", "s1-eth2", "s2-eth1", "s2-eth2", "s1-eth3", "s1-eth2", "s2-eth1", "s2-eth2"))
+
+	// the packet keeps looping but only its first turn is reported
+	var loops []Anomaly
+	for _, a := range ft.Anomalies {
+		if a.Type == LoopAnomaly {
+			loops = append(loops, a)
+		}
+	}
+	if len(loops) != 1 {
+		t.Fatalf("expected a single loop, got %+v", ft.Anomalies)
+	}
+	a := loops[0]
+	if len(a.Hops) != 3 {
+		t.Fatalf("expected a loop of 3 hops, got %+v", a)
+	}
+	labels := []string{a.Hops[0].Label, a.Hops[1].Label, a.Hops[2].Label}
+	if strings.Join(labels, ",") != "s1,s2,s1" || a.Hops[2].Node != "s1_0" {
+		t.Errorf("expected the loop s1, s2, s1_0, got %+v", a.Hops)
+	}
+	if a.Hops[0].At != captureTime.UnixNano() || a.Hops[1].At != captureTime.Add(2*time.Millisecond).UnixNano() {
+		t.Errorf("expected the hops to be timed at their ingress, got %+v", a.Hops)
+	}
+	if len(a.Hops[1].Interfaces) != 2 || a.Hops[1].Interfaces[0] != "s2-eth1" {
+		t.Errorf("expected the interfaces of s2, got %v", a.Hops[1].Interfaces)
+	}
+
+	if !strings.Contains(ft.Nodes, "s2->s1_0[ color=orange") {
+		t.Errorf("expected the loop to be highlighted, got %s", ft.Nodes)
+	}
+}
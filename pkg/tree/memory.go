@@ -0,0 +1,152 @@
+package tree
+
+import (
+	"log"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type memoryRepo struct {
+	lock   sync.RWMutex
+	trees  map[string]FlowTree
+	groups map[string][]FlowTree
+}
+
+// NewMemoryRepository returns a new thread-safe in-memory Repository
+func NewMemoryRepository() Repository {
+	return &memoryRepo{
+		trees:  make(map[string]FlowTree),
+		groups: make(map[string][]FlowTree),
+	}
+}
+
+func (r *memoryRepo) Store(ft FlowTree) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.trees[ft.ID] = clone(ft)
+	return nil
+}
+
+func (r *memoryRepo) StoreGroup(key string, trees []FlowTree) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var g []FlowTree
+	for _, ft := range trees {
+		g = append(g, clone(ft))
+	}
+	r.groups[key] = g
+	return nil
+}
+
+func (r *memoryRepo) FindByID(id string) (*FlowTree, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	ft, ok := r.trees[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	ft = clone(ft)
+	return &ft, nil
+}
+
+func (r *memoryRepo) FindAll() ([]FlowTree, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var trees []FlowTree
+	for _, ft := range r.trees {
+		trees = append(trees, clone(ft))
+	}
+	sortNewest(trees)
+	return trees, nil
+}
+
+func (r *memoryRepo) FindPage(q Query) (Page, error) {
+	trees, err := r.FindAll()
+	if err != nil {
+		return Page{}, err
+	}
+	return q.page(trees), nil
+}
+
+func (r *memoryRepo) FindMatching(q Query) ([]FlowTree, error) {
+	trees, err := r.FindAll()
+	return summaries(q.filter(trees)), err
+}
+
+func (r *memoryRepo) FindByGroup(ft FlowTree) ([]FlowTree, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var trees []FlowTree
+	for _, t := range r.trees {
+		if t.Group() == ft.Group() {
+			trees = append(trees, clone(t))
+		}
+	}
+	sortOldest(trees)
+	return trees, nil
+}
+
+func (r *memoryRepo) FindGroups() ([]FlowTree, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var trees []FlowTree
+	for _, g := range r.groups {
+		for _, ft := range g {
+			trees = append(trees, clone(ft))
+		}
+	}
+	sortNewest(trees)
+	return trees, nil
+}
+
+func (r *memoryRepo) DeleteBySession(session string) (int64, error) {
+	if session == "" {
+		return 0, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var deleted int64
+	for id, ft := range r.trees {
+		if ft.Session == session {
+			delete(r.trees, id)
+			deleted++
+		}
+	}
+	for key, g := range r.groups {
+		if len(g) > 0 && g[0].Session == session {
+			delete(r.groups, key)
+		}
+	}
+	return deleted, nil
+}
+
+func (r *memoryRepo) Count() (int64, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return int64(len(r.trees)), nil
+}
+
+// clone returns a deep copy of the tree as it would be read back from the
+// other backends
+func clone(ft FlowTree) FlowTree {
+	b, err := bson.Marshal(ft)
+	if err != nil {
+		log.Printf("error copying flow tree %s, %v", ft.ID, err)
+		return ft
+	}
+	var c FlowTree
+	if err := bson.Unmarshal(b, &c); err != nil {
+		log.Printf("error copying flow tree %s, %v", ft.ID, err)
+		return ft
+	}
+	return c
+}
@@ -0,0 +1,173 @@
+package tree
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// MergedNode is a device of a merged graph along with the payload UIDs of
+// the flow trees it belongs to
+type MergedNode struct {
+	Label    string   `json:"label" bson:"label"`
+	Payloads []string `json:"payloads" bson:"payloads"`
+}
+
+// MergedEdge is a link of a merged graph along with the payload UIDs of
+// the flow trees that traversed it
+type MergedEdge struct {
+	Src      string   `json:"src" bson:"src"`
+	Dst      string   `json:"dst" bson:"dst"`
+	Payloads []string `json:"payloads" bson:"payloads"`
+}
+
+// MergedGraph is the union of a set of flow trees, nodes are identified
+// by their label, i.e. the device, and edges by their source and
+// destination devices.
+type MergedGraph struct {
+	Label    string       `json:"label" bson:"label"`
+	Payloads []string     `json:"payloads" bson:"payloads"`
+	Nodes    []MergedNode `json:"nodes" bson:"nodes"`
+	Edges    []MergedEdge `json:"edges" bson:"edges"`
+
+	nodes    map[string]int
+	edges    map[Edge]int
+	payloads map[string]bool
+}
+
+// NewMergedGraph returns an empty merged graph with the given label
+func NewMergedGraph(label string) *MergedGraph {
+	return &MergedGraph{
+		Label:    label,
+		Payloads: []string{},
+		Nodes:    []MergedNode{},
+		Edges:    []MergedEdge{},
+		nodes:    make(map[string]int),
+		edges:    make(map[Edge]int),
+		payloads: make(map[string]bool),
+	}
+}
+
+// Add merges the tree of the given payload UID into the graph
+func (m *MergedGraph) Add(payload string, t *Tree) {
+	m.addNode(payload, t.Root.Label)
+	m.AddPaths(payload, t.Edges())
+}
+
+// AddPaths merges the root to leaf paths of the tree of the given payload
+// UID into the graph
+func (m *MergedGraph) AddPaths(payload string, paths [][]Edge) {
+	m.index()
+	if !m.payloads[payload] {
+		m.payloads[payload] = true
+		m.Payloads = insert(m.Payloads, payload)
+	}
+
+	for _, path := range paths {
+		for _, e := range path {
+			m.addNode(payload, e.Src)
+			m.addNode(payload, e.Dst)
+
+			i, ok := m.edges[e]
+			if !ok {
+				i = len(m.Edges)
+				m.edges[e] = i
+				m.Edges = append(m.Edges, MergedEdge{Src: e.Src, Dst: e.Dst})
+			}
+			m.Edges[i].Payloads = insert(m.Edges[i].Payloads, payload)
+		}
+	}
+}
+
+func (m *MergedGraph) addNode(payload, label string) {
+	m.index()
+	if !m.payloads[payload] {
+		m.payloads[payload] = true
+		m.Payloads = insert(m.Payloads, payload)
+	}
+
+	i, ok := m.nodes[label]
+	if !ok {
+		i = len(m.Nodes)
+		m.nodes[label] = i
+		m.Nodes = append(m.Nodes, MergedNode{Label: label})
+	}
+	m.Nodes[i].Payloads = insert(m.Nodes[i].Payloads, payload)
+}
+
+// index builds the lookup maps of graphs decoded from storage
+func (m *MergedGraph) index() {
+	if m.nodes != nil {
+		return
+	}
+	m.nodes = make(map[string]int)
+	m.edges = make(map[Edge]int)
+	m.payloads = make(map[string]bool)
+	for i, n := range m.Nodes {
+		m.nodes[n.Label] = i
+	}
+	for i, e := range m.Edges {
+		m.edges[Edge{Src: e.Src, Dst: e.Dst}] = i
+	}
+	for _, p := range m.Payloads {
+		m.payloads[p] = true
+	}
+}
+
+// insert adds s to the sorted slice ss unless already present
+func insert(ss []string, s string) []string {
+	i := sort.SearchStrings(ss, s)
+	if i < len(ss) && ss[i] == s {
+		return ss
+	}
+	ss = append(ss, "")
+	copy(ss[i+1:], ss[i:])
+	ss[i] = s
+	return ss
+}
+
+// ToDOT returns the graph in DOT format, edges traversed by more than one
+// flow tree are labeled with the number of trees.
+func (m *MergedGraph) ToDOT() string {
+	name := "T"
+
+	g := gographviz.NewGraph()
+	if err := g.SetName(name); err != nil {
+		log.Println(err)
+	}
+	g.AddAttr(name, "label", fmt.Sprintf("%q", m.Label))
+	g.AddAttr(name, "labelloc", "t")
+	if err := g.SetDir(true); err != nil {
+		log.Println(err)
+	}
+
+	for _, n := range m.Nodes {
+		attrs := map[string]string{"label": dotID(n.Label)}
+		if err := g.AddNode(name, dotID(n.Label), attrs); err != nil {
+			log.Println(err)
+		}
+	}
+	for _, e := range m.Edges {
+		var attrs map[string]string
+		if len(e.Payloads) > 1 {
+			attrs = map[string]string{"label": fmt.Sprintf("%d", len(e.Payloads))}
+		}
+		if err := g.AddEdge(dotID(e.Src), dotID(e.Dst), true, attrs); err != nil {
+			log.Println(err)
+		}
+	}
+	return g.String()
+}
+
+var plainID = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*|-?[0-9]*\.?[0-9]+)$`)
+
+// dotID quotes s when it is not a valid plain DOT identifier
+func dotID(s string) string {
+	if plainID.MatchString(s) {
+		return s
+	}
+	return fmt.Sprintf("%q", s)
+}
@@ -0,0 +1,67 @@
+package tree
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergedGraph(t *testing.T) {
+	m := NewMergedGraph("TCP 80")
+	m.AddPaths("b", [][]Edge{
+		{{Src: "h1", Dst: "s1"}, {Src: "s1", Dst: "s2"}, {Src: "s2", Dst: "h2"}},
+	})
+	m.AddPaths("a", [][]Edge{
+		{{Src: "h1", Dst: "s1"}, {Src: "s1", Dst: "s3"}, {Src: "s3", Dst: "h3"}},
+		{{Src: "h1", Dst: "s1"}, {Src: "s1", Dst: "s2"}, {Src: "s2", Dst: "h2"}},
+	})
+
+	if !reflect.DeepEqual(m.Payloads, []string{"a", "b"}) {
+		t.Errorf("expected payloads a and b, got %v", m.Payloads)
+	}
+	if len(m.Nodes) != 6 || len(m.Edges) != 5 {
+		t.Fatalf("expected 6 nodes and 5 edges, got %d and %d", len(m.Nodes), len(m.Edges))
+	}
+
+	payloads := make(map[Edge][]string)
+	for _, e := range m.Edges {
+		payloads[Edge{Src: e.Src, Dst: e.Dst}] = e.Payloads
+	}
+	if !reflect.DeepEqual(payloads[Edge{Src: "s1", Dst: "s2"}], []string{"a", "b"}) {
+		t.Errorf("expected s1->s2 traversed by a and b, got %v", payloads[Edge{Src: "s1", Dst: "s2"}])
+	}
+	if !reflect.DeepEqual(payloads[Edge{Src: "s3", Dst: "h3"}], []string{"a"}) {
+		t.Errorf("expected s3->h3 traversed by a, got %v", payloads[Edge{Src: "s3", Dst: "h3"}])
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MergedGraph
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Edges, m.Edges) || !reflect.DeepEqual(decoded.Nodes, m.Nodes) {
+		t.Errorf("expected the JSON export to round trip, got %s", b)
+	}
+
+	edges := EdgesFromString(m.ToDOT())
+	if len(edges) != 5 {
+		t.Errorf("expected 5 edges in the DOT graph, got %v", edges)
+	}
+}
+
+func TestMergedGraphTree(t *testing.T) {
+	root := NewNode("N/A", "N/A")
+	tr := NewTree(root)
+
+	m := NewMergedGraph("UDP 53")
+	m.Add("a", tr)
+	if len(m.Nodes) != 1 || m.Nodes[0].Label != "N/A" || len(m.Edges) != 0 {
+		t.Errorf("expected a single node, got %+v", m)
+	}
+	if EdgesFromString(m.ToDOT()) != nil {
+		t.Errorf("expected no edges")
+	}
+}
@@ -0,0 +1,218 @@
+package tree
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default and maximum number of trees returned per page
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Query holds the filters used to search flow trees
+type Query struct {
+	Type    string
+	SrcIP   string
+	DstIP   string
+	DstPort string
+	From    time.Time
+	To      time.Time
+	Sat     *bool
+	// Session selects the trees of a session, when empty the trees of the
+	// hidden sessions are left out
+	Session string
+	Limit   int
+	Cursor  *Cursor
+
+	// hidden holds the sessions whose trees are only found by session
+	hidden map[string]bool
+}
+
+// Cursor points to the last flow tree of a page, trees are sorted from
+// the newest to the oldest one.
+type Cursor struct {
+	CapturedAt int64
+	ID         string
+}
+
+// String returns the opaque representation of the cursor
+func (c Cursor) String() string {
+	s := fmt.Sprintf("%d:%s", c.CapturedAt, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// ParseCursor parses a cursor returned by Cursor.String
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid cursor")
+	}
+	at, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &Cursor{at, parts[1]}, nil
+}
+
+// after reports whether a tree captured at the given time with the given
+// ID comes after the cursor in the page order.
+func (c *Cursor) after(capturedAt int64, ID string) bool {
+	if c == nil {
+		return true
+	}
+	if capturedAt != c.CapturedAt {
+		return capturedAt < c.CapturedAt
+	}
+	return ID > c.ID
+}
+
+// ParseQuery builds a Query from the URL query parameters type, src_ip,
+// dst_ip, dst_port, from, to, sat, session, limit and cursor. Times are either
+// RFC3339 or Unix nanoseconds.
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{
+		Type:    strings.ToUpper(v.Get("type")),
+		SrcIP:   v.Get("src_ip"),
+		DstIP:   v.Get("dst_ip"),
+		DstPort: v.Get("dst_port"),
+		Session: v.Get("session"),
+		Limit:   defaultLimit,
+	}
+
+	var err error
+	if q.From, err = parseTime(v.Get("from")); err != nil {
+		return q, fmt.Errorf("invalid from, %v", err)
+	}
+	if q.To, err = parseTime(v.Get("to")); err != nil {
+		return q, fmt.Errorf("invalid to, %v", err)
+	}
+
+	if s := v.Get("sat"); s != "" {
+		sat, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("invalid sat, %v", err)
+		}
+		q.Sat = &sat
+	}
+
+	if s := v.Get("limit"); s != "" {
+		l, err := strconv.Atoi(s)
+		if err != nil || l <= 0 {
+			return q, fmt.Errorf("invalid limit %s", s)
+		}
+		if l > maxLimit {
+			l = maxLimit
+		}
+		q.Limit = l
+	}
+
+	if s := v.Get("cursor"); s != "" {
+		if q.Cursor, err = ParseCursor(s); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, n), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// match reports whether the stored tree matches the query filters and
+// comes after its cursor
+func (q Query) match(ft FlowTree) bool {
+	return (q.Type == "" || ft.Type == q.Type) &&
+		(q.SrcIP == "" || ft.SrcIP == q.SrcIP) &&
+		(q.DstIP == "" || ft.DstIP == q.DstIP) &&
+		(q.DstPort == "" || matchPort(q.DstPort, ft.DstPort)) &&
+		(q.From.IsZero() || ft.CapturedAt >= q.From.UnixNano()) &&
+		(q.To.IsZero() || ft.CapturedAt < q.To.UnixNano()) &&
+		(q.Sat == nil || ft.IsSat == *q.Sat) &&
+		q.visible(ft) &&
+		q.Cursor.after(ft.CapturedAt, ft.ID)
+}
+
+// Hide leaves the trees of the given sessions out of the results of the
+// query, unless it selects one of them, e.g. the archived sessions
+func (q *Query) Hide(sessions ...string) {
+	if q.hidden == nil {
+		q.hidden = make(map[string]bool)
+	}
+	for _, s := range sessions {
+		q.hidden[s] = true
+	}
+}
+
+// visible reports whether the tree is of the session of the query, or of a
+// session not hidden when the query has none
+func (q Query) visible(ft FlowTree) bool {
+	return ft.Session == q.Session || (q.Session == "" && !q.hidden[ft.Session])
+}
+
+// page returns the page of the given trees, sorted from the newest to the
+// oldest, matching the query
+func (q Query) page(trees []FlowTree) Page {
+	var matched []FlowTree
+	for _, ft := range trees {
+		if len(matched) > q.Limit {
+			break
+		}
+		if q.match(ft) {
+			matched = append(matched, ft)
+		}
+	}
+	return newPage(matched, q.Limit)
+}
+
+// newPage returns the page of the first limit trees, sorted from the newest
+// to the oldest, pointing to the next page when there are more of them
+func newPage(trees []FlowTree, limit int) Page {
+	page := Page{Trees: []FlowTree{}}
+	if len(trees) > limit {
+		trees = trees[:limit]
+		last := trees[len(trees)-1]
+		page.NextCursor = Cursor{last.CapturedAt, last.ID}.String()
+	}
+	page.Trees = append(page.Trees, trees...)
+	return page
+}
+
+// filter returns the given trees matching the query filters, regardless of
+// its cursor and limit
+func (q Query) filter(trees []FlowTree) []FlowTree {
+	q.Cursor = nil
+
+	var matched []FlowTree
+	for _, ft := range trees {
+		if q.match(ft) {
+			matched = append(matched, ft)
+		}
+	}
+	return matched
+}
+
+// summaries leaves the DOT representation and the image of the trees out,
+// as Repository.FindMatching does
+func summaries(trees []FlowTree) []FlowTree {
+	for i := range trees {
+		trees[i].Nodes, trees[i].NodesImg = "", ""
+	}
+	return trees
+}
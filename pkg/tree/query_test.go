@@ -0,0 +1,71 @@
+package tree
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestQueryPage(t *testing.T) {
+	base := time.Date(2019, 3, 16, 17, 43, 26, 0, time.UTC)
+	ft := func(id, dstPort string, offset time.Duration) FlowTree {
+		return FlowTree{ID: id, DstPort: dstPort, CapturedAt: base.Add(offset).UnixNano()}
+	}
+	trees := []FlowTree{
+		ft("a", "80", 0),
+		ft("b", "80", time.Second),
+		ft("c", "22", 2*time.Second),
+		ft("d", "80", 4*time.Second),
+	}
+	sortNewest(trees)
+
+	q, err := ParseQuery(url.Values{"dst_port": {"80"}, "limit": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := q.page(trees)
+	if len(page.Trees) != 2 || page.Trees[0].ID != "d" || page.Trees[1].ID != "b" || page.NextCursor == "" {
+		t.Fatalf("expected trees d and b and a next cursor, got %+v", page)
+	}
+
+	c, err := ParseCursor(page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Cursor = c
+	if page := q.page(trees); len(page.Trees) != 1 || page.Trees[0].ID != "a" || page.NextCursor != "" {
+		t.Errorf("expected the last page to hold a, got %+v", page)
+	}
+}
+
+func TestQuerySessions(t *testing.T) {
+	trees := []FlowTree{{ID: "a"}, {ID: "b", Session: "s1"}, {ID: "c", Session: "s2"}}
+
+	q, err := ParseQuery(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.hidden = map[string]bool{"s2": true}
+	if matched := q.filter(trees); len(matched) != 2 || matched[0].ID != "a" || matched[1].ID != "b" {
+		t.Errorf("expected the trees of the sessions not hidden, got %+v", matched)
+	}
+
+	q.Session = "s2"
+	if matched := q.filter(trees); len(matched) != 1 || matched[0].ID != "c" {
+		t.Errorf("expected the trees of the hidden session when requested, got %+v", matched)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, v := range []url.Values{
+		{"from": {"yesterday"}},
+		{"sat": {"maybe"}},
+		{"limit": {"-1"}},
+		{"cursor": {"%%%"}},
+	} {
+		if _, err := ParseQuery(v); err == nil {
+			t.Errorf("expected an error for %v", v)
+		}
+	}
+}
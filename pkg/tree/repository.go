@@ -0,0 +1,319 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository defines the methods to be implemented by
+// the storage layer.
+type Repository interface {
+	// FindAll returns the finished flow trees sorted from the newest to
+	// the oldest
+	FindAll() ([]FlowTree, error)
+	// FindByID returns the flow tree of the given payload UID or ErrNotFound
+	FindByID(id string) (*FlowTree, error)
+	// FindPage returns the page of the flow trees matching q after its
+	// cursor, sorted from the newest to the oldest, see Query
+	FindPage(q Query) (Page, error)
+	// FindMatching returns the flow trees matching the filters of q,
+	// regardless of its cursor and limit, sorted from the newest to the
+	// oldest. Their DOT representation and image are left out.
+	FindMatching(q Query) ([]FlowTree, error)
+	// FindByGroup returns the flow trees in the same group as ft, see
+	// FlowTree.Group, sorted by capture time
+	FindByGroup(ft FlowTree) ([]FlowTree, error)
+	// Store stores a finished flow tree replacing any previous one with the
+	// same payload UID
+	Store(ft FlowTree) error
+	// StoreGroup replaces the merged view of a group
+	StoreGroup(group string, trees []FlowTree) error
+	// FindGroups returns the merged views of every group sorted from the
+	// newest to the oldest
+	FindGroups() ([]FlowTree, error)
+	// DeleteBySession deletes the flow trees of the given session along
+	// with the merged views of their groups, it returns the number of
+	// trees deleted. An empty session matches no tree.
+	DeleteBySession(session string) (int64, error)
+	// Count counts the flow trees stored
+	Count() (int64, error)
+}
+
+// ErrNotFound is returned when the requested flow tree does not exist
+var ErrNotFound = errors.New("flow tree not found")
+
+// group is the stored merged view of a group of flow trees
+type group struct {
+	Key   string     `bson:"_id"`
+	Trees []FlowTree `bson:"trees"`
+}
+
+// sortNewest sorts trees from the newest to the oldest, in the order of
+// the pages of Handler.Find
+func sortNewest(trees []FlowTree) {
+	sort.Slice(trees, func(i, j int) bool {
+		if trees[i].CapturedAt != trees[j].CapturedAt {
+			return trees[i].CapturedAt > trees[j].CapturedAt
+		}
+		return trees[i].ID < trees[j].ID
+	})
+}
+
+// sortOldest sorts trees by capture time
+func sortOldest(trees []FlowTree) {
+	sort.Slice(trees, func(i, j int) bool {
+		if trees[i].CapturedAt != trees[j].CapturedAt {
+			return trees[i].CapturedAt < trees[j].CapturedAt
+		}
+		return trees[i].ID < trees[j].ID
+	})
+}
+
+type repo struct {
+	db *mongo.Database
+}
+
+// NewRepository returns a new mongo Repository storing into the given database
+func NewRepository(db *mongo.Database) Repository {
+	r := &repo{db}
+	r.ensureIndexes()
+	return r
+}
+
+func (r *repo) ensureIndexes() {
+	collection := r.db.Collection("trees")
+
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "captured_at", Value: -1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "dst_port", Value: 1}, {Key: "captured_at", Value: 1}}},
+		{Keys: bson.D{{Key: "session", Value: 1}}},
+	}
+	_, err := collection.Indexes().CreateMany(context.Background(), models)
+	if err != nil {
+		log.Printf("error creating trees indexes, %v", err)
+	}
+}
+
+func (r *repo) Store(ft FlowTree) error {
+	collection := r.db.Collection("trees")
+
+	filter := bson.M{"_id": ft.ID}
+	_, err := collection.ReplaceOne(context.Background(), filter, ft, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("error storing flow tree, %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *repo) StoreGroup(key string, trees []FlowTree) error {
+	collection := r.db.Collection("tree_groups")
+
+	filter := bson.M{"_id": key}
+	_, err := collection.ReplaceOne(context.Background(), filter, group{key, trees}, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("error storing flow tree group, %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *repo) FindByID(id string) (*FlowTree, error) {
+	collection := r.db.Collection("trees")
+
+	var ft FlowTree
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&ft)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ft, nil
+}
+
+func (r *repo) FindAll() ([]FlowTree, error) {
+	trees, err := r.find(bson.D{})
+	sortNewest(trees)
+	return trees, err
+}
+
+func (r *repo) FindPage(q Query) (Page, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "captured_at", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(q.Limit + 1))
+	trees, err := r.find(queryFilter(q), opts)
+	if err != nil {
+		return Page{}, err
+	}
+	return newPage(trees, q.Limit), nil
+}
+
+func (r *repo) FindMatching(q Query) ([]FlowTree, error) {
+	q.Cursor = nil
+	opts := options.Find().
+		SetSort(bson.D{{Key: "captured_at", Value: -1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.D{{Key: "nodes", Value: 0}, {Key: "nodes_img", Value: 0}})
+	return r.find(queryFilter(q), opts)
+}
+
+// queryFilter returns the filter of the trees matching the query, see
+// Query.match
+func queryFilter(q Query) bson.D {
+	filter := bson.D{}
+	for _, f := range []struct{ key, value string }{
+		{"type", q.Type},
+		{"src_ip", q.SrcIP},
+		{"dst_ip", q.DstIP},
+	} {
+		if f.value != "" {
+			filter = append(filter, bson.E{Key: f.key, Value: f.value})
+		}
+	}
+	if q.DstPort != "" {
+		// the ports are matched with or without their service name, see
+		// matchPort
+		filter = append(filter, bson.E{Key: "dst_port", Value: primitive.Regex{Pattern: "^" + regexp.QuoteMeta(q.DstPort) + `(\(|$)`}})
+	}
+
+	capturedAt := bson.D{}
+	if !q.From.IsZero() {
+		capturedAt = append(capturedAt, bson.E{Key: "$gte", Value: q.From.UnixNano()})
+	}
+	if !q.To.IsZero() {
+		capturedAt = append(capturedAt, bson.E{Key: "$lt", Value: q.To.UnixNano()})
+	}
+	if len(capturedAt) > 0 {
+		filter = append(filter, bson.E{Key: "captured_at", Value: capturedAt})
+	}
+
+	if q.Sat != nil {
+		filter = append(filter, bson.E{Key: "is_sat", Value: *q.Sat})
+	}
+
+	if q.Session != "" {
+		filter = append(filter, bson.E{Key: "session", Value: q.Session})
+	} else if len(q.hidden) > 0 {
+		hidden := make(bson.A, 0, len(q.hidden))
+		for s := range q.hidden {
+			hidden = append(hidden, s)
+		}
+		filter = append(filter, bson.E{Key: "session", Value: bson.D{{Key: "$nin", Value: hidden}}})
+	}
+
+	if c := q.Cursor; c != nil {
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "captured_at", Value: bson.D{{Key: "$lt", Value: c.CapturedAt}}}},
+			bson.D{{Key: "captured_at", Value: c.CapturedAt}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: c.ID}}}},
+		}})
+	}
+	return filter
+}
+
+func (r *repo) FindByGroup(ft FlowTree) ([]FlowTree, error) {
+	second := ft.CapturedAt - ft.CapturedAt%int64(time.Second)
+	// trees captured outside of any session have no session field
+	var session interface{} = ft.Session
+	if ft.Session == "" {
+		session = bson.D{{Key: "$exists", Value: false}}
+	}
+	trees, err := r.find(bson.D{
+		{Key: "session", Value: session},
+		{Key: "type", Value: ft.Type},
+		{Key: "dst_port", Value: ft.DstPort},
+		{Key: "captured_at", Value: bson.D{
+			{Key: "$gte", Value: second},
+			{Key: "$lt", Value: second + int64(time.Second)},
+		}},
+	})
+	sortOldest(trees)
+	return trees, err
+}
+
+func (r *repo) FindGroups() ([]FlowTree, error) {
+	collection := r.db.Collection("tree_groups")
+
+	var trees []FlowTree
+
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return trees, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var g group
+		if err := cursor.Decode(&g); err != nil {
+			return trees, err
+		}
+		trees = append(trees, g.Trees...)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Println("error getting data from cursor")
+		return trees, err
+	}
+	sortNewest(trees)
+	return trees, nil
+}
+
+func (r *repo) DeleteBySession(session string) (int64, error) {
+	ctx := context.Background()
+
+	_, err := r.db.Collection("tree_groups").DeleteMany(ctx, bson.D{{Key: "trees.session", Value: session}})
+	if err != nil {
+		log.Printf("error deleting flow tree groups of session %s, %v", session, err)
+		return 0, err
+	}
+	res, err := r.db.Collection("trees").DeleteMany(ctx, bson.D{{Key: "session", Value: session}})
+	if err != nil {
+		log.Printf("error deleting flow trees of session %s, %v", session, err)
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (r *repo) find(filter bson.D, opts ...*options.FindOptions) ([]FlowTree, error) {
+	collection := r.db.Collection("trees")
+
+	var trees []FlowTree
+
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return trees, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var ft FlowTree
+		if err := cursor.Decode(&ft); err != nil {
+			return trees, err
+		}
+		trees = append(trees, ft)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Println("error getting data from cursor")
+		return trees, err
+	}
+	return trees, nil
+}
+
+func (r *repo) Count() (int64, error) {
+	collection := r.db.Collection("trees")
+	count, err := collection.EstimatedDocumentCount(context.Background())
+
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
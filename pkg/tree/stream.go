@@ -0,0 +1,500 @@
+package tree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/clock"
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+// EventType is the kind of a flow tree Event
+type EventType string
+
+// Flow tree events
+const (
+	// TreeCreated is sent on the first observation of a payload UID
+	TreeCreated EventType = "tree_created"
+	// NodeAdded is sent when an observation adds a node to a tree
+	NodeAdded EventType = "node_added"
+	// TreeCompleted is sent once no observation of a payload UID has
+	// arrived during the idle timeout, the event holds the whole tree
+	TreeCompleted EventType = "tree_completed"
+	// TreeVerified is sent once the properties have been verified against
+	// a completed tree and it has been stored, the event holds the tree and
+	// its results
+	TreeVerified EventType = "verified"
+)
+
+// EventNode is a node added to a flow tree
+type EventNode struct {
+	Name   string `json:"name"`
+	Label  string `json:"label"`
+	Parent string `json:"parent,omitempty"`
+	Level  int    `json:"level"`
+}
+
+// Event is a change in the flow tree of a payload UID
+type Event struct {
+	Type EventType  `json:"type"`
+	ID   string     `json:"id"`
+	Time time.Time  `json:"time"`
+	Node *EventNode `json:"node,omitempty"`
+	Tree *FlowTree  `json:"tree,omitempty"`
+
+	// meta holds the headers of the tree used to filter the event
+	meta FlowTree
+}
+
+// Filter selects the events of the flow trees matching every non empty
+// field, Port matches either the source or the destination port.
+type Filter struct {
+	Payload string
+	Type    string
+	SrcIP   string
+	DstIP   string
+	Port    string
+}
+
+// ParseFilter returns the filter given by the payload, type, src_ip,
+// dst_ip and port parameters
+func ParseFilter(v url.Values) Filter {
+	return Filter{
+		Payload: v.Get("payload"),
+		Type:    strings.ToUpper(v.Get("type")),
+		SrcIP:   v.Get("src_ip"),
+		DstIP:   v.Get("dst_ip"),
+		Port:    v.Get("port"),
+	}
+}
+
+// match reports whether the tree headers match the filter
+func (f Filter) match(ft FlowTree) bool {
+	return (f.Payload == "" || ft.ID == f.Payload) &&
+		(f.Type == "" || ft.Type == f.Type) &&
+		(f.SrcIP == "" || ft.SrcIP == f.SrcIP) &&
+		(f.DstIP == "" || ft.DstIP == f.DstIP) &&
+		(f.Port == "" || matchPort(f.Port, ft.SrcPort) || matchPort(f.Port, ft.DstPort))
+}
+
+// matchPort matches a port with or without its service name, e.g. 66
+// matches 66(sql-net)
+func matchPort(want, port string) bool {
+	return port == want || strings.SplitN(port, "(", 2)[0] == want
+}
+
+// subscriberBuffer is the number of events buffered per subscriber, the
+// events sent to a subscriber whose buffer is full are dropped
+const subscriberBuffer = 64
+
+// Broker fans flow tree events out to its subscribers
+type Broker struct {
+	lock        sync.RWMutex
+	subscribers map[chan Event]Filter
+}
+
+// NewBroker returns a Broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[chan Event]Filter)}
+}
+
+// Subscribe returns a channel receiving the events matching the filter
+// and a function cancelling the subscription
+func (b *Broker) Subscribe(f Filter) (<-chan Event, func()) {
+	c := make(chan Event, subscriberBuffer)
+
+	b.lock.Lock()
+	b.subscribers[c] = f
+	b.lock.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			if _, ok := b.subscribers[c]; ok {
+				delete(b.subscribers, c)
+				close(c)
+			}
+		})
+	}
+}
+
+// Close cancels every subscription, closing their channels
+func (b *Broker) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for c := range b.subscribers {
+		delete(b.subscribers, c)
+		close(c)
+	}
+}
+
+// Publish sends the event to the matching subscribers without blocking
+func (b *Broker) Publish(e Event) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for c, f := range b.subscribers {
+		if !f.match(e.meta) {
+			continue
+		}
+		select {
+		case c <- e:
+		default:
+			log.Printf("dropping %s event of %s, slow subscriber", e.Type, e.ID)
+		}
+	}
+}
+
+// liveTree is a flow tree being built from the observations as they arrive
+type liveTree struct {
+	// lock guards the tree, it is never acquired while holding the lock of
+	// the stream
+	lock    sync.Mutex
+	builder *builder
+	packets []packets.Packet
+	timer   *time.Timer
+	seq     int
+	// done is set once the tree is completed, later observations of its
+	// payload UID start a new tree
+	done bool
+}
+
+// Stream builds flow trees incrementally from the stored observations and
+// publishes their changes to the subscribers of its Broker. A tree is
+// completed, verified and stored once no observation of its payload UID
+// has arrived during the idle timeout, or when the stream is closed.
+type Stream struct {
+	broker   *Broker
+	topoRepo topology.Repository
+	smtRepo  smt.Repository
+	treeRepo Repository
+	solver   smt.Solver
+	enc      *Encoding
+	skew     *clock.Skew
+	idle     time.Duration
+
+	// lock guards the map of live trees and closed only, every tree has its
+	// own lock
+	lock   sync.Mutex
+	live   map[string]*liveTree
+	closed bool
+	// jobs counts the trees scheduled for completion and being completed
+	jobs sync.WaitGroup
+}
+
+// DefaultIdleTimeout is the idle timeout of streams created without one
+const DefaultIdleTimeout = 5 * time.Second
+
+// NewStream returns a new Stream storing the completed trees in treeRepo,
+// verified with solver against their paths encoded by enc, the capture
+// time of the observations is corrected by skew as they arrive. It
+// implements packets.Observer.
+func NewStream(topoRepo topology.Repository, smtRepo smt.Repository, treeRepo Repository, solver smt.Solver, enc *Encoding, skew *clock.Skew, idle time.Duration) *Stream {
+	if idle <= 0 {
+		idle = DefaultIdleTimeout
+	}
+	return &Stream{
+		broker:   NewBroker(),
+		topoRepo: topoRepo,
+		smtRepo:  smtRepo,
+		treeRepo: treeRepo,
+		solver:   solver,
+		enc:      enc,
+		skew:     skew,
+		idle:     idle,
+		live:     make(map[string]*liveTree),
+	}
+}
+
+// Subscribe returns a channel receiving the events matching the filter
+// and a function cancelling the subscription
+func (s *Stream) Subscribe(f Filter) (<-chan Event, func()) {
+	return s.broker.Subscribe(f)
+}
+
+// Observe adds a stored observation to the flow tree of its payload UID
+func (s *Stream) Observe(p packets.Packet) {
+	if err := p.Validate(); err != nil {
+		return
+	}
+	p = s.skew.Correct(p)
+
+	for {
+		lt := s.liveTree(p)
+		if lt == nil {
+			return
+		}
+		// a tree completed meanwhile is replaced by a new one
+		if s.observe(lt, p) {
+			return
+		}
+	}
+}
+
+// liveTree returns the live tree of the payload UID of p, locked, creating
+// it when there is none, or nil once the stream is closed. The generator of
+// a new tree is resolved without holding the lock of the stream.
+func (s *Stream) liveTree(p packets.Packet) *liveTree {
+	s.lock.Lock()
+	lt, ok := s.live[p.Payload]
+	closed := s.closed
+	s.lock.Unlock()
+	if closed {
+		log.Printf("stream closed, observation of %s at %s left out", p.Payload, p.Device)
+		return nil
+	}
+	if ok {
+		lt.lock.Lock()
+		return lt
+	}
+
+	g, err := newGenerator(s.topoRepo, s.smtRepo, s.solver, s.enc, time.Unix(0, p.CapturedAtNano))
+	if err != nil {
+		log.Printf("error streaming flow tree %s, %v", p.Payload, err)
+		return nil
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		log.Printf("stream closed, observation of %s at %s left out", p.Payload, p.Device)
+		return nil
+	}
+	if lt, ok := s.live[p.Payload]; ok {
+		// another observation created the tree meanwhile
+		s.lock.Unlock()
+		lt.lock.Lock()
+		return lt
+	}
+	lt = &liveTree{builder: g.newBuilder(p.Payload, p)}
+	// the tree is locked before it is visible so that its creation is
+	// published before any of its nodes
+	lt.lock.Lock()
+	s.live[p.Payload] = lt
+	s.lock.Unlock()
+
+	root := lt.builder.tree.Root
+	s.publish(TreeCreated, lt, &EventNode{Name: root.Name, Label: root.Label, Level: root.Level})
+	return lt
+}
+
+// observe adds the observation to the locked tree and unlocks it, it
+// returns false when the tree was completed meanwhile
+func (s *Stream) observe(lt *liveTree, p packets.Packet) bool {
+	defer lt.lock.Unlock()
+	if lt.done {
+		return false
+	}
+	if s.isClosed() {
+		// the tree is being completed by Close
+		log.Printf("stream closed, observation of %s at %s left out", p.Payload, p.Device)
+		return true
+	}
+
+	last := len(lt.packets) - 1
+	lt.packets = append(lt.packets, p)
+	if last < 0 || lt.packets[last].CapturedAtNano <= p.CapturedAtNano {
+		if n := lt.builder.add(p); n != nil {
+			s.publish(NodeAdded, lt, eventNode(n))
+		}
+	} else {
+		// the observation arrived out of order, the tree is rebuilt
+		s.rebuild(lt)
+	}
+
+	if lt.timer != nil && lt.timer.Stop() {
+		s.jobs.Done()
+	}
+	lt.seq++
+	seq := lt.seq
+	s.jobs.Add(1)
+	lt.timer = time.AfterFunc(s.idle, func() {
+		defer s.jobs.Done()
+		s.complete(p.Payload, lt, seq)
+	})
+	return true
+}
+
+func (s *Stream) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
+// Close stops building the trees of new observations, completes the trees
+// being built without waiting for their idle timeout and waits until they
+// are verified and stored, or until ctx is done.
+func (s *Stream) Close(ctx context.Context) error {
+	s.lock.Lock()
+	s.closed = true
+	live := make(map[string]*liveTree, len(s.live))
+	for id, lt := range s.live {
+		live[id] = lt
+	}
+	s.lock.Unlock()
+
+	for id, lt := range live {
+		lt.lock.Lock()
+		// trees whose timer already fired are being completed
+		if !lt.done && lt.timer != nil && lt.timer.Stop() {
+			go func(id string, lt *liveTree, seq int) {
+				defer s.jobs.Done()
+				s.complete(id, lt, seq)
+			}(id, lt, lt.seq)
+		}
+		lt.lock.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until the trees scheduled for completion are verified and
+// stored, e.g. once Close returned because ctx was done
+func (s *Stream) Wait() {
+	s.jobs.Wait()
+}
+
+// CloseSubscriptions cancels the subscriptions to the events, ending the
+// event streams, e.g. before the server shuts down
+func (s *Stream) CloseSubscriptions() {
+	s.broker.Close()
+}
+
+// rebuild builds the tree again from its observations sorted by capture
+// time, publishing the nodes not present before
+func (s *Stream) rebuild(lt *liveTree) {
+	sort.SliceStable(lt.packets, func(i, j int) bool {
+		return lt.packets[i].CapturedAtNano < lt.packets[j].CapturedAtNano
+	})
+
+	known := make(map[string]bool)
+	for _, ns := range lt.builder.tree.nodesByLevel {
+		for _, n := range ns {
+			known[n.Name] = true
+		}
+	}
+
+	b := lt.builder.g.newBuilder(lt.builder.id, lt.packets[0])
+	for _, p := range lt.packets {
+		if n := b.add(p); n != nil && !known[n.Name] {
+			s.publish(NodeAdded, lt, eventNode(n))
+		}
+	}
+	lt.builder = b
+}
+
+// complete publishes the completed tree, then verifies and stores it and
+// publishes the results
+func (s *Stream) complete(id string, lt *liveTree, seq int) {
+	lt.lock.Lock()
+	if lt.done || lt.seq != seq {
+		lt.lock.Unlock()
+		return
+	}
+	lt.done = true
+	ft := lt.builder.flowTree()
+	lt.lock.Unlock()
+
+	s.lock.Lock()
+	if s.live[id] == lt {
+		delete(s.live, id)
+	}
+	s.lock.Unlock()
+
+	s.broker.Publish(Event{Type: TreeCompleted, ID: id, Time: time.Now(), Tree: &ft, meta: ft})
+
+	g := lt.builder.g
+	g.Verify(&ft)
+	if _, err := persist(s.treeRepo, g, ft); err != nil {
+		log.Printf("error storing flow tree %s, %v", id, err)
+	}
+	s.broker.Publish(Event{Type: TreeVerified, ID: id, Time: time.Now(), Tree: &ft, meta: ft})
+}
+
+func (s *Stream) publish(t EventType, lt *liveTree, n *EventNode) {
+	meta := *lt.builder.ft
+	e := Event{Type: t, ID: meta.ID, Time: time.Now(), Node: n, meta: meta}
+	if t == TreeCreated {
+		e.Tree = &meta
+	}
+	s.broker.Publish(e)
+}
+
+func eventNode(n *Node) *EventNode {
+	e := &EventNode{Name: n.Name, Label: n.Label, Level: n.Level}
+	if n.Parent != nil {
+		e.Parent = n.Parent.Name
+	}
+	return e
+}
+
+// streamPing is the interval between the comments keeping idle event
+// streams open
+const streamPing = 15 * time.Second
+
+// Events handles HTTP GET requests streaming the flow tree events
+// matching the query parameters, see ParseFilter, as Server-Sent Events.
+func (s *Stream) Events(response http.ResponseWriter, request *http.Request) {
+
+	flusher, ok := response.(http.Flusher)
+	if !ok {
+		writeErr(response, errors.New("streaming is not supported"))
+		return
+	}
+
+	events, cancel := s.Subscribe(ParseFilter(request.URL.Query()))
+	defer cancel()
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(streamPing)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-ping.C:
+			fmt.Fprint(response, ": ping\n\n")
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("error encoding %s event, %v", e.Type, err)
+				continue
+			}
+			fmt.Fprintf(response, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
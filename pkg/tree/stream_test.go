@@ -0,0 +1,210 @@
+package tree
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+func streamPacket(device string, at time.Time) packets.Packet {
+	return packets.Packet{
+		Device:         device,
+		SrcIP:          "10.0.0.1",
+		DstIP:          "10.0.0.2",
+		SrcPort:        "40000",
+		DstPort:        "80(http)",
+		Payload:        "9b2c5a1e-0f3d-4c6b-8e7a-1d2f3a4b5c6d",
+		CapturedAt:     &at,
+		CapturedAtNano: at.UnixNano(),
+	}
+}
+
+func TestStream(t *testing.T) {
+	topoRepo := topology.NewMemoryRepository()
+	topoRepo.Store(topology.Legacy{
+		Hosts:    []string{"h1", "h2"},
+		Switches: []string{"s1", "s2"},
+		Links:    []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"},
+	}.Topology())
+
+	treeRepo := NewMemoryRepository()
+	s := NewStream(topoRepo, smt.NewMemoryRepository(), treeRepo, &smt.MockSolver{}, nil, nil, 50*time.Millisecond)
+
+	events, cancel := s.Subscribe(Filter{Port: "80"})
+	defer cancel()
+	other, cancelOther := s.Subscribe(Filter{Type: "UDP"})
+	defer cancelOther()
+
+	start := time.Now()
+	s.Observe(streamPacket("s1-eth1", start))
+	// s2-eth1 arrives before s1-eth2 although it was captured later
+	s.Observe(streamPacket("s2-eth1", start.Add(2*time.Millisecond)))
+	s.Observe(streamPacket("s1-eth2", start.Add(time.Millisecond)))
+
+	var got []EventType
+	var nodes []string
+	timeout := time.After(2 * time.Second)
+	for len(got) == 0 || got[len(got)-1] != TreeVerified {
+		select {
+		case e := <-events:
+			got = append(got, e.Type)
+			if e.Type == NodeAdded {
+				nodes = append(nodes, e.Node.Label)
+			}
+			if e.Type == TreeCompleted && (e.Tree == nil || e.Tree.Level != 3) {
+				t.Errorf("expected a completed tree of 3 levels, got %+v", e.Tree)
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for events, got %v", got)
+		}
+	}
+
+	want := []EventType{TreeCreated, NodeAdded, NodeAdded, TreeCompleted, TreeVerified}
+	if len(got) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected events %v, got %v", want, got)
+		}
+	}
+	if len(nodes) != 2 || nodes[0] != "s1" || nodes[1] != "s2" {
+		t.Errorf("expected nodes s1 and s2 to be added, got %v", nodes)
+	}
+
+	ft, err := treeRepo.FindByID("9b2c5a1e-0f3d-4c6b-8e7a-1d2f3a4b5c6d")
+	if err != nil || ft.Level != 3 || len(ft.Edges) != 1 {
+		t.Errorf("expected the completed tree to be stored, got %+v, %v", ft, err)
+	}
+	if groups, err := treeRepo.FindGroups(); err != nil || len(groups) != 1 || groups[0].Merged == nil {
+		t.Errorf("expected the merged view of the tree group to be stored, got %+v, %v", groups, err)
+	}
+
+	select {
+	case e := <-other:
+		t.Errorf("expected no event for the UDP subscriber, got %+v", e)
+	default:
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	topoRepo := topology.NewMemoryRepository()
+	topoRepo.Store(topology.Legacy{Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"}}.Topology())
+
+	// trees are completed on close without waiting for the idle timeout
+	treeRepo := NewMemoryRepository()
+	s := NewStream(topoRepo, smt.NewMemoryRepository(), treeRepo, &smt.MockSolver{}, nil, nil, time.Hour)
+	events, cancel := s.Subscribe(Filter{})
+	defer cancel()
+
+	start := time.Now()
+	s.Observe(streamPacket("s1-eth1", start))
+	s.Observe(streamPacket("s1-eth2", start.Add(time.Millisecond)))
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelCtx()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := treeRepo.FindByID("9b2c5a1e-0f3d-4c6b-8e7a-1d2f3a4b5c6d"); err != nil || ft.Level != 3 {
+		t.Errorf("expected the tree to be stored on close, got %+v, %v", ft, err)
+	}
+
+	s.Observe(streamPacket("s2-eth1", start.Add(2*time.Millisecond)))
+	if trees, _ := treeRepo.FindAll(); len(trees) != 1 || trees[0].Level != 3 {
+		t.Errorf("expected the observations after close to be left out, got %+v", trees)
+	}
+
+	s.CloseSubscriptions()
+	for range events {
+	}
+}
+
+func TestStreamCloseExpired(t *testing.T) {
+	topoRepo := topology.NewMemoryRepository()
+	topoRepo.Store(topology.Legacy{Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"}}.Topology())
+
+	// the trees are still completed when the context is already done, Wait
+	// returns once they are stored
+	treeRepo := NewMemoryRepository()
+	s := NewStream(topoRepo, smt.NewMemoryRepository(), treeRepo, &smt.MockSolver{}, nil, nil, time.Hour)
+
+	start := time.Now()
+	s.Observe(streamPacket("s1-eth1", start))
+	s.Observe(streamPacket("s1-eth2", start.Add(time.Millisecond)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Close(ctx)
+	s.Wait()
+	if ft, err := treeRepo.FindByID("9b2c5a1e-0f3d-4c6b-8e7a-1d2f3a4b5c6d"); err != nil || ft.Level != 3 {
+		t.Errorf("expected the tree to be stored after close, got %+v, %v", ft, err)
+	}
+}
+
+// blockingTopology blocks the first FindAt until release is closed
+type blockingTopology struct {
+	topology.Repository
+	entered chan struct{}
+	release chan struct{}
+	calls   int32
+}
+
+func (b *blockingTopology) FindAt(at time.Time) (*topology.Topology, error) {
+	if atomic.AddInt32(&b.calls, 1) == 1 {
+		close(b.entered)
+		<-b.release
+	}
+	return b.Repository.FindAt(at)
+}
+
+func TestStreamObserveConcurrently(t *testing.T) {
+	mem := topology.NewMemoryRepository()
+	mem.Store(topology.Legacy{Links: []string{"h1:s1-eth1", "s2:s1-eth2", "s1:s2-eth1", "h2:s2-eth2"}}.Topology())
+	topoRepo := &blockingTopology{Repository: mem, entered: make(chan struct{}), release: make(chan struct{})}
+
+	s := NewStream(topoRepo, smt.NewMemoryRepository(), NewMemoryRepository(), &smt.MockSolver{}, nil, nil, time.Hour)
+	events, cancel := s.Subscribe(Filter{})
+	defer cancel()
+
+	// the topology lookup of the first tree does not hold up the others
+	start := time.Now()
+	go s.Observe(streamPacket("s1-eth1", start))
+	<-topoRepo.entered
+
+	other := streamPacket("s1-eth1", start)
+	other.Payload = "0c4e6a8b-1d3f-4a5c-9e7b-2f4a6c8e0b1d"
+	observed := make(chan struct{})
+	go func() {
+		s.Observe(other)
+		close(observed)
+	}()
+	select {
+	case <-observed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("observation blocked by the topology lookup of another tree")
+	}
+	close(topoRepo.release)
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelCtx()
+	created := 0
+	for created < 2 {
+		select {
+		case e := <-events:
+			if e.Type == TreeCreated {
+				created++
+			}
+		case <-ctx.Done():
+			t.Fatalf("expected both trees to be created, got %d", created)
+		}
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
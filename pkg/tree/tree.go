@@ -17,6 +17,8 @@ type Node struct {
 	Children      []*Node
 	TimeOfIngress *time.Time
 	TimeOfEgress  *time.Time
+	// Interfaces are the devices the packet was observed at on this node
+	Interfaces []string
 
 	lock  sync.RWMutex
 	Level int
@@ -188,8 +190,8 @@ func toDOT(name string, g *gographviz.Graph, p *Node, n *Node) {
 
 // Edge holds source and destiny data of a node
 type Edge struct {
-	Src string
-	Dst string
+	Src string `json:"src" bson:"src"`
+	Dst string `json:"dst" bson:"dst"`
 }
 
 // Edges returns an array of edges for all the nodes in
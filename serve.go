@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/letitbeat/dp-analyzer/pkg/clock"
+	"github.com/letitbeat/dp-analyzer/pkg/config"
+	"github.com/letitbeat/dp-analyzer/pkg/dot"
+	"github.com/letitbeat/dp-analyzer/pkg/packets"
+	"github.com/letitbeat/dp-analyzer/pkg/pcap"
+	"github.com/letitbeat/dp-analyzer/pkg/rules"
+	"github.com/letitbeat/dp-analyzer/pkg/session"
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/storage"
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+)
+
+// serveCmd starts the HTTP server, configured by the config file, the
+// environment variables and the flags, see config.Load. On SIGINT or
+// SIGTERM the requests in progress are drained, then the flow trees being
+// built are completed and verified before it returns.
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	config.Flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s serve [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	c, err := config.Load(fs)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.WorkDir != "" {
+		if err := os.Chdir(c.WorkDir); err != nil {
+			return err
+		}
+	}
+
+	repos, err := storage.Open(context.Background(), c.StorageConfig())
+	if err != nil {
+		return err
+	}
+	defer repos.Close()
+
+	topoRepo := repos.Topology
+	topoHandler := topology.NewHandler(topoRepo, repos.Packets)
+
+	smtRepo := repos.SMT
+	smtHandler := smt.NewHandler(smtRepo)
+
+	solver, err := smt.NewSolver(c.Solver, c.SolverPath, c.SolverTimeout)
+	if err != nil {
+		return err
+	}
+	enc, err := tree.LoadEncoding(c.TemplatesDir)
+	if err != nil {
+		return err
+	}
+
+	treeRepo := repos.Trees
+
+	offsets, err := clock.ParseOffsets(c.ClockOffsets)
+	if err != nil {
+		return err
+	}
+	skew := clock.NewSkew(offsets)
+
+	stream := tree.NewStream(topoRepo, smtRepo, treeRepo, solver, enc, skew, c.TreeIdleTimeout)
+
+	// observations are tagged with their session before being streamed
+	packetsRepo := session.NewTaggingRepository(packets.NewObservedRepository(repos.Packets, stream), repos.Sessions)
+	packetsHandler := packets.NewHandler(packetsRepo)
+
+	pcapHandler := pcap.NewHandler(packetsRepo)
+
+	renderer, err := dot.NewRenderer(c.Renderer, c.RendererPath)
+	if err != nil {
+		return err
+	}
+	format, err := dot.ParseFormat(c.ImageFormat)
+	if err != nil {
+		return err
+	}
+	dot.SetDefault(renderer, format)
+
+	treeHandler := tree.NewHandler(packetsRepo, topoRepo, smtRepo, treeRepo, solver, enc, skew, repos.Sessions)
+
+	sessionHandler := session.NewHandler(repos.Sessions, packetsRepo, treeRepo)
+
+	clockHandler := clock.NewHandler(skew, packetsRepo, topoRepo)
+
+	rulesHandler := rules.NewHandler(repos.Rules, topoRepo, treeRepo)
+
+	router := mux.NewRouter()
+
+	router.HandleFunc("/topology", topoHandler.Set).Methods(http.MethodPost)
+	router.HandleFunc("/topology", topoHandler.Get).Methods(http.MethodGet)
+	router.HandleFunc("/topology/versions", topoHandler.Versions).Methods(http.MethodGet)
+	router.HandleFunc("/topology/versions/{id}", topoHandler.Version).Methods(http.MethodGet)
+	router.HandleFunc("/topology/diff", topoHandler.Diff).Methods(http.MethodGet)
+	router.HandleFunc("/topology/infer", topoHandler.Infer).Methods(http.MethodGet)
+	router.HandleFunc("/smt", smtHandler.Save).Methods(http.MethodPost)
+	router.HandleFunc("/smt", smtHandler.GetAll).Methods(http.MethodGet)
+	router.HandleFunc("/smt/{id}", smtHandler.Get).Methods(http.MethodGet)
+	router.HandleFunc("/smt/{id}", smtHandler.Update).Methods(http.MethodPut)
+	router.HandleFunc("/smt/{id}", smtHandler.Delete).Methods(http.MethodDelete)
+	router.HandleFunc("/rules", rulesHandler.GetAll).Methods(http.MethodGet)
+	router.HandleFunc("/rules/predict", rulesHandler.Predict).Methods(http.MethodPost)
+	router.HandleFunc("/rules/{switch}", rulesHandler.Get).Methods(http.MethodGet)
+	router.HandleFunc("/rules/{switch}", rulesHandler.Set).Methods(http.MethodPut)
+	router.HandleFunc("/rules/{switch}", rulesHandler.Delete).Methods(http.MethodDelete)
+	router.HandleFunc("/clock", clockHandler.Get).Methods(http.MethodGet)
+	router.HandleFunc("/clock/estimate", clockHandler.Estimate).Methods(http.MethodPost)
+	router.HandleFunc("/sessions", sessionHandler.Create).Methods(http.MethodPost)
+	router.HandleFunc("/sessions", sessionHandler.GetAll).Methods(http.MethodGet)
+	router.HandleFunc("/sessions/{id}", sessionHandler.Get).Methods(http.MethodGet)
+	router.HandleFunc("/sessions/{id}", sessionHandler.Delete).Methods(http.MethodDelete)
+	router.HandleFunc("/sessions/{id}/close", sessionHandler.Close).Methods(http.MethodPost)
+	router.HandleFunc("/sessions/{id}/archive", sessionHandler.Archive).Methods(http.MethodPost)
+	router.HandleFunc("/save", packetsHandler.Save).Methods(http.MethodPost)
+	router.HandleFunc("/save/batch", packetsHandler.SaveBatch).Methods(http.MethodPost)
+	router.HandleFunc("/import/pcap", pcapHandler.Import).Methods(http.MethodPost)
+	router.HandleFunc("/trees", treeHandler.Find).Methods(http.MethodGet)
+	router.HandleFunc("/trees/stream", stream.Events).Methods(http.MethodGet)
+	router.HandleFunc("/trees/compare", treeHandler.Compare).Methods(http.MethodGet)
+	router.HandleFunc("/trees/rebuild", treeHandler.Rebuild).Methods(http.MethodPost)
+	router.HandleFunc("/trees/{id}", treeHandler.Get).Methods(http.MethodGet)
+	router.HandleFunc("/anomalies", treeHandler.Anomalies).Methods(http.MethodGet)
+	router.HandleFunc("/latency", treeHandler.Latency).Methods(http.MethodGet)
+	router.HandleFunc("/", treeHandler.GetAll).Methods(http.MethodGet)
+
+	server := &http.Server{
+		Addr:         c.Listen,
+		Handler:      handlers.CORS()(router),
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+	}
+	// the event streams would otherwise hold the shutdown until it times out
+	server.RegisterOnShutdown(stream.CloseSubscriptions)
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", c.Listen)
+		if c.TLS.Enabled() {
+			errs <- server.ListenAndServeTLS(c.TLS.Cert, c.TLS.Key)
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-stop:
+		log.Printf("received %s, shutting down", sig)
+	}
+
+	return shutdown(server, stream, c.ShutdownTimeout)
+}
+
+// drainer drains the requests in progress, e.g. http.Server
+type drainer interface {
+	Shutdown(ctx context.Context) error
+}
+
+// completer completes the flow trees in progress, e.g. tree.Stream
+type completer interface {
+	Close(ctx context.Context) error
+	Wait()
+}
+
+// shutdown drains the requests in progress, then completes the flow trees
+// in progress, each one within timeout. The trees are completed even when
+// the requests could not be drained, and shutdown waits until they are
+// stored, so that the storage is not closed under them.
+func shutdown(server drainer, stream completer, timeout time.Duration) error {
+	var problems []string
+	drain, cancelDrain := context.WithTimeout(context.Background(), timeout)
+	defer cancelDrain()
+	if err := server.Shutdown(drain); err != nil {
+		problems = append(problems, fmt.Sprintf("error draining the requests in progress, %v", err))
+	}
+
+	complete, cancelComplete := context.WithTimeout(context.Background(), timeout)
+	defer cancelComplete()
+	if err := stream.Close(complete); err != nil {
+		problems = append(problems, fmt.Sprintf("error completing the flow trees in progress, %v", err))
+		log.Printf("waiting for the flow trees in progress to be stored")
+		stream.Wait()
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	log.Printf("shut down")
+	return nil
+}
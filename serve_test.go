@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hangingServer holds the requests in progress until ctx is done
+type hangingServer struct{}
+
+func (hangingServer) Shutdown(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// slowStream completes its trees after ctx is done
+type slowStream struct {
+	closeErr error
+	waited   bool
+}
+
+func (s *slowStream) Close(ctx context.Context) error {
+	s.closeErr = ctx.Err()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *slowStream) Wait() {
+	s.waited = true
+}
+
+func TestShutdown(t *testing.T) {
+	stream := &slowStream{}
+	err := shutdown(hangingServer{}, stream, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "draining") || !strings.Contains(err.Error(), "completing") {
+		t.Errorf("expected both errors to be reported, got %v", err)
+	}
+	// the trees get their own deadline and are waited for once it expires
+	if stream.closeErr != nil {
+		t.Errorf("expected the trees to be completed with a live context, got %v", stream.closeErr)
+	}
+	if !stream.waited {
+		t.Error("expected shutdown to wait for the trees in progress")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/letitbeat/dp-analyzer/pkg/topology"
+)
+
+// topologyCmd imports the topology file given as argument as a new
+// topology version
+func topologyCmd(args []string) error {
+	fs := flag.NewFlagSet("topology", flag.ExitOnError)
+	format := fs.String("format", "", "json, mininet, netjson, graphml or dot, derived from the file extension when empty")
+	check := fs.Bool("check", false, "print the converted topology without storing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s topology [-format name] [-check] file\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("a single topology file is expected")
+	}
+	name := fs.Arg(0)
+
+	f := topology.FormatOfFile(name)
+	if *format != "" {
+		var err error
+		if f, err = topology.ParseFormat(*format); err != nil {
+			return err
+		}
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	t, err := topology.Import(f, b)
+	if err != nil {
+		return fmt.Errorf("error importing %s, %v", name, err)
+	}
+
+	if *check {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	}
+
+	repos, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer repos.Close()
+
+	v, err := topology.NewVersion(repos.Topology, t)
+	if err != nil {
+		return err
+	}
+	log.Printf("imported %d nodes and %d links from %s as topology version %d", len(v.Nodes), len(v.Links), name, v.Version)
+	return nil
+}
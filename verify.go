@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/letitbeat/dp-analyzer/pkg/smt"
+	"github.com/letitbeat/dp-analyzer/pkg/tree"
+)
+
+// verifyCmd builds the flow trees of the observation files given as
+// arguments, as analyzeCmd does, and verifies the SMT properties of a
+// properties file against them. It fails when a tree does not satisfy
+// every property.
+func verifyCmd(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	o := offlineFlags(fs)
+	properties := fs.String("properties", "", "JSON array of the properties to verify, as posted to /smt, required")
+	templates := fs.String("templates", "/app/templates", "directory of the SMT encoding template smt.tmpl")
+	solverName := fs.String("solver", "z3", "SMT solver: z3 or cvc5")
+	solverPath := fs.String("solver-path", "", "solver binary, looked up in PATH when empty")
+	timeout := fs.Duration("solver-timeout", 0, "maximum time spent verifying a single property, unlimited when 0")
+	out := fs.String("o", "", "output file of the verified flow trees, the standard output when empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s verify -topology file -properties file [flags] observations.{json,ndjson,pcap,pcapng}...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *properties == "" {
+		fs.Usage()
+		return fmt.Errorf("no properties file given")
+	}
+	props, err := readProperties(*properties)
+	if err != nil {
+		return fmt.Errorf("error reading %s, %v", *properties, err)
+	}
+	if len(props) == 0 {
+		return fmt.Errorf("no properties found in %s", *properties)
+	}
+
+	solver, err := smt.NewSolver(*solverName, *solverPath, *timeout)
+	if err != nil {
+		return err
+	}
+	enc, err := tree.LoadEncoding(*templates)
+	if err != nil {
+		return err
+	}
+
+	trees, err := o.build(fs.Args(), props, solver, enc)
+	if err != nil {
+		fs.Usage()
+		return err
+	}
+	if err := writeJSON(*out, trees); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, ft := range trees {
+		if !ft.IsSat {
+			failed++
+			for _, r := range ft.Results {
+				switch {
+				case r.Error != "":
+					log.Printf("flow tree %s: property %s is %s, %s", ft.ID, r.Title, r.Verdict, r.Error)
+				case r.Verdict != smt.Sat:
+					log.Printf("flow tree %s: property %s is %s", ft.ID, r.Title, r.Verdict)
+				}
+			}
+		}
+	}
+	log.Printf("verified %d properties against %d flow trees", len(props), len(trees))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d flow trees do not satisfy every property", failed, len(trees))
+	}
+	return nil
+}
+
+// readProperties reads a JSON array of properties, properties without ID
+// are given a new one
+func readProperties(name string) ([]smt.Property, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var props []smt.Property
+	if err := json.Unmarshal(b, &props); err != nil {
+		return nil, err
+	}
+	for i := range props {
+		if props[i].ID.IsZero() {
+			props[i].ID = primitive.NewObjectID()
+		}
+	}
+	return props, nil
+}